@@ -0,0 +1,258 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the administrative page (available to users
+ * with the `admin` role only) showing the server's state: the
+ * database connections and copy, the thumbnail generation, the
+ * active sessions, the configuration, the latest errors, and the
+ * download statistics.
+ */
+
+type (
+	// `tConfigValue` is a single configuration value as shown on
+	// the admin page.
+	tConfigValue struct {
+		Name  string
+		Value string
+	}
+
+	// `tLogEntry` is a single logged error message.
+	tLogEntry struct {
+		Message   string
+		RequestID string
+		Sender    string
+		Time      time.Time
+	}
+
+	// `tErrorList` holds the latest logged error messages.
+	tErrorList struct {
+		sync.Mutex
+		entries []tLogEntry // ring buffer
+		next    int         // index of the next entry to write
+	}
+
+	// `tPopularity` is a document's download statistics as shown
+	// on the admin page.
+	tPopularity struct {
+		db.TDownloadCount
+		MB    string // megabytes sent
+		Title string
+	}
+
+	// `tSessionList` tracks the sessions used by page requests.
+	tSessionList struct {
+		sync.Mutex
+		seen   map[string]time.Time // last request per session ID
+		pruned time.Time            // the latest removal of old sessions
+	}
+)
+
+const (
+	// Number of error messages kept for the admin page.
+	adminErrorsLength = 50
+
+	// Number of documents shown in the admin page's popularity list.
+	adminPopularityLength = 50
+
+	// Maximal number of sessions tracked for the admin page; clients
+	// without cookies (e.g. crawlers) get a new session per request.
+	adminSessionsMax = 10000
+)
+
+var (
+	// The latest error messages logged by `logEntry()`.
+	adminErrors = &tErrorList{entries: make([]tLogEntry, 0, adminErrorsLength)}
+
+	// `AppArgs` fields whose values are not shown on the admin page.
+	adminSecretFields = map[string]bool{
+		`MetricsToken`: true,
+		`SMTPPassword`: true,
+	}
+
+	// The sessions used by page requests.
+	adminSessions = &tSessionList{seen: make(map[string]time.Time)}
+)
+
+// `add()` appends `aEntry` replacing the oldest entry if the list
+// is full.
+//
+//	`aEntry` The log entry to add.
+func (el *tErrorList) add(aEntry tLogEntry) {
+	el.Lock()
+	defer el.Unlock()
+
+	if len(el.entries) < cap(el.entries) {
+		el.entries = append(el.entries, aEntry)
+	} else {
+		el.entries[el.next] = aEntry
+	}
+	el.next = (el.next + 1) % cap(el.entries)
+} // add()
+
+// `list()` returns the logged errors, the latest first.
+func (el *tErrorList) list() []tLogEntry {
+	el.Lock()
+	defer el.Unlock()
+
+	result := make([]tLogEntry, 0, len(el.entries))
+	for idx := 1; idx <= len(el.entries); idx++ {
+		result = append(result,
+			el.entries[(el.next-idx+len(el.entries))%len(el.entries)])
+	}
+
+	return result
+} // list()
+
+// `active()` returns the number of sessions used within `aTTL`.
+//
+// Older sessions are forgotten.
+//
+//	`aTTL` The sessions' time to live.
+func (sl *tSessionList) active(aTTL time.Duration) int {
+	sl.Lock()
+	defer sl.Unlock()
+
+	sl.prune(time.Now(), aTTL)
+
+	return len(sl.seen)
+} // active()
+
+// `prune()` removes the sessions not used within `aTTL`.
+//
+// NOTE: The caller must hold the list's lock.
+//
+//	`aNow` The current time.
+//	`aTTL` The sessions' time to live.
+func (sl *tSessionList) prune(aNow time.Time, aTTL time.Duration) {
+	limit := aNow.Add(-aTTL)
+	for sid, seen := range sl.seen {
+		if seen.Before(limit) {
+			delete(sl.seen, sid)
+		}
+	}
+	sl.pruned = aNow
+} // prune()
+
+// `touch()` marks the session `aSID` as being used.
+//
+// Old sessions are removed once a minute; if there are still
+// `adminSessionsMax` sessions within `aTTL` new sessions aren't
+// tracked anymore.
+//
+//	`aSID` The session's ID.
+//	`aTTL` The sessions' time to live.
+func (sl *tSessionList) touch(aSID string, aTTL time.Duration) {
+	if 0 == len(aSID) {
+		return
+	}
+	sl.Lock()
+	defer sl.Unlock()
+
+	now := time.Now()
+	if _, ok := sl.seen[aSID]; !ok {
+		if (time.Minute < now.Sub(sl.pruned)) || (adminSessionsMax <= len(sl.seen)) {
+			sl.prune(now, aTTL)
+		}
+		if adminSessionsMax <= len(sl.seen) {
+			return
+		}
+	}
+	sl.seen[aSID] = now
+} // touch()
+
+// `adminSessionTTL()` returns the sessions' time to live.
+func adminSessionTTL() time.Duration {
+	return time.Duration(AppArgs.sessionTTL) * time.Second
+} // adminSessionTTL()
+
+// `configValues()` returns the effective configuration with the
+// secrets masked.
+func configValues() []tConfigValue {
+	val := reflect.ValueOf(AppArgs)
+	typ := val.Type()
+	result := make([]tConfigValue, 0, typ.NumField())
+	for idx := 0; idx < typ.NumField(); idx++ {
+		cv := tConfigValue{
+			Name:  typ.Field(idx).Name,
+			Value: fmt.Sprintf("%v", val.Field(idx)),
+		}
+		if adminSecretFields[cv.Name] && (0 < len(cv.Value)) {
+			cv.Value = `********`
+		}
+		result = append(result, cv)
+	}
+
+	return result
+} // configValues()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleAdmin()` shows the administrative page.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleAdmin(aWriter http.ResponseWriter, aRequest *http.Request, aOptions *db.TQueryOptions, aSession *sessions.TSession, aDB *db.TDataBase) {
+	pageData := ph.basicTemplateData(aRequest, aOptions).
+		Set("Config", configValues()).
+		Set("Errors", adminErrors.list()).
+		Set("Pool", db.PoolStats()).
+		Set("Sessions", adminSessions.active(adminSessionTTL())).
+		Set("Sync", db.SyncStatus()).
+		Set("Thumbs", thumbProgress())
+
+	if 0 < len(db.UserDatabaseFile()) {
+		udb, err := db.OpenUserDatabase(aRequest.Context())
+		if nil != err {
+			handleInternalError(aWriter, `TPageHandler.handleAdmin()`,
+				fmt.Sprintf("db.OpenUserDatabase(): %v", err))
+			return
+		}
+		list, err := udb.Downloads(aRequest.Context(), adminPopularityLength)
+		if nil != err {
+			handleInternalError(aWriter, `TPageHandler.handleAdmin()`,
+				fmt.Sprintf("Downloads(): %v", err))
+			return
+		}
+		popular := make([]tPopularity, len(list))
+		for idx, dc := range list {
+			popular[idx] = tPopularity{
+				TDownloadCount: dc,
+				MB:             fmt.Sprintf("%.1f", float64(dc.Bytes)/(1024*1024)),
+				Title:          fmt.Sprintf("#%d", dc.Book), // removed document
+			}
+			if doc := aDB.QueryDocMini(aRequest.Context(), dc.Book); nil != doc {
+				popular[idx].Title = doc.Title
+			}
+		}
+		pageData.Set("DownloadDays", db.DownloadRetention()).
+			Set("HasDownloads", true).
+			Set("Popular", popular)
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `private, no-store`)
+	ph.handleReply(`admin`, aWriter, aOptions, aSession, pageData)
+} // handleAdmin()
+
+/* _EoF_ */
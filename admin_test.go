@@ -0,0 +1,112 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_tErrorList(t *testing.T) {
+	el := &tErrorList{entries: make([]tLogEntry, 0, 3)}
+	if got := el.list(); 0 != len(got) {
+		t.Errorf("list() = %v, want empty list", got)
+	}
+
+	tests := []struct {
+		name  string
+		count int
+		want  string
+	}{
+		// TODO: Add test cases.
+		{" 1", 1, `0`},
+		{" 2", 2, `1 0`},
+		{" 3", 3, `2 1 0`},
+		{" 4", 5, `4 3 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := &tErrorList{entries: make([]tLogEntry, 0, 3)}
+			for idx := 0; idx < tt.count; idx++ {
+				el.add(tLogEntry{Message: fmt.Sprintf("%d", idx)})
+			}
+			got := ``
+			for _, entry := range el.list() {
+				got += ` ` + entry.Message
+			}
+			if ` `+tt.want != got {
+				t.Errorf("list() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_tErrorList()
+
+func Test_tSessionList(t *testing.T) {
+	sl := &tSessionList{seen: make(map[string]time.Time)}
+	sl.touch(``, time.Minute)
+	sl.touch(`one`, time.Minute)
+	sl.touch(`two`, time.Minute)
+	sl.touch(`one`, time.Minute)
+	if got := sl.active(time.Minute); 2 != got {
+		t.Errorf("active() = %d, want 2", got)
+	}
+	sl.seen[`two`] = time.Now().Add(-2 * time.Minute)
+	if got := sl.active(time.Minute); 1 != got {
+		t.Errorf("active() = %d, want 1", got)
+	}
+
+	// New sessions remove the old ones (at most once a minute):
+	sl.seen[`one`] = time.Now().Add(-2 * time.Minute)
+	sl.pruned = time.Now().Add(-2 * time.Minute)
+	sl.touch(`three`, time.Minute)
+	if _, ok := sl.seen[`one`]; ok {
+		t.Errorf("touch() kept an old session")
+	}
+
+	// The number of tracked sessions is limited:
+	for idx := 0; idx < adminSessionsMax+10; idx++ {
+		sl.touch(fmt.Sprintf("sid%d", idx), time.Minute)
+	}
+	if got := len(sl.seen); adminSessionsMax != got {
+		t.Errorf("touch() tracks %d sessions, want %d", got, adminSessionsMax)
+	}
+} // Test_tSessionList()
+
+func Test_configValues(t *testing.T) {
+	saved := AppArgs
+	defer func() { AppArgs = saved }()
+	AppArgs.SMTPPassword = `secret`
+	AppArgs.SMTPUser = `user`
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		// TODO: Add test cases.
+		{"SMTPPassword", `********`},
+		{"SMTPUser", `user`},
+	}
+	values := configValues()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, cv := range values {
+				if cv.Name == tt.name {
+					if cv.Value != tt.want {
+						t.Errorf("configValues() %s = %q, want %q", tt.name, cv.Value, tt.want)
+					}
+					return
+				}
+			}
+			t.Errorf("configValues() misses %s", tt.name)
+		})
+	}
+} // Test_configValues()
+
+/* _EoF_ */
@@ -0,0 +1,234 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides a JSON based REST API below `/api/v1/`.
+ */
+
+const (
+	// Max. number of list items to return with a single API call.
+	apiMaxLimitLength = 1000
+)
+
+type (
+	// `tAPIError` is the JSON structure of an API error reply.
+	tAPIError struct {
+		Error struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	// `tAPIList` is the JSON structure of a (partial) list reply.
+	tAPIList struct {
+		Total  int         `json:"total"`  // number of all matching items
+		Start  uint        `json:"start"`  // number of the first item returned
+		Length uint        `json:"length"` // max. number of items returned
+		Items  interface{} `json:"items"`  // the actual list of items
+	}
+)
+
+// `apiQueryOptions()` returns the query options configured by
+// the `aRequest` parameters.
+//
+// Besides the form fields handled by `TQueryOptions.Update()` the
+// `start` parameter is used to select the first item of a list.
+//
+//	`aRequest` The HTTP request received by the server.
+func apiQueryOptions(aRequest *http.Request) *db.TQueryOptions {
+	qo := db.NewQueryOptions(AppArgs.BooksPerPage).Update(aRequest)
+	qo.Layout = db.QoLayoutList
+	if (0 == qo.LimitLength) || (apiMaxLimitLength < qo.LimitLength) {
+		qo.LimitLength = apiMaxLimitLength
+	}
+	if start, err := strconv.Atoi(aRequest.FormValue(`start`)); (nil == err) && (0 < start) {
+		qo.LimitStart = uint(start)
+	} else {
+		qo.LimitStart = 0
+	}
+
+	return qo
+} // apiQueryOptions()
+
+// `apiSendError()` sends an error reply in JSON format.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aStatus` The HTTP status code to send.
+//	`aMessage` The error message to send.
+func apiSendError(aWriter http.ResponseWriter, aStatus int, aMessage string) {
+	var reply tAPIError
+	reply.Error.Status = aStatus
+	reply.Error.Message = aMessage
+
+	apiSendJSON(aWriter, aStatus, reply)
+} // apiSendError()
+
+// `apiSendJSON()` sends `aData` in JSON format.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aStatus` The HTTP status code to send.
+//	`aData` The data to send.
+func apiSendJSON(aWriter http.ResponseWriter, aStatus int, aData interface{}) {
+	page, err := json.Marshal(aData)
+	if nil != err {
+		msg := fmt.Sprintf("json.Marshal(): %v", err)
+		logError(`apiSendJSON()`, msg)
+		aStatus = http.StatusInternalServerError
+		page = []byte(`{"error":{"status":500,"message":"internal error"}}`)
+	}
+
+	aWriter.Header().Set(`Content-Type`, `application/json; charset=utf-8`)
+	aWriter.Header().Set(`Cache-Control`, `no-cache`)
+	aWriter.WriteHeader(aStatus)
+	_, _ = aWriter.Write(page)
+} // apiSendJSON()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleAPI()` serves the REST API below `/api/`.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL path following `/api/`.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleAPI(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aDB *db.TDataBase) {
+	parts := strings.Split(strings.Trim(aTail, `/`), `/`)
+	if `v1` != parts[0] {
+		apiSendError(aWriter, http.StatusNotFound, `unknown API version`)
+		return
+	}
+	if 1 == len(parts) {
+		apiSendError(aWriter, http.StatusNotFound, `missing API endpoint`)
+		return
+	}
+	qo := apiQueryOptions(aRequest)
+
+	switch parts[1] {
+	case `authors`, `languages`, `publisher`, `series`, `tags`:
+		if 2 == len(parts) {
+			ph.handleAPIentities(aWriter, aRequest, parts[1], qo, aDB)
+			return
+		}
+		id, err := strconv.Atoi(parts[2])
+		if (nil != err) || (0 >= id) {
+			apiSendError(aWriter, http.StatusBadRequest,
+				fmt.Sprintf("invalid ID '%s'", parts[2]))
+			return
+		}
+		qo.Entity, qo.ID, qo.Matching = parts[1], id, ``
+		ph.handleAPIbooks(aWriter, aRequest, qo, aDB)
+
+	case `books`:
+		if 2 == len(parts) {
+			ph.handleAPIbooks(aWriter, aRequest, qo, aDB)
+			return
+		}
+		id, err := strconv.Atoi(parts[2])
+		if (nil != err) || (0 >= id) {
+			apiSendError(aWriter, http.StatusBadRequest,
+				fmt.Sprintf("invalid ID '%s'", parts[2]))
+			return
+		}
+		doc := aDB.QueryDocument(aRequest.Context(), id)
+		if nil == doc {
+			apiSendError(aWriter, http.StatusNotFound,
+				fmt.Sprintf("book %d not found", id))
+			return
+		}
+		apiSendJSON(aWriter, http.StatusOK, doc)
+
+	case `search`:
+		if 0 == len(qo.Matching) {
+			apiSendError(aWriter, http.StatusBadRequest,
+				`missing 'matching' parameter`)
+			return
+		}
+		ph.handleAPIbooks(aWriter, aRequest, qo, aDB)
+
+	default:
+		apiSendError(aWriter, http.StatusNotFound,
+			fmt.Sprintf("unknown API endpoint '%s'", parts[1]))
+	}
+} // handleAPI()
+
+// `handleAPIbooks()` sends a list of books selected by `aOptions`.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aOptions` The current query options to use.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleAPIbooks(aWriter http.ResponseWriter, aRequest *http.Request, aOptions *db.TQueryOptions, aDB *db.TDataBase) {
+	var (
+		count   int
+		doclist *db.TDocList
+		err     error
+	)
+	if 0 < len(aOptions.Matching) {
+		count, doclist, err = aDB.QuerySearch(aRequest.Context(), aOptions)
+	} else {
+		count, doclist, err = aDB.QueryBy(aRequest.Context(), aOptions)
+	}
+	if nil != err {
+		msg := fmt.Sprintf("QueryBy/QuerySearch: %v", err)
+		logRequest(aRequest, "TPageHandler.handleAPIbooks()", msg)
+		apiSendError(aWriter, http.StatusInternalServerError, `database query failed`)
+		return
+	}
+	if nil == doclist {
+		doclist = db.NewDocList()
+	}
+
+	apiSendJSON(aWriter, http.StatusOK, tAPIList{
+		Total:  count,
+		Start:  aOptions.LimitStart,
+		Length: aOptions.LimitLength,
+		Items:  doclist,
+	})
+} // handleAPIbooks()
+
+// `handleAPIentities()` sends a list of `aEntity` rows.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aEntity` The entity to list (e.g. `authors`).
+//	`aOptions` The current query options to use.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleAPIentities(aWriter http.ResponseWriter, aRequest *http.Request, aEntity string, aOptions *db.TQueryOptions, aDB *db.TDataBase) {
+	count, list, err := aDB.QueryEntities(aRequest.Context(), aEntity, ``, false,
+		aOptions.LimitStart, aOptions.LimitLength)
+	if nil != err {
+		msg := fmt.Sprintf("QueryEntities(%s): %v", aEntity, err)
+		logRequest(aRequest, "TPageHandler.handleAPIentities()", msg)
+		apiSendError(aWriter, http.StatusInternalServerError, `database query failed`)
+		return
+	}
+	if nil == list {
+		list = &db.TEntityList{}
+	}
+
+	apiSendJSON(aWriter, http.StatusOK, tAPIList{
+		Total:  count,
+		Start:  aOptions.LimitStart,
+		Length: aOptions.LimitLength,
+		Items:  list,
+	})
+} // handleAPIentities()
+
+/* _EoF_ */
@@ -0,0 +1,114 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func Test_apiQueryOptions(t *testing.T) {
+	AppArgs.BooksPerPage = 24
+	tests := []struct {
+		name       string
+		url        string
+		wantStart  uint
+		wantLength uint
+		wantDesc   bool
+		wantMatch  string
+	}{
+		// TODO: Add test cases.
+		{" 1", `/api/v1/books`, 0, 24, false, ``},
+		{" 2", `/api/v1/books?start=48&limitlength=12&order=descending`, 48, 12, true, ``},
+		{" 3", `/api/v1/search?matching=pratchett&start=-5`, 0, 24, false, `pratchett`},
+		{" 4", `/api/v1/books?limitlength=100000`, 0, apiMaxLimitLength, false, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(`GET`, tt.url, nil)
+			got := apiQueryOptions(req)
+			if got.LimitStart != tt.wantStart {
+				t.Errorf("apiQueryOptions() LimitStart = %v, want %v", got.LimitStart, tt.wantStart)
+			}
+			if got.LimitLength != tt.wantLength {
+				t.Errorf("apiQueryOptions() LimitLength = %v, want %v", got.LimitLength, tt.wantLength)
+			}
+			if got.Descending != tt.wantDesc {
+				t.Errorf("apiQueryOptions() Descending = %v, want %v", got.Descending, tt.wantDesc)
+			}
+			if got.Matching != tt.wantMatch {
+				t.Errorf("apiQueryOptions() Matching = %v, want %v", got.Matching, tt.wantMatch)
+			}
+		})
+	}
+	AppArgs = TAppArgs{} // clear/reset the structure
+} // Test_apiQueryOptions()
+
+func TestWrapErrorPages_raw(t *testing.T) {
+	vl, err := newViewList(`./views`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	saved := db.CalibreCachePath()
+	defer func() { _ = db.SetCalibreCachePath(saved) }()
+	_ = db.SetCalibreCachePath(t.TempDir()) // without a database copy
+	handler := WrapErrorPages(&TPageHandler{viewList: vl})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		ctype  string
+	}{
+		// TODO: Add test cases.
+		{" 1", `/healthz`, http.StatusOK, `application/json; charset=utf-8`},
+		{" 2", `/readyz`, http.StatusServiceUnavailable, `application/json; charset=utf-8`},
+		{" 3", `/metrics`, http.StatusNotFound, `text/plain; charset=utf-8`},
+		{" 4", `/no/such/page`, http.StatusNotFound, `text/html; charset=utf-8`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(`GET`, tt.path, nil))
+			if w.Code != tt.status {
+				t.Errorf("WrapErrorPages() status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get(`Content-Type`); got != tt.ctype {
+				t.Errorf("WrapErrorPages() Content-Type = %q, want %q", got, tt.ctype)
+			}
+		})
+	}
+} // TestWrapErrorPages_raw()
+
+func Test_rawErrorRoute(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		// TODO: Add test cases.
+		{" 1", `/api/v1/books`, true},
+		{" 2", `/t/abc/api/v1/books`, true},
+		{" 3", `/readyz`, true},
+		{" 4", `/doc/1/doc.html`, false},
+		{" 5", `/apis`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rawErrorRoute(tt.path); got != tt.want {
+				t.Errorf("rawErrorRoute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_rawErrorRoute()
+
+/* _EoF_ */
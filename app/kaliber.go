@@ -23,7 +23,6 @@ import (
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/mwat56/apachelogger"
-	"github.com/mwat56/errorhandler"
 	"github.com/mwat56/kaliber"
 	"github.com/mwat56/sessions"
 )
@@ -59,6 +58,22 @@ func userCmdline() {
 	}
 } // userCmdline()
 
+// `tokenCmdline()` checks for and executes API token handling functions.
+func tokenCmdline() {
+	// All the following `kaliber.TokenXxx()` calls terminate the program:
+	if 0 < len(kaliber.AppArgs.TokenAdd) {
+		kaliber.TokenAdd(kaliber.AppArgs.TokenAdd, kaliber.AppArgs.TokenName,
+			kaliber.AppArgs.TokenScope, kaliber.AppArgs.TokenDays,
+			kaliber.AppArgs.PassFile)
+	}
+	if 0 < len(kaliber.AppArgs.TokenList) {
+		kaliber.TokenList(kaliber.AppArgs.TokenList)
+	}
+	if 0 < kaliber.AppArgs.TokenRevoke {
+		kaliber.TokenRevoke(kaliber.AppArgs.TokenRevoke)
+	}
+} // tokenCmdline()
+
 // `setupSignals()` configures the capture of the interrupts `SIGINT`
 // and `SIGTERM` to terminate the program gracefully.
 //
@@ -94,12 +109,15 @@ func main() {
 	// Handle commandline user/password maintenance:
 	userCmdline()
 
+	// Handle commandline API token maintenance:
+	tokenCmdline()
+
 	if ph, err = kaliber.NewPageHandler(); nil != err {
 		kaliber.ShowHelp()
 		exit(fmt.Sprintf("%s: %v", Me, err))
 	}
 	// Setup the errorpage handler:
-	handler := errorhandler.Wrap(ph, ph)
+	handler := kaliber.WrapErrorPages(ph)
 
 	// Inspect `sessiondir` config option and setup the session handler
 	if 0 < len(kaliber.AppArgs.SessionDir) {
@@ -0,0 +1,189 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the index pages listing all authors, series,
+ * tags, publishers, and languages.
+ */
+
+type (
+	// `tBrowseLink` is a single link of a browse page's navigation.
+	tBrowseLink struct {
+		Name    string
+		Title   string
+		URL     string
+		Current bool
+	}
+)
+
+var (
+	// The entities for which browse pages are available.
+	brEntities = []string{`authors`, `series`, `tags`, `publisher`, `languages`}
+
+	// The entities' titles in the supported GUI languages.
+	brEntityTitles = map[string]map[string]string{
+		`de`: {
+			`authors`:   `Autoren`,
+			`languages`: `Sprachen`,
+			`publisher`: `Verlage`,
+			`series`:    `Serien`,
+			`tags`:      `Stichwörter`,
+		},
+		`en`: {
+			`authors`:   `Authors`,
+			`languages`: `Languages`,
+			`publisher`: `Publishers`,
+			`series`:    `Series`,
+			`tags`:      `Tags`,
+		},
+	}
+
+	// The initials offered for alphabetical browsing.
+	brInitials = strings.Split(`#ABCDEFGHIJKLMNOPQRSTUVWXYZ`, ``)
+)
+
+// `browseInitial()` returns the normalised `aInitial` or an empty
+// string if `aInitial` is not one of `brInitials`.
+//
+//	`aInitial` The initial letter as requested by the user.
+func browseInitial(aInitial string) string {
+	aInitial = strings.ToUpper(strings.TrimSpace(aInitial))
+	for _, initial := range brInitials {
+		if initial == aInitial {
+			return initial
+		}
+	}
+
+	return ``
+} // browseInitial()
+
+// `browseURL()` returns the URL of a browse page.
+//
+//	`aEntity` The entity to list (e.g. `authors`).
+//	`aInitial` The initial letter of the entities to list.
+//	`aByCount` Whether to sort by the number of documents.
+//	`aStart` The number of the first entity to list.
+func browseURL(aEntity, aInitial string, aByCount bool, aStart uint) string {
+	values := url.Values{}
+	if 0 < len(aInitial) {
+		values.Set(`initial`, aInitial)
+	}
+	if aByCount {
+		values.Set(`order`, `count`)
+	}
+	if 0 < aStart {
+		values.Set(`start`, strconv.FormatUint(uint64(aStart), 10))
+	}
+	result := `/` + aEntity + `/`
+	if query := values.Encode(); 0 < len(query) {
+		result += `?` + query
+	}
+
+	return result
+} // browseURL()
+
+// `handleBrowse()` serves the index page of all `aEntity` rows.
+//
+// The page can be limited to entities starting with a certain
+// letter (`initial` parameter) and sorted by the number of documents
+// (`order=count`); the `start` parameter selects the page to show.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aEntity` The entity to list (e.g. `authors`).
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleBrowse(aWriter http.ResponseWriter, aRequest *http.Request, aEntity string, aOptions *db.TQueryOptions, aSession *sessions.TSession, aDB *db.TDataBase) {
+	initial := browseInitial(aRequest.FormValue(`initial`))
+	byCount := (`count` == aRequest.FormValue(`order`))
+	length := aOptions.LimitLength
+	var start uint
+	if s, err := strconv.Atoi(aRequest.FormValue(`start`)); (nil == err) && (0 < s) {
+		start = uint(s)
+	}
+
+	count, list, err := aDB.QueryEntities(aRequest.Context(), aEntity,
+		initial, byCount, start, length)
+	if nil != err {
+		msg := fmt.Sprintf("QueryEntities(%s): %v", aEntity, err)
+		logRequest(aRequest, "TPageHandler.handleBrowse()", msg)
+	}
+	BCount := uint(0)
+	if 0 < count {
+		BCount = uint(count)
+	}
+	BLast := start + length
+	if BLast > BCount {
+		BLast = BCount
+	}
+
+	pageData := ph.basicTemplateData(aRequest, aOptions)
+	lang, _ := (*pageData)["Lang"].(string)
+	titles, ok := brEntityTitles[lang]
+	if !ok {
+		titles = brEntityTitles[`en`]
+	}
+	entities := make([]tBrowseLink, 0, len(brEntities))
+	for _, entity := range brEntities {
+		entities = append(entities, tBrowseLink{
+			Name:    entity,
+			Title:   titles[entity],
+			URL:     browseURL(entity, ``, byCount, 0),
+			Current: entity == aEntity,
+		})
+	}
+	initials := make([]tBrowseLink, 0, len(brInitials))
+	for _, letter := range brInitials {
+		initials = append(initials, tBrowseLink{
+			Name:    letter,
+			URL:     browseURL(aEntity, letter, byCount, 0),
+			Current: letter == initial,
+		})
+	}
+
+	pageData.Set("AllURL", browseURL(aEntity, ``, byCount, 0)).
+		Set("AlphaURL", browseURL(aEntity, initial, false, 0)).
+		Set("BCount", BCount).
+		Set("BFirst", start+1).
+		Set("BLast", BLast).
+		Set("ByCount", byCount).
+		Set("CountURL", browseURL(aEntity, initial, true, 0)).
+		Set("Entities", entities).
+		Set("Entity", titles[aEntity]).
+		Set("EntityList", list).
+		Set("Initial", initial).
+		Set("Initials", initials)
+	if 0 < start {
+		prev := uint(0)
+		if start > length {
+			prev = start - length
+		}
+		pageData.Set("PrevURL", browseURL(aEntity, initial, byCount, prev))
+	}
+	if BLast < BCount {
+		pageData.Set("NextURL", browseURL(aEntity, initial, byCount, BLast))
+	}
+
+	ph.handleReply(`browse`, aWriter, aOptions, aSession, pageData)
+} // handleBrowse()
+
+/* _EoF_ */
@@ -0,0 +1,64 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"testing"
+)
+
+func Test_browseInitial(t *testing.T) {
+	tests := []struct {
+		name     string
+		aInitial string
+		want     string
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, ``},
+		{" 2", `a`, `A`},
+		{" 3", ` Z `, `Z`},
+		{" 4", `#`, `#`},
+		{" 5", `AB`, ``},
+		{" 6", `'`, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := browseInitial(tt.aInitial); got != tt.want {
+				t.Errorf("browseInitial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_browseInitial()
+
+func Test_browseURL(t *testing.T) {
+	type args struct {
+		aEntity  string
+		aInitial string
+		aByCount bool
+		aStart   uint
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`authors`, ``, false, 0}, `/authors/`},
+		{" 2", args{`tags`, `#`, false, 0}, `/tags/?initial=%23`},
+		{" 3", args{`series`, `B`, true, 48}, `/series/?initial=B&order=count&start=48`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := browseURL(tt.args.aEntity, tt.args.aInitial, tt.args.aByCount, tt.args.aStart); got != tt.want {
+				t.Errorf("browseURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_browseURL()
+
+/* _EoF_ */
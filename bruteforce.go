@@ -0,0 +1,405 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * This file provides the protection against brute-force attacks
+ * on the BasicAuth passwords.
+ *
+ * Failed logins are counted per client IP and per username; after
+ * `authMaxFails` failures the client (or username) is locked out for
+ * `authLockout` seconds, doubling with each further failure.
+ * Clients from the `authTrusted` networks are never locked out.
+ * At most `guardMaxEntries` clients and usernames are tracked each;
+ * beyond that the ones with the oldest failures are forgotten.
+ *
+ * Behind a reverse proxy all requests come from the proxy's address;
+ * so the client's IP is taken from the `X-Forwarded-For` header if
+ * the request was sent by one of the `trustedProxies` networks.
+ *
+ * All failures and lockouts are logged (with `warn` level) in a
+ * format suitable for `fail2ban`, e.g.
+ *
+ *	... authentication failure; user="bob" rhost=192.0.2.1
+ *	... authentication locked; user="bob" rhost=192.0.2.1 retry=120
+ *
+ * With the JSON and `logfmt` log formats the quotes are escaped
+ * (`user=\"bob\"`) which the `failregex` documented in the INI file
+ * allows for.
+ */
+
+type (
+	// `tFailures` are the failed logins of a client or username.
+	tFailures struct {
+		count int       // number of consecutive failures
+		key   string    // the client's IP or the username
+		last  time.Time // time of the latest failure
+		until time.Time // end of the current lockout
+	}
+
+	// `tFailureList` holds the failures ordered by their latest
+	// failure (oldest first).
+	tFailureList struct {
+		entries map[string]*list.Element // the list elements per key
+		order   *list.List               // the `*tFailures` entries
+	}
+
+	// `tLoginGuard` tracks the failed logins.
+	tLoginGuard struct {
+		sync.Mutex
+		clients  *tFailureList // failures per client IP
+		lockout  time.Duration // the first lockout's duration
+		maxFails int           // failures allowed before a lockout
+		trusted  []*net.IPNet  // networks never locked out
+		users    *tFailureList // failures per username
+	}
+)
+
+const (
+	// Upper limit of a single lockout; failures older than that
+	// are forgotten.
+	maxLockout = 24 * time.Hour
+
+	// Maximal number of clients (and usernames) tracked; the ones
+	// with the oldest failures are removed first.
+	guardMaxEntries = 10000
+)
+
+var (
+	// Reverse proxies whose `X-Forwarded-For` header is trusted.
+	trustedProxies []*net.IPNet
+)
+
+// `newFailureList()` returns a new (empty) `tFailureList` instance.
+func newFailureList() *tFailureList {
+	return &tFailureList{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+} // newFailureList()
+
+// `get()` returns the failures of `aKey` (or `nil` if there are none).
+//
+//	`aKey` The client's IP or the username.
+func (fl *tFailureList) get(aKey string) *tFailures {
+	if e, ok := fl.entries[aKey]; ok {
+		return e.Value.(*tFailures)
+	}
+
+	return nil
+} // get()
+
+// `remove()` forgets the failures of `aKey`.
+//
+//	`aKey` The client's IP or the username.
+func (fl *tFailureList) remove(aKey string) {
+	if e, ok := fl.entries[aKey]; ok {
+		fl.order.Remove(e)
+		delete(fl.entries, aKey)
+	}
+} // remove()
+
+// `touch()` returns the failures of `aKey` moved to the list's end;
+// outdated failures and – if there are too many – the oldest ones
+// are removed.
+//
+//	`aKey` The client's IP or the username.
+//	`aNow` The current time.
+func (fl *tFailureList) touch(aKey string, aNow time.Time) *tFailures {
+	// Forget outdated failures (the oldest ones come first):
+	for e := fl.order.Front(); nil != e; e = fl.order.Front() {
+		f := e.Value.(*tFailures)
+		if aNow.Sub(f.last) <= maxLockout {
+			break
+		}
+		fl.remove(f.key)
+	}
+	if e, ok := fl.entries[aKey]; ok {
+		fl.order.MoveToBack(e)
+		return e.Value.(*tFailures)
+	}
+	// Make room for the new entry:
+	for guardMaxEntries <= fl.order.Len() {
+		fl.remove(fl.order.Front().Value.(*tFailures).key)
+	}
+	f := &tFailures{key: aKey}
+	fl.entries[aKey] = fl.order.PushBack(f)
+
+	return f
+} // touch()
+
+// `newLoginGuard()` returns a new `tLoginGuard` instance.
+//
+//	`aMaxFails` The number of failures allowed before a lockout.
+//	`aLockout` The first lockout's duration in seconds.
+//	`aTrusted` List of trusted networks (CIDR) or IP addresses.
+func newLoginGuard(aMaxFails, aLockout int, aTrusted string) (*tLoginGuard, error) {
+	trusted, err := parseNetworks(aTrusted)
+	if nil != err {
+		return nil, fmt.Errorf("authTrusted: %w", err)
+	}
+
+	return &tLoginGuard{
+		clients:  newFailureList(),
+		lockout:  time.Duration(aLockout) * time.Second,
+		maxFails: aMaxFails,
+		trusted:  trusted,
+		users:    newFailureList(),
+	}, nil
+} // newLoginGuard()
+
+// `parseNetworks()` returns the networks listed in `aList`.
+//
+//	`aList` Comma separated list of networks (CIDR) or IP addresses.
+func parseNetworks(aList string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	list := strings.FieldsFunc(aList, func(aRune rune) bool {
+		return (',' == aRune) || (' ' == aRune)
+	})
+	for _, entry := range list {
+		if !strings.Contains(entry, `/`) {
+			if ip := net.ParseIP(entry); nil != ip {
+				bits := 128
+				if nil != ip.To4() {
+					bits = 32
+				}
+				entry = fmt.Sprintf("%s/%d", entry, bits)
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, ipNet)
+	}
+
+	return result, nil
+} // parseNetworks()
+
+// `inNetworks()` reports whether `aIP` belongs to one of `aList`.
+//
+//	`aIP` The client's IP address.
+//	`aList` The networks to check.
+func inNetworks(aIP string, aList []*net.IPNet) bool {
+	if ip := net.ParseIP(aIP); nil != ip {
+		for _, ipNet := range aList {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+} // inNetworks()
+
+// `clientIP()` returns the IP address of the remote client.
+//
+// If the request was sent by one of the `trustedProxies` the last
+// address in the `X-Forwarded-For` header not belonging to a trusted
+// proxy is used; that header is ignored for all other requests since
+// any client can set it.
+//
+//	`aRequest` The HTTP request received by the server.
+func clientIP(aRequest *http.Request) string {
+	host, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+	if nil != err {
+		host = aRequest.RemoteAddr
+	}
+	if !inNetworks(host, trustedProxies) {
+		return host
+	}
+	hops := strings.Split(strings.Join(aRequest.Header.Values(`X-Forwarded-For`), `,`), `,`)
+	for idx := len(hops) - 1; 0 <= idx; idx-- {
+		hop := strings.TrimSpace(hops[idx])
+		if nil == net.ParseIP(hop) {
+			break
+		}
+		host = hop
+		if !inNetworks(hop, trustedProxies) {
+			break
+		}
+	}
+
+	return host
+} // clientIP()
+
+// `viaUntrustedProxy()` reports whether `aRequest` carries an
+// `X-Forwarded-For` header but wasn't sent by a trusted proxy.
+//
+//	`aRequest` The HTTP request received by the server.
+func viaUntrustedProxy(aRequest *http.Request) bool {
+	if 0 == len(aRequest.Header.Get(`X-Forwarded-For`)) {
+		return false
+	}
+	host, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+	if nil != err {
+		host = aRequest.RemoteAddr
+	}
+
+	return !inNetworks(host, trustedProxies)
+} // viaUntrustedProxy()
+
+// `failed()` records a failed login and returns the resulting
+// lockout duration (if any).
+//
+//	`aIP` The client's IP address.
+//	`aUser` The username used for the login.
+//	`aNow` The current time.
+func (lg *tLoginGuard) failed(aIP, aUser string, aNow time.Time) time.Duration {
+	if lg.isTrusted(aIP) {
+		return 0
+	}
+	lg.Lock()
+	defer lg.Unlock()
+
+	c := lg.failure(lg.clients, aIP, aNow)
+	u := lg.failure(lg.users, aUser, aNow)
+	if c > u {
+		return c
+	}
+
+	return u
+} // failed()
+
+// `failure()` records a failure of `aKey` in `aList` and returns the
+// resulting lockout duration (if any).
+//
+// NOTE: The caller is expected to hold the lock.
+//
+//	`aList` The list of failures to update.
+//	`aKey` The client's IP or the username.
+//	`aNow` The current time.
+func (lg *tLoginGuard) failure(aList *tFailureList, aKey string, aNow time.Time) time.Duration {
+	f := aList.touch(aKey, aNow)
+	f.count++
+	f.last = aNow
+	if f.count < lg.maxFails {
+		return 0
+	}
+	// Exponential back-off: double the lockout with each failure.
+	wait := maxLockout
+	if shift := uint(f.count - lg.maxFails); 20 > shift {
+		if d := lg.lockout << shift; d < maxLockout {
+			wait = d
+		}
+	}
+	f.until = aNow.Add(wait)
+
+	return wait
+} // failure()
+
+// `isTrusted()` reports whether `aIP` belongs to a trusted network.
+//
+//	`aIP` The client's IP address.
+func (lg *tLoginGuard) isTrusted(aIP string) bool {
+	return inNetworks(aIP, lg.trusted)
+} // isTrusted()
+
+// `locked()` returns the remaining lockout duration of the client
+// `aIP` or the username `aUser`.
+//
+//	`aIP` The client's IP address.
+//	`aUser` The username used for the login.
+//	`aNow` The current time.
+func (lg *tLoginGuard) locked(aIP, aUser string, aNow time.Time) time.Duration {
+	if lg.isTrusted(aIP) {
+		return 0
+	}
+	lg.Lock()
+	defer lg.Unlock()
+
+	var result time.Duration
+	for _, f := range []*tFailures{lg.clients.get(aIP), lg.users.get(aUser)} {
+		if nil != f {
+			if wait := f.until.Sub(aNow); wait > result {
+				result = wait
+			}
+		}
+	}
+
+	return result
+} // locked()
+
+// `succeeded()` forgets the failed logins of `aUser`.
+//
+// The failures of the client's IP are kept so that a valid login
+// can't be used to continue a password spraying attack.
+//
+//	`aUser` The username used for the login.
+func (lg *tLoginGuard) succeeded(aUser string) {
+	lg.Lock()
+	lg.users.remove(aUser)
+	lg.Unlock()
+} // succeeded()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `sendLocked()` tells the remote user to retry later.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aWait` The remaining lockout duration.
+func sendLocked(aWriter http.ResponseWriter, aWait time.Duration) {
+	aWriter.Header().Set(`Retry-After`, strconv.Itoa(retrySeconds(aWait)))
+	http.Error(aWriter, `too many failed logins`, http.StatusTooManyRequests)
+} // sendLocked()
+
+// `retrySeconds()` returns `aWait` as (rounded up) seconds.
+//
+//	`aWait` The remaining lockout duration.
+func retrySeconds(aWait time.Duration) int {
+	return int((aWait + time.Second - 1) / time.Second)
+} // retrySeconds()
+
+// `checkLogin()` checks the request's BasicAuth credentials.
+//
+// It returns the name of the authenticated user (if any) and whether
+// the request may be processed; otherwise a reply is sent already.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) checkLogin(aWriter http.ResponseWriter, aRequest *http.Request) (string, bool) {
+	name, _, ok := aRequest.BasicAuth()
+	if (!ok) || (nil == ph.usrList) {
+		return ``, true
+	}
+	ip, now := clientIP(aRequest), time.Now()
+	if wait := ph.guard.locked(ip, name, now); 0 < wait {
+		msg := fmt.Sprintf("authentication locked; user=%q rhost=%s retry=%d",
+			name, ip, retrySeconds(wait))
+		warnRequest(aRequest, "TPageHandler.checkLogin()", msg)
+		sendLocked(aWriter, wait)
+		return ``, false
+	}
+	if nil == ph.usrList.IsAuthenticated(aRequest) {
+		ph.guard.succeeded(name)
+		return name, true
+	}
+
+	msg := fmt.Sprintf("authentication failure; user=%q rhost=%s", name, ip)
+	warnRequest(aRequest, "TPageHandler.checkLogin()", msg)
+	if wait := ph.guard.failed(ip, name, now); 0 < wait {
+		sendLocked(aWriter, wait)
+		return ``, false
+	}
+
+	return ``, true
+} // checkLogin()
+
+/* _EoF_ */
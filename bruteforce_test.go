@@ -0,0 +1,195 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_newLoginGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted string
+		ip      string
+		want    bool
+		isErr   bool
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, `127.0.0.1`, false, false},
+		{" 2", `127.0.0.0/8, 10.0.0.0/8`, `10.1.2.3`, true, false},
+		{" 3", `192.168.1.5`, `192.168.1.5`, true, false},
+		{" 4", `192.168.1.5`, `192.168.1.6`, false, false},
+		{" 5", `::1`, `::1`, true, false},
+		{" 6", `localhost`, ``, false, true},
+		{" 7", `10.0.0.0/33`, ``, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newLoginGuard(5, 60, tt.trusted)
+			if (nil != err) != tt.isErr {
+				t.Errorf("newLoginGuard() error = %v, wantErr %v", err, tt.isErr)
+				return
+			}
+			if nil == got {
+				return
+			}
+			if trusted := got.isTrusted(tt.ip); trusted != tt.want {
+				t.Errorf("isTrusted(%s) = %v, want %v", tt.ip, trusted, tt.want)
+			}
+		})
+	}
+} // Test_newLoginGuard()
+
+func Test_clientIP(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+	trustedProxies, _ = parseNetworks(`127.0.0.1, 10.0.0.0/8`)
+
+	tests := []struct {
+		name string
+		addr string
+		xff  string
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", `192.0.2.1:1234`, ``, `192.0.2.1`},
+		{" 2", `[2001:db8::1]:80`, ``, `2001:db8::1`},
+		{" 3", `192.0.2.3`, ``, `192.0.2.3`},
+		{" 4", `192.0.2.4:1234`, `198.51.100.1`, `192.0.2.4`},
+		{" 5", `127.0.0.1:1234`, `198.51.100.1`, `198.51.100.1`},
+		{" 6", `127.0.0.1:1234`, `198.51.100.1, 198.51.100.2`, `198.51.100.2`},
+		{" 7", `127.0.0.1:1234`, `198.51.100.1, 10.1.2.3`, `198.51.100.1`},
+		{" 8", `127.0.0.1:1234`, `bogus, 10.1.2.3`, `10.1.2.3`},
+		{" 9", `127.0.0.1:1234`, ``, `127.0.0.1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(`GET`, `/`, nil)
+			r.RemoteAddr = tt.addr
+			if 0 < len(tt.xff) {
+				r.Header.Set(`X-Forwarded-For`, tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_clientIP()
+
+func Test_tLoginGuard(t *testing.T) {
+	lg, _ := newLoginGuard(3, 60, `10.0.0.0/8`)
+	now := time.Now()
+	ip, other := `192.0.2.1`, `192.0.2.2`
+
+	// Two failures are allowed without a lockout:
+	for i := 1; 3 > i; i++ {
+		if wait := lg.failed(ip, `bob`, now); 0 != wait {
+			t.Errorf("failed() #%d = %v, want 0", i, wait)
+		}
+	}
+	if wait := lg.locked(ip, `bob`, now); 0 != wait {
+		t.Errorf("locked() = %v, want 0", wait)
+	}
+	// The third one locks the client and the username:
+	if wait := lg.failed(ip, `bob`, now); time.Minute != wait {
+		t.Errorf("failed() = %v, want %v", wait, time.Minute)
+	}
+	if wait := lg.locked(ip, `alice`, now); time.Minute != wait {
+		t.Errorf("locked(client) = %v, want %v", wait, time.Minute)
+	}
+	if wait := lg.locked(other, `bob`, now); time.Minute != wait {
+		t.Errorf("locked(user) = %v, want %v", wait, time.Minute)
+	}
+	if wait := lg.locked(other, `alice`, now); 0 != wait {
+		t.Errorf("locked(other) = %v, want 0", wait)
+	}
+	// Each further failure doubles the lockout:
+	if wait := lg.failed(ip, `bob`, now); 2*time.Minute != wait {
+		t.Errorf("failed() = %v, want %v", wait, 2*time.Minute)
+	}
+	// A successful login clears the username but not the client:
+	lg.succeeded(`bob`)
+	if wait := lg.locked(other, `bob`, now); 0 != wait {
+		t.Errorf("locked(user) after success = %v, want 0", wait)
+	}
+	if wait := lg.locked(ip, `bob`, now); 2*time.Minute != wait {
+		t.Errorf("locked(client) after success = %v, want %v", wait, 2*time.Minute)
+	}
+	// The lockout ends in time:
+	if wait := lg.locked(ip, `bob`, now.Add(3*time.Minute)); 0 != wait {
+		t.Errorf("locked() later = %v, want 0", wait)
+	}
+	// Old failures are forgotten:
+	if wait := lg.failed(ip, `carl`, now.Add(maxLockout+time.Hour)); 0 != wait {
+		t.Errorf("failed() much later = %v, want 0", wait)
+	}
+	// Trusted clients are never locked out:
+	for i := 0; 10 > i; i++ {
+		if wait := lg.failed(`10.0.0.1`, `dave`, now); 0 != wait {
+			t.Errorf("failed(trusted) = %v, want 0", wait)
+		}
+	}
+} // Test_tLoginGuard()
+
+func Test_tLoginGuard_flood(t *testing.T) {
+	lg, _ := newLoginGuard(3, 60, ``)
+	now := time.Now()
+
+	// The first username gets locked ...
+	for i := 0; 3 > i; i++ {
+		lg.failed(`192.0.2.1`, `bob`, now)
+	}
+	if wait := lg.locked(`192.0.2.2`, `bob`, now); 0 == wait {
+		t.Errorf("locked(bob) = %v, want > 0", wait)
+	}
+	// ... and is forgotten by a flood of other usernames:
+	for i := 0; 2*guardMaxEntries > i; i++ {
+		lg.failed(fmt.Sprintf("192.0.2.%d", i%200+2), fmt.Sprintf("user%d", i),
+			now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if n := len(lg.users.entries); guardMaxEntries != n {
+		t.Errorf("users = %d, want %d", n, guardMaxEntries)
+	}
+	if n := lg.users.order.Len(); guardMaxEntries != n {
+		t.Errorf("users order = %d, want %d", n, guardMaxEntries)
+	}
+	if wait := lg.locked(`192.0.2.250`, `bob`, now); 0 != wait {
+		t.Errorf("locked(bob) after flood = %v, want 0", wait)
+	}
+	// The latest usernames are still tracked:
+	last := fmt.Sprintf("user%d", 2*guardMaxEntries-1)
+	if f := lg.users.get(last); (nil == f) || (1 != f.count) {
+		t.Errorf("users.get(%s) = %v, want 1 failure", last, f)
+	}
+} // Test_tLoginGuard_flood()
+
+func Test_retrySeconds(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration
+		want int
+	}{
+		// TODO: Add test cases.
+		{" 1", time.Minute, 60},
+		{" 2", time.Minute + time.Millisecond, 61},
+		{" 3", time.Millisecond, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retrySeconds(tt.wait); got != tt.want {
+				t.Errorf("retrySeconds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_retrySeconds()
+
+/* _EoF_ */
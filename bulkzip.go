@@ -0,0 +1,302 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the ZIP download of a whole result set.
+ *
+ * The supported URLs are:
+ *
+ *	/zip/                    the user's current selection
+ *	/zip/{entity}/{id}       all documents of an author, series, tag etc.
+ *	/zip/search?q={term}     all documents matching a search term
+ *
+ * All of them accept a `format` parameter to select the preferred
+ * format; otherwise the `zipFormats` configuration is used.
+ */
+
+type (
+	// `tZipEntry` is a single file to put into the ZIP archive.
+	tZipEntry struct {
+		modTime time.Time
+		name    string // the file's name within the archive
+		path    string // the file's absolute path-/filename
+		size    int64
+	}
+)
+
+// `uniqueName()` returns `aName` or (if that's already used) a name
+// extended by the document's ID.
+//
+//	`aUsed` The names already used in the archive.
+//	`aName` The document's download name.
+//	`aID` The document's ID.
+func uniqueName(aUsed map[string]bool, aName string, aID db.TID) string {
+	if aUsed[aName] {
+		ext := filepath.Ext(aName)
+		aName = fmt.Sprintf("%s_(%d)%s", strings.TrimSuffix(aName, ext), aID, ext)
+	}
+	aUsed[aName] = true
+
+	return aName
+} // uniqueName()
+
+// `zipEntries()` returns the files to put into the ZIP archive
+// along with their total size.
+//
+// For each document the first available format of the preferred
+// formats is used; documents without such a format are skipped.
+//
+//	`aList` The documents to download.
+//	`aWanted` The format explicitly selected by the user (if any).
+func zipEntries(aList *db.TDocList, aWanted string) ([]tZipEntry, int64) {
+	if nil == aList {
+		return nil, 0
+	}
+	var (
+		size  int64
+		used  = make(map[string]bool, len(*aList))
+		pref  = zipFormats()
+		files = make([]tZipEntry, 0, len(*aList))
+	)
+	for idx := range *aList {
+		doc := &(*aList)[idx]
+		var formats []string
+		if list := doc.Files(); nil != list {
+			for _, file := range *list {
+				formats = append(formats, file.Name)
+			}
+		}
+		format := preferredFormat(formats, pref, aWanted)
+		if 0 == len(format) {
+			continue
+		}
+		file := doc.Filename(format)
+		if 0 == len(file) {
+			continue
+		}
+		fName := filepath.Join(db.CalibreLibraryPath(), file)
+		fi, err := os.Stat(fName)
+		if nil != err {
+			continue
+		}
+		files = append(files, tZipEntry{
+			modTime: fi.ModTime(),
+			name:    uniqueName(used, doc.DownloadName(format), doc.ID),
+			path:    fName,
+			size:    fi.Size(),
+		})
+		size += fi.Size()
+	}
+
+	return files, size
+} // zipEntries()
+
+// `zipFormats()` returns the configured preferred formats.
+func zipFormats() []string {
+	return strings.FieldsFunc(AppArgs.ZipFormats, func(aRune rune) bool {
+		return (',' == aRune) || (' ' == aRune)
+	})
+} // zipFormats()
+
+// `zipName()` returns the filename of the ZIP archive.
+//
+//	`aOptions` The query options used to select the documents.
+//	`aList` The documents to download.
+func zipName(aOptions *db.TQueryOptions, aList *db.TDocList) string {
+	name := `search`
+	if (0 < aOptions.ID) && (nil != aList) && (0 < len(*aList)) {
+		doc := &(*aList)[0]
+		var list *db.TEntityList
+		switch aOptions.Entity {
+		case `authors`:
+			list = doc.Authors()
+		case `languages`:
+			list = doc.Languages()
+		case `publisher`:
+			if ent := doc.Publisher(); nil != ent {
+				list = &db.TEntityList{*ent}
+			}
+		case `series`:
+			if ent := doc.Series(); nil != ent {
+				list = &db.TEntityList{*ent}
+			}
+		case `tags`:
+			list = doc.Tags()
+		}
+		if nil != list {
+			for _, ent := range *list {
+				if ent.ID == aOptions.ID {
+					name = ent.Name
+					break
+				}
+			}
+		}
+	}
+
+	return strings.Replace(
+		strings.Replace(name, ` `, `_`, -1), `/`, `-`, -1) + `.zip`
+} // zipName()
+
+// `writeZip()` writes a ZIP archive of `aEntries` to `aWriter`.
+//
+// The files are stored without compression since e-book formats
+// are compressed already.
+//
+//	`aWriter` The destination to write the archive to.
+//	`aEntries` The files to put into the archive.
+func writeZip(aWriter io.Writer, aEntries []tZipEntry) error {
+	zw := zip.NewWriter(aWriter)
+	for _, entry := range aEntries {
+		if err := addZipFile(zw, entry); nil != err {
+			return err
+		}
+	}
+
+	return zw.Close()
+} // writeZip()
+
+// `addZipFile()` copies a single file into the archive.
+//
+//	`aZip` The archive to add the file to.
+//	`aEntry` The file to add.
+func addZipFile(aZip *zip.Writer, aEntry tZipEntry) error {
+	file, err := os.Open(aEntry.path) // #nosec G304
+	if nil != err {
+		return err
+	}
+	defer file.Close()
+
+	w, err := aZip.CreateHeader(&zip.FileHeader{
+		Method:   zip.Store,
+		Modified: aEntry.modTime,
+		Name:     aEntry.name,
+	})
+	if nil != err {
+		return err
+	}
+	_, err = io.Copy(w, file)
+
+	return err
+} // addZipFile()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleZip()` sends a ZIP archive of the selected documents.
+//
+// The archive is streamed directly to the remote user without
+// using temporary files; the number of documents and the total
+// size are limited by the `zipMaxBooks` and `zipMaxSize` options.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL's remaining path (e.g. `series/{id}`).
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleZip(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aOptions *db.TQueryOptions, aSession *sessions.TSession, aDB *db.TDataBase) {
+	parts := strings.Split(aTail, `/`)
+	switch parts[0] {
+	case ``: // the user's current selection
+		if (0 == len(aOptions.Matching)) &&
+			((0 == aOptions.ID) || (0 == len(aOptions.Entity)) || (`all` == aOptions.Entity)) {
+			http.Error(aWriter, `no documents selected`, http.StatusBadRequest)
+			return
+		}
+
+	case `authors`, `languages`, `publisher`, `series`, `tags`:
+		id := 0
+		if 1 < len(parts) {
+			id, _ = strconv.Atoi(parts[1])
+		}
+		if 0 >= id {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		aOptions.Entity, aOptions.ID, aOptions.Matching = parts[0], id, ``
+
+	case `search`:
+		aOptions.Entity, aOptions.ID = ``, 0
+		if aOptions.Matching = strings.TrimSpace(aRequest.FormValue(`q`)); 0 == len(aOptions.Matching) {
+			http.Error(aWriter, `missing 'q' parameter`, http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	aOptions.Layout = db.QoLayoutList
+	aOptions.LimitStart = 0
+	aOptions.LimitLength = uint(AppArgs.ZipMaxBooks)
+
+	var (
+		count   int
+		doclist *db.TDocList
+		err     error
+	)
+	if 0 < len(aOptions.Matching) {
+		count, doclist, err = aDB.QuerySearch(aRequest.Context(), aOptions)
+	} else {
+		count, doclist, err = aDB.QueryBy(aRequest.Context(), aOptions)
+	}
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleZip()`,
+			fmt.Sprintf("QueryBy/QuerySearch: %v", err))
+		return
+	}
+	if AppArgs.ZipMaxBooks < count {
+		http.Error(aWriter,
+			fmt.Sprintf("too many documents for a ZIP download (%d, limit %d)",
+				count, AppArgs.ZipMaxBooks), http.StatusForbidden)
+		return
+	}
+	entries, size := zipEntries(doclist, aRequest.FormValue(`format`))
+	if 0 == len(entries) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	if maxSize := int64(AppArgs.ZipMaxSize) << 20; size > maxSize {
+		http.Error(aWriter,
+			fmt.Sprintf("the documents are too large for a ZIP download (%.1f MB, limit %d MB)",
+				float64(size)/(1<<20), AppArgs.ZipMaxSize), http.StatusForbidden)
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, `application/zip`)
+	aWriter.Header().Set(`Content-Disposition`,
+		mime.FormatMediaType(`attachment`, map[string]string{`filename`: zipName(aOptions, doclist)}))
+	aWriter.Header().Set(`Cache-Control`, `private, no-store`)
+	if `HEAD` == aRequest.Method {
+		return
+	}
+	if err = writeZip(aWriter, entries); nil != err {
+		// The headers are sent already, so all we can do is logging.
+		msg := fmt.Sprintf("writeZip(): %v", err)
+		logRequest(aRequest, "TPageHandler.handleZip()", msg)
+	}
+} // handleZip()
+
+/* _EoF_ */
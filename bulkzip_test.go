@@ -0,0 +1,116 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_uniqueName(t *testing.T) {
+	used := map[string]bool{}
+	tests := []struct {
+		name  string
+		aName string
+		aID   int
+		want  string
+	}{
+		// TODO: Add test cases.
+		{" 1", `Author_-_Title.epub`, 1, `Author_-_Title.epub`},
+		{" 2", `Author_-_Title.epub`, 2, `Author_-_Title_(2).epub`},
+		{" 3", `Author_-_Other.epub`, 3, `Author_-_Other.epub`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uniqueName(used, tt.aName, tt.aID); got != tt.want {
+				t.Errorf("uniqueName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_uniqueName()
+
+func Test_zipFormats(t *testing.T) {
+	saved := AppArgs.ZipFormats
+	defer func() { AppArgs.ZipFormats = saved }()
+
+	tests := []struct {
+		name    string
+		formats string
+		want    string
+	}{
+		// TODO: Add test cases.
+		{" 1", `EPUB,AZW3,MOBI,PDF`, `EPUB|AZW3|MOBI|PDF`},
+		{" 2", `EPUB, PDF`, `EPUB|PDF`},
+		{" 3", ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AppArgs.ZipFormats = tt.formats
+			if got := strings.Join(zipFormats(), `|`); got != tt.want {
+				t.Errorf("zipFormats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_zipFormats()
+
+func Test_writeZip(t *testing.T) {
+	dir := t.TempDir()
+	mTime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	var entries []tZipEntry
+	for _, name := range []string{`one.epub`, `two.pdf`} {
+		fName := filepath.Join(dir, name)
+		if err := os.WriteFile(fName, []byte(`content of `+name), 0600); nil != err {
+			t.Fatal(err)
+		}
+		entries = append(entries, tZipEntry{modTime: mTime, name: `Ä_` + name, path: fName})
+	}
+	buf := &bytes.Buffer{}
+	if err := writeZip(buf, entries); nil != err {
+		t.Fatalf("writeZip() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if nil != err {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	if 2 != len(zr.File) {
+		t.Fatalf("writeZip() files = %d, want %d", len(zr.File), 2)
+	}
+	for idx, file := range zr.File {
+		if entries[idx].name != file.Name {
+			t.Errorf("writeZip() name = %v, want %v", file.Name, entries[idx].name)
+		}
+		if zip.Store != file.Method {
+			t.Errorf("writeZip() method = %v, want %v", file.Method, zip.Store)
+		}
+		rc, err := file.Open()
+		if nil != err {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if want := `content of ` + filepath.Base(entries[idx].path); want != string(data) {
+			t.Errorf("writeZip() content = %q, want %q", data, want)
+		}
+	}
+
+	// A missing file must be reported:
+	entries = append(entries, tZipEntry{name: `missing`, path: filepath.Join(dir, `missing`)})
+	if err := writeZip(io.Discard, entries); nil == err {
+		t.Errorf("writeZip() = nil, want error")
+	}
+} // Test_writeZip()
+
+/* _EoF_ */
@@ -9,10 +9,19 @@ package kaliber
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
 /*
- * This file provides functions to maintain a user/password file.
+ * This file provides functions to maintain a user/password file
+ * and the users' API tokens.
  */
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
 	"github.com/mwat56/passlist"
 )
 
@@ -51,7 +60,7 @@ func UserCheck(aUser, aFilename string) {
 } // UserCheck()
 
 // UserDelete removes the entry for `aUser` from the password
-// list `aFilename`.
+// list `aFilename` and revokes all of the user's API tokens.
 //
 // NOTE: This function does not return but terminates the program
 // with error code `0` (zero) if successful, or `1` (one) otherwise.
@@ -59,6 +68,15 @@ func UserCheck(aUser, aFilename string) {
 //	`aUser` the username to remove from the password file.
 //	`aFilename` name of the password file to use.
 func UserDelete(aUser, aFilename string) {
+	if (0 < len(db.UserDatabaseFile())) && userExists(aUser, aFilename) {
+		n, err := tokenDB().RevokeTokens(context.Background(), aUser)
+		if nil != err {
+			tokenExit(err)
+		}
+		if 0 < n {
+			fmt.Printf("%d API token(s) of %s revoked\n", n, aUser)
+		}
+	}
 	passlist.DeleteUser(aUser, aFilename)
 } // UserDelete()
 
@@ -74,4 +92,112 @@ func UserUpdate(aUser, aFilename string) {
 	passlist.UpdateUser(aUser, aFilename)
 } // UserUpdate()
 
+// `userExists()` returns whether `aUser` is stored in the password
+// list `aFilename`.
+//
+//	`aUser` The username to lookup.
+//	`aFilename` name of the password file to use.
+func userExists(aUser, aFilename string) bool {
+	if 0 == len(aFilename) {
+		return false
+	}
+	ul, err := passlist.LoadPasswords(aFilename)
+
+	return (nil == err) && ul.Exists(aUser)
+} // userExists()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `tokenExit()` prints `aError` and terminates the program.
+//
+//	`aError` The error to report.
+func tokenExit(aError error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], aError)
+	os.Exit(1)
+} // tokenExit()
+
+// `tokenDB()` returns the user database (or terminates the program).
+func tokenDB() *db.TUserDB {
+	udb, err := db.OpenUserDatabase(context.Background())
+	if nil != err {
+		tokenExit(err)
+	}
+
+	return udb
+} // tokenDB()
+
+// TokenAdd creates a new API token for `aUser` and prints it.
+//
+// The user must be stored in the password list `aFilename`.
+//
+// NOTE: This function does not return but terminates the program
+// with error code `0` (zero) if successful, or `1` (one) otherwise.
+//
+//	`aUser` The name of the token's owner.
+//	`aName` A name (e.g. the client app) to identify the token.
+//	`aScope` The token's scope (`catalog` or `download`).
+//	`aDays` The number of days the token is valid (`0` for no expiry).
+//	`aFilename` name of the password file to use.
+func TokenAdd(aUser, aName, aScope string, aDays int, aFilename string) {
+	if !userExists(aUser, aFilename) {
+		tokenExit(fmt.Errorf("unknown user %q (see -ua)", aUser))
+	}
+	var expires time.Time
+	if 0 < aDays {
+		expires = time.Now().AddDate(0, 0, aDays)
+	}
+	token, err := tokenDB().CreateToken(context.Background(), aUser, aName, aScope, expires)
+	if nil != err {
+		tokenExit(err)
+	}
+	fmt.Printf("API token of %s (%s): %s\n", aUser, aScope, token)
+	os.Exit(0)
+} // TokenAdd()
+
+// TokenList prints the API tokens of `aUser` (or of all users if
+// `aUser` is `*`).
+//
+// NOTE: This function does not return but terminates the program
+// with error code `0` (zero) if successful, or `1` (one) otherwise.
+//
+//	`aUser` The name of the tokens' owner.
+func TokenList(aUser string) {
+	if `*` == aUser {
+		aUser = ``
+	}
+	tokens, err := tokenDB().Tokens(context.Background(), aUser)
+	if nil != err {
+		tokenExit(err)
+	}
+	date := func(aTime time.Time) string {
+		if aTime.IsZero() {
+			return `-`
+		}
+		return aTime.Format(`2006-01-02 15:04`)
+	} // date()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{`ID`, `User`, `Name`, `Scope`, `Created`, `Expires`, `Used`}, "\t"))
+	for _, token := range tokens {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.User,
+			token.Name, token.Scope, date(token.Created), date(token.Expires), date(token.Used))
+	}
+	_ = tw.Flush()
+	os.Exit(0)
+} // TokenList()
+
+// TokenRevoke removes the API token `aID`.
+//
+// NOTE: This function does not return but terminates the program
+// with error code `0` (zero) if successful, or `1` (one) otherwise.
+//
+//	`aID` The ID of the token to remove (see `TokenList()`).
+func TokenRevoke(aID int) {
+	if err := tokenDB().RevokeToken(context.Background(), ``, int64(aID)); nil != err {
+		tokenExit(err)
+	}
+	fmt.Printf("API token %d revoked\n", aID)
+	os.Exit(0)
+} // TokenRevoke()
+
 /* _EoF_ */
@@ -0,0 +1,375 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register the image formats used by comics
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the page viewer for comic books (CBZ).
+ *
+ * The viewer page is served as `/comic/{id}/` with the page to
+ * show given by the `p` parameter; the single pages are served as
+ * `/comic/{id}/{page}` optionally resized to the width given by
+ * the `w` parameter.
+ */
+
+type (
+	// `tComic` represents an opened comic book archive.
+	tComic struct {
+		archive *zip.ReadCloser
+		pages   []*zip.File // the archive's images in reading order
+	}
+
+	// `tComicPage` is a single page link of the viewer's page-strip.
+	tComicPage struct {
+		Current bool
+		Number  int    // the page's one-based number
+		Src     string // the preview image's URL
+		URL     string // the viewer's URL for this page
+	}
+)
+
+const (
+	// The width of the pages shown by the viewer.
+	cbPageWidth = 1280
+
+	// Maximal number of pixels of a page image to resize; larger
+	// images are sent unchanged.
+	cbMaxPixels = 40 << 20
+
+	// The width of the pages shown in the page-strip.
+	cbPreviewWidth = 96
+
+	// The number of previews shown on either side of the current page.
+	cbStripRange = 5
+)
+
+var (
+	// `errComicEmpty` is returned for archives without any images.
+	errComicEmpty = errors.New(`no images found`)
+
+	// The image types recognised as comic pages.
+	cbImageExtensions = map[string]bool{
+		`.gif`:  true,
+		`.jpeg`: true,
+		`.jpg`:  true,
+		`.png`:  true,
+		`.webp`: true,
+	}
+)
+
+// `comicPageURL()` returns the URL of a single comic page.
+//
+//	`aID` The document's ID.
+//	`aPage` The zero-based index of the page.
+//	`aWidth` The requested width (`0` for the original size).
+func comicPageURL(aID db.TID, aPage int, aWidth uint) string {
+	result := fmt.Sprintf(`/comic/%d/%d`, aID, aPage)
+	if 0 < aWidth {
+		result += `?w=` + strconv.FormatUint(uint64(aWidth), 10)
+	}
+
+	return result
+} // comicPageURL()
+
+// `comicViewerURL()` returns the URL of the viewer page.
+//
+//	`aID` The document's ID.
+//	`aPage` The zero-based index of the page to show.
+func comicViewerURL(aID db.TID, aPage int) string {
+	result := fmt.Sprintf(`/comic/%d/`, aID)
+	if 0 < aPage {
+		result += `?p=` + strconv.Itoa(aPage)
+	}
+
+	return result
+} // comicViewerURL()
+
+// `naturalLess()` reports whether `aOne` sorts before `aTwo`
+// comparing runs of digits by their numerical value
+// (i.e. `page2` sorts before `page10`).
+//
+//	`aOne` The first string to compare.
+//	`aTwo` The second string to compare.
+func naturalLess(aOne, aTwo string) bool {
+	aOne, aTwo = strings.ToLower(aOne), strings.ToLower(aTwo)
+	i, j := 0, 0
+	for (i < len(aOne)) && (j < len(aTwo)) {
+		c1, c2 := aOne[i], aTwo[j]
+		if isDigit(c1) && isDigit(c2) {
+			// compare the numerical values of both digit runs:
+			s1, s2 := i, j
+			for (i < len(aOne)) && isDigit(aOne[i]) {
+				i++
+			}
+			for (j < len(aTwo)) && isDigit(aTwo[j]) {
+				j++
+			}
+			n1 := strings.TrimLeft(aOne[s1:i], `0`)
+			n2 := strings.TrimLeft(aTwo[s2:j], `0`)
+			if len(n1) != len(n2) {
+				return len(n1) < len(n2)
+			}
+			if n1 != n2 {
+				return n1 < n2
+			}
+			continue
+		}
+		if c1 != c2 {
+			return c1 < c2
+		}
+		i++
+		j++
+	}
+
+	return (len(aOne) - i) < (len(aTwo) - j)
+} // naturalLess()
+
+// `isDigit()` reports whether `aChar` is an ASCII digit.
+func isDigit(aChar byte) bool {
+	return ('0' <= aChar) && ('9' >= aChar)
+} // isDigit()
+
+// `openComic()` opens the CBZ file `aFilename` and collects
+// the contained images in natural sort order.
+//
+// The caller is responsible for closing the returned instance.
+//
+//	`aFilename` The absolute path-/filename of the CBZ file.
+func openComic(aFilename string) (*tComic, error) {
+	archive, err := zip.OpenReader(aFilename)
+	if nil != err {
+		return nil, err
+	}
+	result := &tComic{
+		archive: archive,
+		pages:   make([]*zip.File, 0, len(archive.File)),
+	}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() ||
+			strings.HasPrefix(file.Name, `__MACOSX/`) ||
+			strings.HasPrefix(path.Base(file.Name), `.`) {
+			continue
+		}
+		if cbImageExtensions[strings.ToLower(path.Ext(file.Name))] {
+			result.pages = append(result.pages, file)
+		}
+	}
+	if 0 == len(result.pages) {
+		_ = archive.Close()
+		return nil, errComicEmpty
+	}
+	sort.SliceStable(result.pages, func(i, j int) bool {
+		return naturalLess(result.pages[i].Name, result.pages[j].Name)
+	})
+
+	return result, nil
+} // openComic()
+
+// Close closes the comic book archive.
+func (cb *tComic) Close() error {
+	return cb.archive.Close()
+} // Close()
+
+// `servePage()` sends the page `aIndex` to the remote user.
+//
+// If `aWidth` is smaller than the page's original width the page
+// is downscaled and sent as a JPEG image.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aIndex` The zero-based index of the page to send.
+//	`aWidth` The maximal width of the page (`0` for the original size).
+func (cb *tComic) servePage(aWriter http.ResponseWriter, aRequest *http.Request, aIndex int, aWidth uint) {
+	if (0 > aIndex) || (len(cb.pages) <= aIndex) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	file := cb.pages[aIndex]
+	rc, err := file.Open()
+	if nil != err {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	defer rc.Close()
+
+	// The archive's size information can't be trusted:
+	maxSize := int64(AppArgs.ComicMaxSize) << 20
+	data, err := io.ReadAll(io.LimitReader(rc, maxSize+1))
+	if nil != err {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		msg := fmt.Sprintf("page %q exceeds %d MB", file.Name, AppArgs.ComicMaxSize)
+		logContext(aRequest.Context(), levelWarn, "tComic.servePage()", msg)
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	cType := mime.TypeByExtension(strings.ToLower(path.Ext(file.Name)))
+	if (0 < aWidth) && cbResizable(data, aWidth) {
+		if sImg, _, err := image.Decode(bytes.NewReader(data)); nil == err {
+			buf := &bytes.Buffer{}
+			if err = jpeg.Encode(buf, resizeImage(sImg, aWidth), &jpeg.Options{Quality: 85}); nil == err {
+				data, cType = buf.Bytes(), `image/jpeg`
+			}
+		}
+	}
+	if 0 == len(cType) {
+		cType = http.DetectContentType(data)
+	}
+
+	aWriter.Header().Set(`Content-Type`, cType)
+	aWriter.Header().Set(`Content-Length`, strconv.Itoa(len(data)))
+	if `HEAD` == aRequest.Method {
+		return
+	}
+	_, _ = aWriter.Write(data)
+} // servePage()
+
+// `cbResizable()` reports whether the image `aData` is wider than
+// `aWidth` and small enough to be decoded.
+//
+// Only the image's header is read so that huge images (e.g. highly
+// compressed ones) don't exhaust the server's memory.
+//
+//	`aData` The encoded page image.
+//	`aWidth` The maximal width of the page.
+func cbResizable(aData []byte, aWidth uint) bool {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(aData))
+	if (nil != err) || (uint(cfg.Width) <= aWidth) || (0 >= cfg.Height) {
+		return false
+	}
+
+	return int64(cfg.Width)*int64(cfg.Height) <= cbMaxPixels
+} // cbResizable()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleComic()` serves the comic viewer page as well as the
+// comic's single pages.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL's remaining path (i.e. `{id}/{page}`).
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleComic(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aOptions *db.TQueryOptions, aSession *sessions.TSession, aDB *db.TDataBase) {
+	parts := strings.SplitN(aTail, `/`, 2)
+	id, _ := strconv.Atoi(parts[0])
+	doc := aDB.QueryDocMini(aRequest.Context(), db.TID(id))
+	if nil == doc {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	file := doc.Filename(`CBZ`)
+	if 0 == len(file) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	fName := filepath.Join(db.CalibreLibraryPath(), file)
+	page := -1
+	if (1 < len(parts)) && (0 < len(parts[1])) {
+		if page, _ = strconv.Atoi(parts[1]); 0 > page {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		// The pages don't change without the file changing:
+		aWriter.Header().Set(`Cache-Control`, `private, max-age=864000`) // 10 days
+		if fileNotModified(aWriter, aRequest, fName) {
+			return
+		}
+	}
+
+	comic, err := openComic(fName)
+	if nil != err {
+		msg := fmt.Sprintf("openComic(%s): %v", file, err)
+		logRequest(aRequest, "TPageHandler.handleComic()", msg)
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	defer comic.Close()
+
+	if 0 <= page {
+		var width uint
+		if w, err := strconv.Atoi(aRequest.FormValue(`w`)); (nil == err) && (0 < w) {
+			width = uint(w)
+		}
+		comic.servePage(aWriter, aRequest, page, width)
+		return
+	}
+
+	count := len(comic.pages)
+	page, _ = strconv.Atoi(aRequest.FormValue(`p`))
+	if (0 > page) || (count <= page) {
+		page = 0
+	}
+	first, last := page-cbStripRange, page+cbStripRange
+	if 0 > first {
+		first = 0
+	}
+	if count <= last {
+		last = count - 1
+	}
+	strip := make([]tComicPage, 0, last-first+1)
+	for idx := first; idx <= last; idx++ {
+		strip = append(strip, tComicPage{
+			Current: idx == page,
+			Number:  idx + 1,
+			Src:     comicPageURL(doc.ID, idx, cbPreviewWidth),
+			URL:     comicViewerURL(doc.ID, idx),
+		})
+	}
+	// The neighbouring pages are preloaded by the browser:
+	preload := make([]string, 0, 2)
+
+	pageData := ph.basicTemplateData(aRequest, aOptions).
+		Set("Document", doc).
+		Set("FirstURL", comicViewerURL(doc.ID, 0)).
+		Set("LastURL", comicViewerURL(doc.ID, count-1)).
+		Set("Page", page+1).
+		Set("PageCount", count).
+		Set("PageSrc", comicPageURL(doc.ID, page, cbPageWidth)).
+		Set("Strip", strip)
+	if 0 < page {
+		pageData.Set("PrevURL", comicViewerURL(doc.ID, page-1))
+		preload = append(preload, comicPageURL(doc.ID, page-1, cbPageWidth))
+	}
+	if page+1 < count {
+		pageData.Set("NextURL", comicViewerURL(doc.ID, page+1))
+		preload = append(preload, comicPageURL(doc.ID, page+1, cbPageWidth))
+	}
+	pageData.Set("Preload", preload)
+	ph.setBookmarkData(aRequest, pageData, doc.ID, comicViewerURL(doc.ID, page))
+
+	ph.handleReply(`comic`, aWriter, aOptions, aSession, pageData)
+} // handleComic()
+
+/* _EoF_ */
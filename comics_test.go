@@ -0,0 +1,205 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// `writeTestComic()` creates a CBZ file with unsorted page images.
+func writeTestComic(t *testing.T) string {
+	fName := filepath.Join(t.TempDir(), `test.cbz`)
+	file, err := os.Create(fName)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	buf := &bytes.Buffer{}
+	if err = png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 400, 200))); nil != err {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(file)
+	for _, name := range []string{`p10.png`, `p2.png`, `P1.png`, `__MACOSX/._p1.png`, `info.txt`} {
+		w, err := zw.Create(name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(buf.Bytes()); nil != err {
+			t.Fatal(err)
+		}
+	}
+	// A page exceeding `comicMaxSize` (1 MB in the tests):
+	w, err := zw.Create(`p99.png`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(make([]byte, 1<<20+1)); nil != err {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	return fName
+} // writeTestComic()
+
+func Test_comicPageURL(t *testing.T) {
+	type args struct {
+		aPage  int
+		aWidth uint
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{0, 0}, `/comic/5/0`},
+		{" 2", args{12, 96}, `/comic/5/12?w=96`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := comicPageURL(5, tt.args.aPage, tt.args.aWidth); got != tt.want {
+				t.Errorf("comicPageURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_comicPageURL()
+
+func Test_naturalLess(t *testing.T) {
+	type args struct {
+		aOne string
+		aTwo string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`page2.jpg`, `page10.jpg`}, true},
+		{" 2", args{`page10.jpg`, `page2.jpg`}, false},
+		{" 3", args{`Page002.jpg`, `page10.jpg`}, true},
+		{" 4", args{`a/01.jpg`, `b/00.jpg`}, true},
+		{" 5", args{`page1.jpg`, `page1a.jpg`}, true},
+		{" 6", args{`same.jpg`, `same.jpg`}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := naturalLess(tt.args.aOne, tt.args.aTwo); got != tt.want {
+				t.Errorf("naturalLess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_naturalLess()
+
+func Test_openComic(t *testing.T) {
+	saved := AppArgs.ComicMaxSize
+	defer func() { AppArgs.ComicMaxSize = saved }()
+	AppArgs.ComicMaxSize = 1
+	comic, err := openComic(writeTestComic(t))
+	if nil != err {
+		t.Fatalf("openComic() error = %v", err)
+	}
+	defer comic.Close()
+
+	want := []string{`P1.png`, `p2.png`, `p10.png`, `p99.png`}
+	if len(want) != len(comic.pages) {
+		t.Fatalf("openComic() pages = %d, want %d", len(comic.pages), len(want))
+	}
+	for idx, name := range want {
+		if comic.pages[idx].Name != name {
+			t.Errorf("openComic() page %d = %v, want %v", idx, comic.pages[idx].Name, name)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		page     int
+		width    uint
+		wantCode int
+		wantType string
+	}{
+		// TODO: Add test cases.
+		{" 1", 0, 0, 200, `image/png`},
+		{" 2", 1, 100, 200, `image/jpeg`},
+		{" 3", 2, 800, 200, `image/png`},
+		{" 4", 3, 0, 404, ``},
+		{" 5", 4, 0, 404, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			comic.servePage(rec, httptest.NewRequest(`GET`, `/comic/1/`, nil), tt.page, tt.width)
+			if rec.Code != tt.wantCode {
+				t.Errorf("servePage() status = %v, want %v", rec.Code, tt.wantCode)
+			}
+			if (0 < len(tt.wantType)) && (rec.Header().Get(`Content-Type`) != tt.wantType) {
+				t.Errorf("servePage() type = %v, want %v", rec.Header().Get(`Content-Type`), tt.wantType)
+			}
+		})
+	}
+} // Test_openComic()
+
+func Test_cbResizable(t *testing.T) {
+	small := &bytes.Buffer{}
+	if err := png.Encode(small, image.NewRGBA(image.Rect(0, 0, 400, 200))); nil != err {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		width uint
+		want  bool
+	}{
+		// TODO: Add test cases.
+		{" 1", small.Bytes(), 100, true},
+		{" 2", small.Bytes(), 400, false},
+		{" 3", pngHeader(20000, 20000), 100, false},
+		{" 4", pngHeader(4000, 3000), 100, true},
+		{" 5", []byte(`no image`), 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cbResizable(tt.data, tt.width); got != tt.want {
+				t.Errorf("cbResizable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_cbResizable()
+
+// `pngHeader()` returns the start of a PNG image claiming the size
+// `aWidth`×`aHeight` without any pixel data.
+func pngHeader(aWidth, aHeight uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, `IHDR`)
+	binary.BigEndian.PutUint32(ihdr[4:], aWidth)
+	binary.BigEndian.PutUint32(ihdr[8:], aHeight)
+	ihdr[12], ihdr[13] = 8, 6 // 8-bit RGBA
+
+	result := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	result = append(result, ihdr...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(ihdr))
+
+	return append(result, crc...)
+} // pngHeader()
+
+/* _EoF_ */
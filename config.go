@@ -30,11 +30,17 @@ type (
 		AccessLog     string // (optional) name of page access logfile
 		Addr          string // listen address ("1.2.3.4:5678")
 		AuthAll       bool   // authenticate user for all pages and documents
+		AuthLockout   int    // seconds of the first lockout after failed logins
+		AuthMaxFails  int    // number of failed logins before a lockout
+		AuthTrusted   string // networks never locked out after failed logins
 		BooksPerPage  int    // number of documents shown per web-page
 		CertKey       string // TLS certificate key
 		CertPem       string // private TLS certificate
+		ComicMaxSize  int    // maximal size (MB) of a comic's page image
 		DataDir       string // base directory of application's data
 		delWhitespace bool   // remove whitespace from generated pages
+		DeviceFile    string // JSON file with the users' device addresses
+		DownloadDays  int    // number of days to keep the download statistics
 		dump          bool   // Debug: dump this structure to `StdOut`
 		ErrorLog      string // (optional) name of page error logfile
 		GZip          bool   // send compressed data to remote browser
@@ -43,20 +49,47 @@ type (
 		LibName       string // the library's name
 		libPath       string // path to `Calibre` library
 		listen        string // IP of host to listen at
+		LogFormat     string // format of log messages (apache, json, logfmt)
+		LogLevel      string // least important log messages to write
 		LogStack      bool   // log stack trace in case of errors
+		MetricsAllow  string // networks allowed to read the metrics
+		MetricsToken  string // token allowed to read the metrics
 		PassFile      string // (optional) name of page access logfile
 		port          int    // port to listen to
 		Realm         string // host/domain to secure by BasicAuth
+		RestrictFile  string // JSON file with the users' restrictions
+		RoleFile      string // JSON file with the users' roles
 		SessionDir    string // directory for session data
 		sessionTTL    int    // session time to live
 		sidName       string // name of session ID
+		SMTPFrom      string // sender address of mails sent to devices
+		SMTPHost      string // SMTP server to send mails to devices
+		SMTPMaxSize   int    // maximal size (MB) of mailed documents
+		SMTPPassword  string // password for the SMTP server
+		SMTPPort      int    // port of the SMTP server
+		SMTPStartTLS  bool   // whether to use STARTTLS with the SMTP server
+		SMTPUser      string // username for the SMTP server
 		Theme         string // `dark` or `light` display theme
+		TokenAdd      string // username to create an API token for
+		TokenDays     int    // number of days a new API token is valid
+		TokenList     string // username whose API tokens to list
+		TokenName     string // name of a new API token
+		TokenRevoke   int    // ID of the API token to revoke
+		TokenScope    string // scope of a new API token
+		TrustProxies  string // reverse proxies whose X-Forwarded-For is used
+		UnknownDelay  int    // seconds to delay replies to unknown URLs
+		UnknownMode   string // reply to unknown URLs (notfound, redirect, tarpit)
+		UnknownTarget string // URL to redirect unknown URLs to
 		UserAdd       string // username to add to password list
 		UserCheck     string // username to check in password list
+		UserDB        string // Kaliber's own database (reading state etc.)
 		UserDelete    string // username to delete from password list
 		UserList      bool   // print out a list of current users
 		UserUpdate    string // username to update in password list
 		writeSQLTrace string // (optional) name of SQL trace logfile
+		ZipFormats    string // preferred formats for ZIP downloads
+		ZipMaxBooks   int    // maximal number of documents per ZIP download
+		ZipMaxSize    int    // maximal size (MB) of a ZIP download
 	}
 
 	// List structure for the INI values.
@@ -185,6 +218,14 @@ func readFlags() {
 		AppArgs.AccessLog = absolute(AppArgs.DataDir, AppArgs.AccessLog)
 	}
 
+	if 0 >= AppArgs.AuthLockout {
+		AppArgs.AuthLockout = 60
+	}
+
+	if 0 >= AppArgs.AuthMaxFails {
+		AppArgs.AuthMaxFails = 5
+	}
+
 	if 0 < len(AppArgs.CertKey) {
 		AppArgs.CertKey = absolute(AppArgs.DataDir, AppArgs.CertKey)
 		if fi, err := os.Stat(AppArgs.CertKey); (nil != err) || (0 >= fi.Size()) {
@@ -201,6 +242,16 @@ func readFlags() {
 
 	whitespace.UseRemoveWhitespace = AppArgs.delWhitespace
 
+	if 0 == len(AppArgs.DeviceFile) {
+		AppArgs.DeviceFile = `devices.json`
+	}
+	AppArgs.DeviceFile = absolute(AppArgs.DataDir, AppArgs.DeviceFile)
+
+	if 0 > AppArgs.DownloadDays {
+		AppArgs.DownloadDays = 0
+	}
+	db.SetDownloadRetention(AppArgs.DownloadDays)
+
 	if 0 < len(AppArgs.ErrorLog) {
 		AppArgs.ErrorLog = absolute(AppArgs.DataDir, AppArgs.ErrorLog)
 	}
@@ -253,6 +304,16 @@ func readFlags() {
 	// an empty `listen` value means: listen on all interfaces
 	AppArgs.Addr = fmt.Sprintf("%s:%d", AppArgs.listen, AppArgs.port)
 
+	switch AppArgs.LogFormat = strings.ToLower(AppArgs.LogFormat); AppArgs.LogFormat {
+	case `json`, `logfmt`:
+	default:
+		AppArgs.LogFormat = `apache`
+	}
+	AppArgs.LogLevel = strings.ToLower(AppArgs.LogLevel)
+	if _, ok := logLevels[AppArgs.LogLevel]; !ok {
+		AppArgs.LogLevel = `info`
+	}
+
 	if 0 == len(AppArgs.Realm) {
 		AppArgs.Realm = `eBooks Host`
 	}
@@ -269,11 +330,35 @@ func readFlags() {
 	}
 	sessions.SetSessionTTL(AppArgs.sessionTTL)
 
+	if 0 == len(AppArgs.SMTPFrom) {
+		AppArgs.SMTPFrom = AppArgs.SMTPUser
+	}
+	if 0 >= AppArgs.SMTPMaxSize {
+		AppArgs.SMTPMaxSize = 25
+	}
+	if 0 >= AppArgs.SMTPPort {
+		AppArgs.SMTPPort = 587
+	}
+
 	if 0 < len(AppArgs.writeSQLTrace) {
 		AppArgs.writeSQLTrace = absolute(AppArgs.DataDir, AppArgs.writeSQLTrace)
 	}
 	db.SetSQLtraceFile(AppArgs.writeSQLTrace)
 
+	if 0 == len(AppArgs.ZipFormats) {
+		AppArgs.ZipFormats = `EPUB,AZW3,MOBI,PDF`
+	}
+	AppArgs.ZipFormats = strings.ToUpper(AppArgs.ZipFormats)
+	if 0 >= AppArgs.ZipMaxBooks {
+		AppArgs.ZipMaxBooks = 100
+	}
+	if 0 >= AppArgs.ZipMaxSize {
+		AppArgs.ZipMaxSize = 1024
+	}
+	if 0 >= AppArgs.ComicMaxSize {
+		AppArgs.ComicMaxSize = 32
+	}
+
 	if 0 < len(AppArgs.Theme) {
 		AppArgs.Theme = strings.ToLower(AppArgs.Theme)
 	}
@@ -284,10 +369,40 @@ func readFlags() {
 		AppArgs.Theme = `dark`
 	}
 
+	AppArgs.UnknownMode = strings.ToLower(AppArgs.UnknownMode)
+	switch AppArgs.UnknownMode {
+	case unknownNotFound, unknownRedirect, unknownTarpit:
+		// accepted values
+	default:
+		AppArgs.UnknownMode = unknownNotFound
+	}
+	if (unknownRedirect == AppArgs.UnknownMode) && (0 == len(AppArgs.UnknownTarget)) {
+		AppArgs.UnknownMode = unknownNotFound
+	}
+	if 0 >= AppArgs.UnknownDelay {
+		AppArgs.UnknownDelay = 30
+	}
+
 	if 0 < len(AppArgs.PassFile) {
 		AppArgs.PassFile = absolute(AppArgs.DataDir, AppArgs.PassFile)
 	}
 
+	if 0 < len(AppArgs.RestrictFile) {
+		AppArgs.RestrictFile = absolute(AppArgs.DataDir, AppArgs.RestrictFile)
+	}
+	if err := db.SetRestrictionsFile(AppArgs.RestrictFile); nil != err {
+		log.Fatalf("Error: `restrictFile`: %v", err)
+	}
+
+	if 0 < len(AppArgs.RoleFile) {
+		AppArgs.RoleFile = absolute(AppArgs.DataDir, AppArgs.RoleFile)
+	}
+
+	if 0 < len(AppArgs.UserDB) {
+		AppArgs.UserDB = absolute(AppArgs.DataDir, AppArgs.UserDB)
+	}
+	db.SetUserDatabaseFile(AppArgs.UserDB)
+
 	if AppArgs.dump {
 		// Print out the arguments and terminate:
 		log.Fatalf("runtime arguments:\n%s", AppArgs.String())
@@ -318,6 +433,22 @@ func setFlags() {
 	flag.CommandLine.BoolVar(&AppArgs.AuthAll, `authAll`, AppArgs.AuthAll,
 		"<boolean> whether to require authentication for all pages ")
 
+	if AppArgs.AuthLockout, ok = iniValues.AsInt(`authLockout`); (!ok) || (0 >= AppArgs.AuthLockout) {
+		AppArgs.AuthLockout = 60
+	}
+	flag.CommandLine.IntVar(&AppArgs.AuthLockout, `authLockout`, AppArgs.AuthLockout,
+		"<seconds> duration of the first lockout after too many failed logins ")
+
+	if AppArgs.AuthMaxFails, ok = iniValues.AsInt(`authMaxFails`); (!ok) || (0 >= AppArgs.AuthMaxFails) {
+		AppArgs.AuthMaxFails = 5
+	}
+	flag.CommandLine.IntVar(&AppArgs.AuthMaxFails, `authMaxFails`, AppArgs.AuthMaxFails,
+		"<number> failed logins of a client or user before a lockout ")
+
+	AppArgs.AuthTrusted, _ = iniValues.AsString(`authTrusted`)
+	flag.CommandLine.StringVar(&AppArgs.AuthTrusted, `authTrusted`, AppArgs.AuthTrusted,
+		"<list> comma separated networks (CIDR) never locked out after failed logins\n")
+
 	if AppArgs.BooksPerPage, ok = iniValues.AsInt(`booksPerPage`); (!ok) || (0 >= AppArgs.BooksPerPage) {
 		AppArgs.BooksPerPage = 24
 	}
@@ -350,12 +481,30 @@ func setFlags() {
 	flag.CommandLine.StringVar(&AppArgs.CertPem, "certPem", AppArgs.CertPem,
 		"<fileName> the name of the TLS certificate PEM\n")
 
+	if AppArgs.ComicMaxSize, ok = iniValues.AsInt("comicMaxSize"); (!ok) || (0 >= AppArgs.ComicMaxSize) {
+		AppArgs.ComicMaxSize = 32
+	}
+	flag.CommandLine.IntVar(&AppArgs.ComicMaxSize, "comicMaxSize", AppArgs.ComicMaxSize,
+		"<megaBytes> Maximal size of a comic's page image ")
+
 	if AppArgs.delWhitespace, ok = iniValues.AsBool("delWhitespace"); !ok {
 		AppArgs.delWhitespace = true
 	}
 	flag.CommandLine.BoolVar(&AppArgs.delWhitespace, "delWhitespace", AppArgs.delWhitespace,
 		"(optional) Delete superfluous whitespace in generated pages")
 
+	if s, ok = iniValues.AsString("deviceFile"); ok && (0 < len(s)) {
+		AppArgs.DeviceFile = absolute(AppArgs.DataDir, s)
+	}
+	flag.CommandLine.StringVar(&AppArgs.DeviceFile, "deviceFile", AppArgs.DeviceFile,
+		"<fileName> JSON file with the users' device e-mail addresses\n")
+
+	if AppArgs.DownloadDays, ok = iniValues.AsInt(`downloadDays`); (!ok) || (0 > AppArgs.DownloadDays) {
+		AppArgs.DownloadDays = 365
+	}
+	flag.CommandLine.IntVar(&AppArgs.DownloadDays, `downloadDays`, AppArgs.DownloadDays,
+		"<number> days to keep the download statistics (0 = forever) ")
+
 	flag.CommandLine.BoolVar(&AppArgs.dump, `d`, AppArgs.dump, "dump")
 
 	if s, ok = iniValues.AsString("errorLog"); (ok) && (0 < len(s)) {
@@ -406,10 +555,30 @@ func setFlags() {
 	flag.CommandLine.StringVar(&AppArgs.listen, "listen", AppArgs.listen,
 		"the host's IP to listen at ")
 
+	if AppArgs.LogFormat, ok = iniValues.AsString(`logFormat`); (!ok) || (0 == len(AppArgs.LogFormat)) {
+		AppArgs.LogFormat = `apache`
+	}
+	flag.CommandLine.StringVar(&AppArgs.LogFormat, `logFormat`, AppArgs.LogFormat,
+		"<format> format of log messages: apache, json, or logfmt\n")
+
+	if AppArgs.LogLevel, ok = iniValues.AsString(`logLevel`); (!ok) || (0 == len(AppArgs.LogLevel)) {
+		AppArgs.LogLevel = `info`
+	}
+	flag.CommandLine.StringVar(&AppArgs.LogLevel, `logLevel`, AppArgs.LogLevel,
+		"<level> least important log messages to write: debug, info, warn, or error\n")
+
 	AppArgs.LogStack, _ = iniValues.AsBool("logStack")
 	flag.CommandLine.BoolVar(&AppArgs.LogStack, "logStack", AppArgs.LogStack,
 		"<boolean> Log a stack trace for recovered runtime errors ")
 
+	AppArgs.MetricsAllow, _ = iniValues.AsString(`metricsAllow`)
+	flag.CommandLine.StringVar(&AppArgs.MetricsAllow, `metricsAllow`, AppArgs.MetricsAllow,
+		"<list> comma separated networks (CIDR) allowed to read the /metrics page\n")
+
+	AppArgs.MetricsToken, _ = iniValues.AsString(`metricsToken`)
+	flag.CommandLine.StringVar(&AppArgs.MetricsToken, `metricsToken`, AppArgs.MetricsToken,
+		"<string> secret token (sent as 'Authorization: Bearer' header) allowed to read the /metrics page\n")
+
 	if AppArgs.port, ok = iniValues.AsInt("port"); (!ok) || (0 == AppArgs.port) {
 		AppArgs.port = 8383
 	}
@@ -422,6 +591,18 @@ func setFlags() {
 	flag.CommandLine.StringVar(&AppArgs.Realm, "realm", AppArgs.Realm,
 		"<hostName> Name of host/domain to secure by BasicAuth\n")
 
+	if s, ok = iniValues.AsString("restrictFile"); ok && (0 < len(s)) {
+		AppArgs.RestrictFile = absolute(AppArgs.DataDir, s)
+	}
+	flag.CommandLine.StringVar(&AppArgs.RestrictFile, "restrictFile", AppArgs.RestrictFile,
+		"<fileName> JSON file with the per-user restrictions of visible documents\n")
+
+	if s, ok = iniValues.AsString("roleFile"); ok && (0 < len(s)) {
+		AppArgs.RoleFile = absolute(AppArgs.DataDir, s)
+	}
+	flag.CommandLine.StringVar(&AppArgs.RoleFile, "roleFile", AppArgs.RoleFile,
+		"<fileName> JSON file with the users' roles (admin, reader, viewer, guest)\n")
+
 	if AppArgs.sessionTTL, ok = iniValues.AsInt("sessionTTL"); (!ok) || (0 == AppArgs.sessionTTL) {
 		AppArgs.sessionTTL = 1200
 	}
@@ -434,12 +615,52 @@ func setFlags() {
 	flag.CommandLine.StringVar(&AppArgs.sidName, "sidName", AppArgs.sidName,
 		"<name> The name of the session ID to use\n")
 
+	AppArgs.SMTPFrom, _ = iniValues.AsString("smtpFrom")
+	flag.CommandLine.StringVar(&AppArgs.SMTPFrom, "smtpFrom", AppArgs.SMTPFrom,
+		"<address> Sender address of mails sent to devices\n")
+
+	AppArgs.SMTPHost, _ = iniValues.AsString("smtpHost")
+	flag.CommandLine.StringVar(&AppArgs.SMTPHost, "smtpHost", AppArgs.SMTPHost,
+		"<hostName> SMTP server to send documents to devices (empty: disabled)\n")
+
+	if AppArgs.SMTPMaxSize, ok = iniValues.AsInt("smtpMaxSize"); (!ok) || (0 >= AppArgs.SMTPMaxSize) {
+		AppArgs.SMTPMaxSize = 25
+	}
+	flag.CommandLine.IntVar(&AppArgs.SMTPMaxSize, "smtpMaxSize", AppArgs.SMTPMaxSize,
+		"<megaBytes> Maximal size of documents sent by mail ")
+
+	AppArgs.SMTPPassword, _ = iniValues.AsString("smtpPassword")
+	flag.CommandLine.StringVar(&AppArgs.SMTPPassword, "smtpPassword", AppArgs.SMTPPassword,
+		"<password> Password for the SMTP server\n")
+
+	if AppArgs.SMTPPort, ok = iniValues.AsInt("smtpPort"); (!ok) || (0 >= AppArgs.SMTPPort) {
+		AppArgs.SMTPPort = 587
+	}
+	flag.CommandLine.IntVar(&AppArgs.SMTPPort, "smtpPort", AppArgs.SMTPPort,
+		"<portNumber> Port of the SMTP server ")
+
+	if AppArgs.SMTPStartTLS, ok = iniValues.AsBool("smtpStartTLS"); !ok {
+		AppArgs.SMTPStartTLS = true
+	}
+	flag.CommandLine.BoolVar(&AppArgs.SMTPStartTLS, "smtpStartTLS", AppArgs.SMTPStartTLS,
+		"<boolean> Whether to use STARTTLS with the SMTP server ")
+
+	AppArgs.SMTPUser, _ = iniValues.AsString("smtpUser")
+	flag.CommandLine.StringVar(&AppArgs.SMTPUser, "smtpUser", AppArgs.SMTPUser,
+		"<userName> Username for the SMTP server\n")
+
 	if s, ok = iniValues.AsString("sqlTrace"); ok && (0 < len(s)) {
 		AppArgs.writeSQLTrace = absolute(AppArgs.DataDir, s)
 	}
 	flag.CommandLine.StringVar(&AppArgs.writeSQLTrace, "sqlTrace", AppArgs.writeSQLTrace,
 		"<filename> Name of the SQL logfile to write to\n")
 
+	if s, ok = iniValues.AsString("userDB"); ok && (0 < len(s)) {
+		AppArgs.UserDB = absolute(AppArgs.DataDir, s)
+	}
+	flag.CommandLine.StringVar(&AppArgs.UserDB, "userDB", AppArgs.UserDB,
+		"<fileName> Database storing the users' reading state, bookmarks, shelves, API tokens, and download statistics\n")
+
 	if AppArgs.Theme, _ = iniValues.AsString("theme"); 0 < len(AppArgs.Theme) {
 		AppArgs.Theme = strings.ToLower(AppArgs.Theme)
 	}
@@ -451,6 +672,26 @@ func setFlags() {
 	flag.CommandLine.StringVar(&AppArgs.Theme, "theme", AppArgs.Theme,
 		"<name> The display theme to use ('light' or 'dark')\n")
 
+	AppArgs.TrustProxies, _ = iniValues.AsString(`trustedProxies`)
+	flag.CommandLine.StringVar(&AppArgs.TrustProxies, `trustedProxies`, AppArgs.TrustProxies,
+		"<list> comma separated reverse proxies (CIDR) whose X-Forwarded-For header is used\n")
+
+	if AppArgs.UnknownDelay, ok = iniValues.AsInt("unknownDelay"); (!ok) || (0 >= AppArgs.UnknownDelay) {
+		AppArgs.UnknownDelay = 30
+	}
+	flag.CommandLine.IntVar(&AppArgs.UnknownDelay, "unknownDelay", AppArgs.UnknownDelay,
+		"<seconds> Delay of the replies to unknown URLs in 'tarpit' mode ")
+
+	if AppArgs.UnknownMode, ok = iniValues.AsString("unknownMode"); (!ok) || (0 == len(AppArgs.UnknownMode)) {
+		AppArgs.UnknownMode = unknownNotFound
+	}
+	flag.CommandLine.StringVar(&AppArgs.UnknownMode, "unknownMode", AppArgs.UnknownMode,
+		"<mode> Reply to unknown URLs: 'notfound', 'redirect', or 'tarpit'\n")
+
+	AppArgs.UnknownTarget, _ = iniValues.AsString("unknownTarget")
+	flag.CommandLine.StringVar(&AppArgs.UnknownTarget, "unknownTarget", AppArgs.UnknownTarget,
+		"<URL> Target of the redirects of unknown URLs in 'redirect' mode\n")
+
 	flag.CommandLine.StringVar(&AppArgs.UserAdd, "ua", AppArgs.UserAdd,
 		"<userName> User add: add a username to the password file")
 
@@ -471,10 +712,49 @@ func setFlags() {
 
 	flag.CommandLine.StringVar(&AppArgs.UserUpdate, "uu", AppArgs.UserUpdate,
 		"<userName> User update: update a username in the password file")
+
+	flag.CommandLine.StringVar(&AppArgs.TokenAdd, "ta", AppArgs.TokenAdd,
+		"<userName> Token add: create an API token for a user (see -te, -tn, -ts)")
+
+	flag.CommandLine.IntVar(&AppArgs.TokenDays, "te", AppArgs.TokenDays,
+		"<days> Token expiry: number of days a new API token is valid (0: no expiry)")
+
+	flag.CommandLine.StringVar(&AppArgs.TokenList, "tl", AppArgs.TokenList,
+		"<userName> Token list: show the API tokens of a user ('*' for all users)")
+
+	flag.CommandLine.StringVar(&AppArgs.TokenName, "tn", AppArgs.TokenName,
+		"<name> Token name: a name identifying a new API token (e.g. the client app)")
+
+	flag.CommandLine.IntVar(&AppArgs.TokenRevoke, "tr", AppArgs.TokenRevoke,
+		"<tokenID> Token revoke: remove an API token (see -tl)")
+
+	AppArgs.TokenScope = db.TokenScopeCatalog
+	flag.CommandLine.StringVar(&AppArgs.TokenScope, "ts", AppArgs.TokenScope,
+		"<scope> Token scope: 'catalog' (read-only) or 'download'\n")
+
+	AppArgs.ZipFormats, _ = iniValues.AsString("zipFormats")
+	flag.CommandLine.StringVar(&AppArgs.ZipFormats, "zipFormats", AppArgs.ZipFormats,
+		"<list> Comma separated formats to use for ZIP downloads by preference\n")
+
+	if AppArgs.ZipMaxBooks, ok = iniValues.AsInt("zipMaxBooks"); (!ok) || (0 >= AppArgs.ZipMaxBooks) {
+		AppArgs.ZipMaxBooks = 100
+	}
+	flag.CommandLine.IntVar(&AppArgs.ZipMaxBooks, "zipMaxBooks", AppArgs.ZipMaxBooks,
+		"<number> Maximal number of documents per ZIP download ")
+
+	if AppArgs.ZipMaxSize, ok = iniValues.AsInt("zipMaxSize"); (!ok) || (0 >= AppArgs.ZipMaxSize) {
+		AppArgs.ZipMaxSize = 1024
+	}
+	flag.CommandLine.IntVar(&AppArgs.ZipMaxSize, "zipMaxSize", AppArgs.ZipMaxSize,
+		"<megaBytes> Maximal size of a ZIP download ")
 } // setFlags()
 
 // ShowHelp lists the commandline options to `Stderr`.
 func ShowHelp() {
+	if nil == flag.CommandLine {
+		// The flags are freed after parsing (see `InitConfig()`).
+		return
+	}
 	fmt.Fprintf(os.Stderr, "\n  Usage: %s [OPTIONS]\n\n", os.Args[0])
 	flag.CommandLine.PrintDefaults()
 	fmt.Fprintln(os.Stderr, "\n  Most options can be set in an INI file to keep the command-line short ;-)")
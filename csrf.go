@@ -0,0 +1,56 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+ * This file provides the protection against cross-site request
+ * forgery (CSRF).
+ *
+ * Browsers attach the BasicAuth credentials and the session cookie
+ * to form posts sent by any other site as well; so all POST requests
+ * are refused unless their `Origin` (or, if missing, `Referer`)
+ * header names this server's host.
+ * Requests without both headers are not sent by a browser's form
+ * and are accepted.
+ */
+
+// `sameOrigin()` returns whether `aRequest` was sent by one of this
+// server's own pages.
+//
+//	`aRequest` The HTTP request received by the server.
+func sameOrigin(aRequest *http.Request) bool {
+	origin := aRequest.Header.Get(`Origin`)
+	if 0 == len(origin) {
+		if origin = aRequest.Header.Get(`Referer`); 0 == len(origin) {
+			return true
+		}
+	}
+	ou, err := url.Parse(origin)
+	if (nil != err) || (0 == len(ou.Host)) {
+		return false // e.g. `Origin: null`
+	}
+	if strings.EqualFold(ou.Host, aRequest.Host) {
+		return true
+	}
+	// Behind a reverse proxy (browsers can't set this header for
+	// cross-site form posts):
+	if fh := aRequest.Header.Get(`X-Forwarded-Host`); 0 < len(fh) {
+		return strings.EqualFold(ou.Host, strings.TrimSpace(strings.Split(fh, `,`)[0]))
+	}
+
+	return false
+} // sameOrigin()
+
+/* _EoF_ */
@@ -0,0 +1,55 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_sameOrigin(t *testing.T) {
+	tests := []struct {
+		name      string
+		origin    string
+		referer   string
+		forwarded string
+		want      bool
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, ``, ``, true},
+		{" 2", `http://books.example`, ``, ``, true},
+		{" 3", `https://BOOKS.example`, ``, ``, true},
+		{" 4", `https://evil.example`, ``, ``, false},
+		{" 5", `null`, ``, ``, false},
+		{" 6", ``, `http://books.example/doc/1/doc.html`, ``, true},
+		{" 7", ``, `https://evil.example/books.example`, ``, false},
+		{" 8", `https://evil.example`, `http://books.example/`, ``, false},
+		{" 9", `https://library.example`, ``, `library.example, proxy`, true},
+		{"10", `https://evil.example`, ``, `library.example`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(`POST`, `http://books.example/shelf/1`, nil)
+			if 0 < len(tt.origin) {
+				r.Header.Set(`Origin`, tt.origin)
+			}
+			if 0 < len(tt.referer) {
+				r.Header.Set(`Referer`, tt.referer)
+			}
+			if 0 < len(tt.forwarded) {
+				r.Header.Set(`X-Forwarded-Host`, tt.forwarded)
+			}
+			if got := sameOrigin(r); got != tt.want {
+				t.Errorf("sameOrigin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_sameOrigin()
+
+/* _EoF_ */
@@ -0,0 +1,279 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/*
+ * This file provides functions and methods to handle the values of
+ * user-defined (i.e. custom) columns.
+ */
+
+type (
+	// TCustomField holds the value(s) of a single user-defined column
+	// of a certain document.
+	TCustomField struct {
+		Label    string      `json:"label"`    // the column's lookup name (without `#`)
+		Name     string      `json:"name"`     // the column's display name
+		Datatype string      `json:"datatype"` // Calibre's data type (e.g. `bool`, `text`)
+		Values   TEntityList `json:"values"`   // the document's value(s)
+	}
+
+	// TCustomFieldList is a list of `TCustomField` instances.
+	TCustomFieldList []TCustomField
+)
+
+// IsHTML returns whether the field's values contain HTML markup.
+func (cf *TCustomField) IsHTML() bool {
+	return `comments` == cf.Datatype
+} // IsHTML()
+
+var (
+	// Data types whose values are stored in a separate table
+	// linked to the documents.
+	dbNormalizedTypes = map[string]bool{
+		`enumeration`: true,
+		`rating`:      true,
+		`series`:      true,
+		`text`:        true,
+	}
+)
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `customBool()` returns the database value of the boolean `aTerm`
+// (i.e. `1` for `true` or `yes`, `0` for `false` or `no`).
+//
+// Other values are returned unchanged.
+//
+//	`aTerm` The search term to convert.
+func customBool(aTerm string) string {
+	switch strings.ToLower(strings.TrimSpace(aTerm)) {
+	case `1`, `true`, `yes`:
+		return `1`
+	case `0`, `false`, `no`:
+		return `0`
+	}
+
+	return aTerm
+} // customBool()
+
+// `customFieldsSQL()` returns the SQL to select the values of all
+// `aColumns` of the document identified by `aID`.
+//
+// Each result row holds the column's index in `aColumns`, the value's
+// row ID, the value itself and an optional series index.
+//
+//	`aColumns` The user-defined columns to lookup.
+//	`aID` The ID of the document to lookup.
+func customFieldsSQL(aColumns *TCustomColumnList, aID TID) string {
+	if nil == aColumns {
+		return ``
+	}
+	parts := make([]string, 0, len(*aColumns))
+	for idx, cc := range *aColumns {
+		switch {
+		case `composite` == cc.Datatype:
+			continue // computed by Calibre, there's no table
+
+		case `series` == cc.Datatype:
+			parts = append(parts, fmt.Sprintf(
+				`SELECT %d, ct.id, CAST(ct.value AS TEXT), IFNULL(lct.extra, 0) FROM books_custom_column_%d_link lct JOIN custom_column_%d ct ON(lct.value = ct.id) WHERE (lct.book = %d)`,
+				idx, cc.ID, cc.ID, aID))
+
+		case cc.Normalized:
+			parts = append(parts, fmt.Sprintf(
+				`SELECT %d, ct.id, CAST(ct.value AS TEXT), 0 FROM books_custom_column_%d_link lct JOIN custom_column_%d ct ON(lct.value = ct.id) WHERE (lct.book = %d)`,
+				idx, cc.ID, cc.ID, aID))
+
+		default:
+			parts = append(parts, fmt.Sprintf(
+				`SELECT %d, ct.id, CAST(ct.value AS TEXT), 0 FROM custom_column_%d ct WHERE (ct.book = %d)`,
+				idx, cc.ID, aID))
+		}
+	}
+	if 0 == len(parts) {
+		return ``
+	}
+
+	return strings.Join(parts, ` UNION ALL `) + ` ORDER BY 1, 3`
+} // customFieldsSQL()
+
+// `customValue()` returns the display text of a custom column's value.
+//
+//	`aDatatype` Calibre's data type of the column.
+//	`aValue` The raw value as stored in the database.
+//	`aExtra` The series index (for `series` columns only).
+func customValue(aDatatype, aValue string, aExtra float64) string {
+	switch aDatatype {
+	case `bool`:
+		if `1` == aValue {
+			return `true`
+		}
+		return `false`
+
+	case `datetime`:
+		if 10 < len(aValue) {
+			return aValue[:10] // YYYY-MM-DD
+		}
+
+	case `float`:
+		if f, err := strconv.ParseFloat(aValue, 64); nil == err {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+
+	case `rating`:
+		if r, err := strconv.Atoi(aValue); nil == err {
+			result := strings.Repeat(`★`, r>>1)
+			if 0 != r&1 {
+				result += `½`
+			}
+			return result
+		}
+
+	case `series`:
+		return aValue + ` [` + strconv.FormatFloat(aExtra, 'f', -1, 64) + `]`
+	}
+
+	return aValue
+} // customValue()
+
+// `customURL()` returns the URL to search for documents whose column
+// `aLabel` matches `aValue`.
+//
+// Since the search expressions use double quotes values containing
+// a double quote are not linked.
+//
+//	`aLabel` The column's lookup name (without `#`).
+//	`aValue` The raw value to search for.
+func customURL(aLabel, aValue string) string {
+	if strings.Contains(aValue, `"`) {
+		return ``
+	}
+
+	return `/search?q=` + url.QueryEscape(`#`+aLabel+`:"=`+aValue+`"`)
+} // customURL()
+
+// `orderByCustom()` returns an ORDER_BY clause to sort by the
+// user-defined column `aLabel`.
+//
+// The values are compared according to the column's data type;
+// documents without a value are always sorted last.
+// If there's no column `aLabel` the result is sorted by acquisition.
+//
+//	`aLabel` The column's lookup name.
+//	`aDescending` If `true` the query result is sorted in DESCending order.
+func orderByCustom(aLabel string, aDescending bool) string {
+	cc := CustomColumn(aLabel)
+	if (nil == cc) || (`composite` == cc.Datatype) {
+		return orderBy(qoSortByAcquisition, aDescending)
+	}
+	desc := `` // ` ASC ` is default
+	if aDescending {
+		desc = ` DESC`
+	}
+
+	var value, extra string
+	if cc.Normalized {
+		value = fmt.Sprintf(`(SELECT MIN(ct.value) FROM books_custom_column_%d_link lct JOIN custom_column_%d ct ON(lct.value = ct.id) WHERE (lct.book = b.id))`, cc.ID, cc.ID)
+	} else {
+		value = fmt.Sprintf(`(SELECT ct.value FROM custom_column_%d ct WHERE (ct.book = b.id))`, cc.ID)
+	}
+	result := value + ` IS NULL, `
+	switch cc.Datatype {
+	case `comments`, `enumeration`, `text`:
+		result += value + ` COLLATE NOCASE` + desc
+	case `datetime`:
+		result += `julianday(` + value + `)` + desc
+	case `series`:
+		extra = fmt.Sprintf(`(SELECT MIN(lct.extra) FROM books_custom_column_%d_link lct WHERE (lct.book = b.id))`, cc.ID)
+		result += value + ` COLLATE NOCASE` + desc + `, ` + extra + desc
+	default: // `bool`, `float`, `int`, `rating`
+		result += value + desc
+	}
+
+	return ` ORDER BY ` + result + `, b.author_sort, b.sort `
+} // orderByCustom()
+
+// `queryCustomFields()` returns the values of all visible user-defined
+// columns of the document identified by `aID`.
+//
+// If there are no (visible) custom columns or the document doesn't
+// have any custom values the method returns `nil`.
+//
+//	`aContext` The current web request's context.
+//	`aID` The ID of the document to lookup.
+func (db *TDataBase) queryCustomFields(aContext context.Context, aID TID) *TCustomFieldList {
+	columns, err := db.QueryCustomColumns(aContext)
+	if (nil != err) || (0 == len(*columns)) {
+		return nil
+	}
+	visibles := make(TCustomColumnList, 0, len(*columns))
+	for _, cc := range *columns {
+		if visible, _ := BookFieldVisible(`#` + cc.Label); visible {
+			visibles = append(visibles, cc)
+		}
+	}
+	query := customFieldsSQL(&visibles, aID)
+	if 0 == len(query) {
+		return nil
+	}
+
+	var rows *sql.Rows
+	if rows, err = db.query(aContext, query); nil != err {
+		return nil
+	}
+	defer rows.Close()
+
+	result := make(TCustomFieldList, 0, len(visibles))
+	last := -1
+	for rows.Next() {
+		var (
+			extra    float64
+			idx, id  int
+			rawValue string
+		)
+		if err = rows.Scan(&idx, &id, &rawValue, &extra); (nil != err) ||
+			(0 > idx) || (len(visibles) <= idx) {
+			continue
+		}
+		cc := visibles[idx]
+		if idx != last {
+			result = append(result, TCustomField{
+				Label:    cc.Label,
+				Name:     cc.Name,
+				Datatype: cc.Datatype,
+			})
+			last = idx
+		}
+		ent := TEntity{
+			ID:   id,
+			Name: customValue(cc.Datatype, rawValue, extra),
+		}
+		if cc.Normalized {
+			ent.URL = customURL(cc.Label, rawValue)
+		}
+		field := &result[len(result)-1]
+		field.Values = append(field.Values, ent)
+	}
+	if 0 == len(result) {
+		return nil
+	}
+
+	return &result
+} // queryCustomFields()
+
+/* _EoF_ */
@@ -0,0 +1,198 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_customBool(t *testing.T) {
+	tests := []struct {
+		name  string
+		aTerm string
+		want  string
+	}{
+		// TODO: Add test cases.
+		{" 1", `true`, `1`},
+		{" 2", `Yes`, `1`},
+		{" 3", `false`, `0`},
+		{" 4", `no`, `0`},
+		{" 5", `maybe`, `maybe`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := customBool(tt.aTerm); got != tt.want {
+				t.Errorf("customBool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_customBool()
+
+func Test_customFieldsSQL(t *testing.T) {
+	cl1 := &TCustomColumnList{
+		{ID: 1, Label: `read`, Name: `Read`, Datatype: `bool`},
+		{ID: 2, Label: `genre`, Name: `Genre`, Datatype: `text`, Normalized: true},
+		{ID: 3, Label: `saga`, Name: `Saga`, Datatype: `series`, Normalized: true},
+	}
+	cl2 := &TCustomColumnList{
+		{ID: 6, Label: `calc`, Name: `Calc`, Datatype: `composite`},
+	}
+	type args struct {
+		aColumns *TCustomColumnList
+		aID      TID
+	}
+	tests := []struct {
+		name     string
+		args     args
+		contains []string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{nil, 1}, nil},
+		{" 2", args{cl2, 1}, nil},
+		{" 3", args{cl1, 7}, []string{
+			`SELECT 0, ct.id, CAST(ct.value AS TEXT), 0 FROM custom_column_1 ct WHERE (ct.book = 7)`,
+			`SELECT 1, ct.id, CAST(ct.value AS TEXT), 0 FROM books_custom_column_2_link lct JOIN custom_column_2 ct ON(lct.value = ct.id) WHERE (lct.book = 7)`,
+			`IFNULL(lct.extra, 0) FROM books_custom_column_3_link`,
+			` UNION ALL `,
+			` ORDER BY 1, 3`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := customFieldsSQL(tt.args.aColumns, tt.args.aID)
+			if (0 == len(tt.contains)) && (0 < len(got)) {
+				t.Errorf("customFieldsSQL() = %v, want ``", got)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("customFieldsSQL() = %v,\nwant %v", got, want)
+				}
+			}
+		})
+	}
+} // Test_customFieldsSQL()
+
+func Test_customURL(t *testing.T) {
+	type args struct {
+		aLabel string
+		aValue string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`genre`, `Humour`}, `/search?q=%23genre%3A%22%3DHumour%22`},
+		{" 2", args{`genre`, `Sci & Fi`}, `/search?q=%23genre%3A%22%3DSci+%26+Fi%22`},
+		{" 3", args{`genre`, `"quoted"`}, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := customURL(tt.args.aLabel, tt.args.aValue); got != tt.want {
+				t.Errorf("customURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_customURL()
+
+func Test_customValue(t *testing.T) {
+	type args struct {
+		aDatatype string
+		aValue    string
+		aExtra    float64
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`bool`, `1`, 0}, `true`},
+		{" 2", args{`bool`, `0`, 0}, `false`},
+		{" 3", args{`datetime`, `2022-03-01 00:00:00+00:00`, 0}, `2022-03-01`},
+		{" 4", args{`float`, `2.50`, 0}, `2.5`},
+		{" 5", args{`int`, `42`, 0}, `42`},
+		{" 6", args{`rating`, `7`, 0}, `★★★½`},
+		{" 7", args{`series`, `Rincewind`, 2}, `Rincewind [2]`},
+		{" 8", args{`text`, `Humour`, 0}, `Humour`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := customValue(tt.args.aDatatype, tt.args.aValue, tt.args.aExtra); got != tt.want {
+				t.Errorf("customValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_customValue()
+
+func Test_orderByCustom(t *testing.T) {
+	SetCalibreLibraryPath("/var/opt/Calibre")
+	type args struct {
+		aLabel      string
+		aDescending bool
+	}
+	tests := []struct {
+		name     string
+		args     args
+		contains []string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`unknown`, true}, []string{orderBy(qoSortByAcquisition, true)}},
+		{" 2", args{`priority`, false}, []string{
+			` ORDER BY (SELECT ct.value FROM custom_column_3 ct WHERE (ct.book = b.id)) IS NULL, (SELECT ct.value FROM custom_column_3 ct WHERE (ct.book = b.id)), b.author_sort`,
+		}},
+		{" 3", args{`genre`, true}, []string{
+			`JOIN custom_column_2 ct ON(lct.value = ct.id)`,
+			` COLLATE NOCASE DESC, b.author_sort`,
+		}},
+		{" 4", args{`#finished`, true}, []string{`julianday((SELECT ct.value FROM custom_column_5 ct`, `)) DESC, `}},
+		{" 5", args{`saga`, false}, []string{`(SELECT MIN(lct.extra) FROM books_custom_column_4_link lct`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := orderByCustom(tt.args.aLabel, tt.args.aDescending)
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("orderByCustom() = %v,\nwant %v", got, want)
+				}
+			}
+		})
+	}
+} // Test_orderByCustom()
+
+func TestTDataBase_queryCustomFields(t *testing.T) {
+	ctx := context.TODO()
+	dbHandle := openDBforTesting(ctx)
+
+	type args struct {
+		aContext context.Context
+		aID      TID
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool // result != nil
+	}{
+		// TODO: Add test cases.
+		{" 1", args{ctx, 1}, true},
+		{" 2", args{ctx, 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dbHandle.queryCustomFields(tt.args.aContext, tt.args.aID); (nil != got) != tt.want {
+				t.Errorf("TDataBase.queryCustomFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // TestTDataBase_queryCustomFields()
+
+/* _EoF_ */
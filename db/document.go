@@ -9,6 +9,7 @@ package db
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -28,9 +29,10 @@ type (
 
 	// TEntity is a basic entity structure.
 	TEntity struct {
-		ID   TID    // database row ID
-		Name string // name of the column/field
-		URL  string // local URL to access this entity
+		ID    TID    `json:"id"`              // database row ID
+		Name  string `json:"name"`            // name of the column/field
+		URL   string `json:"url,omitempty"`   // local URL to access this entity
+		Count int    `json:"count,omitempty"` // number of documents (if applicable)
 	}
 
 	// TEntityList is a list of entities
@@ -71,6 +73,7 @@ type (
 		authors      *tAuthorList
 		authorSort   string
 		comments     string
+		customs      *TCustomFieldList
 		flags        int
 		formats      *tFormatList
 		hasCover     bool
@@ -94,6 +97,11 @@ type (
 	}
 )
 
+// Acquisition returns the time the document was added to the library.
+func (doc *TDocument) Acquisition() time.Time {
+	return doc.acquisition
+} // Acquisition()
+
 // AuthorList returns a CSV list of the document's author(s).
 func (doc *TDocument) AuthorList() string {
 	if nil == doc.authors {
@@ -176,11 +184,32 @@ func (doc *TDocument) CoverFile() (string, error) {
 	return doc.CoverAbs(false)
 } // CoverFile()
 
+// CustomFields returns the values of the document's user-defined
+// columns (if any).
+func (doc *TDocument) CustomFields() *TCustomFieldList {
+	return doc.customs
+} // CustomFields()
+
 // DocLink returns a link to this document's page.
 func (doc *TDocument) DocLink() string {
 	return fmt.Sprintf("/doc/%d/doc.html", doc.ID)
 } // DocLink()
 
+// DownloadName returns the filename to use when downloading the
+// document's `aFormat` (i.e. `Author_-_Title.ext`).
+//
+//	`aFormat` The document format to name.
+func (doc *TDocument) DownloadName(aFormat string) string {
+	al := doc.AuthorList()
+	if 0 < len(al) {
+		al += `_-_`
+	}
+
+	return strings.Replace(
+		strings.Replace(al+doc.Title, ` `, `_`, -1), `/`, `-`, -1) +
+		`.` + strings.ToLower(aFormat)
+} // DownloadName()
+
 // Filename returns the path-/filename of the document's `aFormat`.
 func (doc *TDocument) Filename(aFormat string) string {
 	list := *doc.filenames()
@@ -222,18 +251,11 @@ func (doc *TDocument) Files() *TEntityList {
 			continue // we ignore this format
 		}
 
-		// Build the filename to download:
-		al := doc.AuthorList()
-		if 0 < len(al) {
-			al += `_-_`
-		}
-		fName := url.PathEscape(
-			strings.Replace(
-				strings.Replace(al+doc.Title, ` `, `_`, -1), `/`, `-`, -1)) + `.` + strings.ToLower(format.Name)
 		ent := TEntity{
 			ID:   format.ID,
 			Name: format.Name,
-			URL:  fmt.Sprintf("/file/%d/%s/%s", doc.ID, format.Name, fName),
+			URL: fmt.Sprintf("/file/%d/%s/%s", doc.ID, format.Name,
+				url.PathEscape(doc.DownloadName(format.Name))),
 		}
 		result = append(result, ent)
 	}
@@ -337,6 +359,76 @@ func (doc *TDocument) LastModified() string {
 	return doc.lastModified.Format(time.RFC1123)
 } // LastModified()
 
+// MarshalJSON returns the JSON encoding of the document,
+// implementing the `json.Marshaler` interface.
+func (doc *TDocument) MarshalJSON() ([]byte, error) {
+	var (
+		pubdate     string
+		seriesIndex float32
+	)
+	if y := doc.pubdate.Year(); 101 < y {
+		pubdate = doc.pubdate.Format("2006-01-02")
+	}
+	if nil != doc.series {
+		seriesIndex = doc.seriesindex
+	}
+
+	return json.Marshal(struct {
+		ID           TID               `json:"id"`
+		Title        string            `json:"title"`
+		Authors      *TEntityList      `json:"authors,omitempty"`
+		Acquisition  string            `json:"acquisition"`
+		Comment      string            `json:"comment,omitempty"`
+		Cover        string            `json:"cover,omitempty"`
+		Custom       *TCustomFieldList `json:"custom,omitempty"`
+		DocLink      string            `json:"link"`
+		Files        *TEntityList      `json:"files,omitempty"`
+		Identifiers  *TEntityList      `json:"identifiers,omitempty"`
+		ISBN         string            `json:"isbn,omitempty"`
+		Languages    *TEntityList      `json:"languages,omitempty"`
+		LastModified string            `json:"lastModified"`
+		Pages        int               `json:"pages,omitempty"`
+		PubDate      string            `json:"pubdate,omitempty"`
+		Publisher    *TEntity          `json:"publisher,omitempty"`
+		Rating       int               `json:"rating,omitempty"`
+		Series       *TEntity          `json:"series,omitempty"`
+		SeriesIndex  float32           `json:"seriesIndex,omitempty"`
+		Size         int64             `json:"size,omitempty"`
+		Tags         *TEntityList      `json:"tags,omitempty"`
+		Thumb        string            `json:"thumb"`
+		UUID         string            `json:"uuid,omitempty"`
+	}{
+		ID:           doc.ID,
+		Title:        doc.Title,
+		Authors:      doc.Authors(),
+		Acquisition:  doc.acquisition.Format(time.RFC3339),
+		Comment:      doc.comments,
+		Cover:        doc.Cover(),
+		Custom:       doc.customs,
+		DocLink:      doc.DocLink(),
+		Files:        doc.Files(),
+		Identifiers:  doc.Identifiers(),
+		ISBN:         doc.ISBN,
+		Languages:    doc.Languages(),
+		LastModified: doc.lastModified.Format(time.RFC3339),
+		Pages:        doc.Pages,
+		PubDate:      pubdate,
+		Publisher:    doc.Publisher(),
+		Rating:       doc.Rating,
+		Series:       doc.Series(),
+		SeriesIndex:  seriesIndex,
+		Size:         doc.Size,
+		Tags:         doc.Tags(),
+		Thumb:        doc.Thumb(),
+		UUID:         doc.uuid,
+	})
+} // MarshalJSON()
+
+// ModTime returns the last-modified time of the document.
+func (doc *TDocument) ModTime() time.Time {
+	return doc.lastModified
+} // ModTime()
+
 // PubDate returns the document's formatted publication date.
 func (doc *TDocument) PubDate() string {
 	y, m, _ := doc.pubdate.Date()
@@ -427,6 +519,11 @@ func (doc *TDocument) Timestamp() string {
 	return doc.acquisition.Format("2006-01-02 15:04:05")
 } // Timestamp()
 
+// UUID returns the document's universally unique identifier.
+func (doc *TDocument) UUID() string {
+	return doc.uuid
+} // UUID()
+
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
 
 // NewDocument returns a new `TDocument` instance.
@@ -105,6 +105,42 @@ func TestTDocument_coverAbs(t *testing.T) {
 	}
 } // TestTDocument_coverAbs()
 
+func TestTDocument_DownloadName(t *testing.T) {
+	d1 := TDocument{
+		Title: "this is the document's title",
+	}
+	d2 := TDocument{
+		authors: &tAuthorList{
+			TEntity{
+				ID:   1,
+				Name: "Spiegel",
+			},
+		},
+		Title: "Der Spiegel (2019-06-01) 23/2019",
+	}
+	type args struct {
+		aFormat string
+	}
+	tests := []struct {
+		name   string
+		fields TDocument
+		args   args
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", d1, args{"PDF"}, "this_is_the_document's_title.pdf"},
+		{" 2", d2, args{"EPUB"}, "Spiegel_-_Der_Spiegel_(2019-06-01)_23-2019.epub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &tt.fields
+			if got := doc.DownloadName(tt.args.aFormat); got != tt.want {
+				t.Errorf("TDocument.DownloadName() = '%s',\nwant '%s'", got, tt.want)
+			}
+		})
+	}
+} // TestTDocument_DownloadName()
+
 func TestTDocument_Filename(t *testing.T) {
 	SetCalibreLibraryPath("/var/opt/Calibre/")
 	d1 := TDocument{
@@ -255,3 +291,52 @@ func TestTDocument_Files(t *testing.T) {
 		})
 	}
 } // TestTDocument_Files()
+
+func TestTDocument_MarshalJSON(t *testing.T) {
+	d1 := TDocument{
+		ID:    1,
+		Title: "Title",
+	}
+	w1 := `{"id":1,"title":"Title","acquisition":"0001-01-01T00:00:00Z","cover":"/cover/1/cover.gif","link":"/doc/1/doc.html","lastModified":"0001-01-01T00:00:00Z","thumb":"/thumb/1/cover.jpg"}`
+	d2 := TDocument{
+		ID: 2,
+		series: &tSeries{
+			ID:   3,
+			Name: "Series",
+		},
+		seriesindex: 1.5,
+		Title:       "Title",
+		uuid:        "abc",
+	}
+	w2 := `{"id":2,"title":"Title","acquisition":"0001-01-01T00:00:00Z","cover":"/cover/2/cover.gif","link":"/doc/2/doc.html","lastModified":"0001-01-01T00:00:00Z","series":{"id":3,"name":"Series","url":"/series/3/Series"},"seriesIndex":1.5,"thumb":"/thumb/2/cover.jpg","uuid":"abc"}`
+	d3 := TDocument{
+		ID:          3,
+		seriesindex: 1,
+		Title:       "Title",
+	}
+	w3 := `{"id":3,"title":"Title","acquisition":"0001-01-01T00:00:00Z","cover":"/cover/3/cover.gif","link":"/doc/3/doc.html","lastModified":"0001-01-01T00:00:00Z","thumb":"/thumb/3/cover.jpg"}`
+	tests := []struct {
+		name    string
+		fields  TDocument
+		want    string
+		wantErr bool
+	}{
+		// TODO: Add test cases.
+		{" 1", d1, w1, false},
+		{" 2", d2, w2, false},
+		{" 3", d3, w3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &tt.fields
+			got, err := doc.MarshalJSON()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TDocument.MarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("TDocument.MarshalJSON() = %s,\nwant %s", got, tt.want)
+			}
+		})
+	}
+} // TestTDocument_MarshalJSON()
@@ -0,0 +1,191 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the download statistics stored in Kaliber's
+ * own database (see `userdb.go`).
+ *
+ * Every delivered document file is recorded; records older than
+ * the configured retention window are ignored and removed.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// TDownloadCount is the download statistics of a single document.
+	TDownloadCount struct {
+		Book  TID
+		Bytes int64     // total number of bytes sent
+		Count int       // number of downloads
+		Last  time.Time // the latest download
+	}
+)
+
+const (
+	// Maximal number of documents sorted by their number of downloads
+	// (see `downloadOrder()`); all others are sorted by acquisition.
+	// This keeps the ORDER_BY clause's size independent of the
+	// library's size and the retention window.
+	dlOrderMax = 500
+)
+
+var (
+	// Number of days to keep the download records (`0` == forever).
+	udbDownloadDays = 0
+)
+
+// SetDownloadRetention sets the number of days the download records
+// are kept.
+//
+// A value of `0` (or less) keeps the records forever.
+//
+//	`aDays` The number of days to keep the records.
+func SetDownloadRetention(aDays int) {
+	if 0 > aDays {
+		aDays = 0
+	}
+	udbDownloadDays = aDays
+} // SetDownloadRetention()
+
+// DownloadRetention returns the number of days the download records
+// are kept (`0` == forever).
+func DownloadRetention() int {
+	return udbDownloadDays
+} // DownloadRetention()
+
+// `downloadsSince()` returns the time of the oldest download record
+// to consider.
+func downloadsSince() time.Time {
+	if 0 == udbDownloadDays {
+		return time.Time{}
+	}
+
+	return time.Now().UTC().AddDate(0, 0, -udbDownloadDays)
+} // downloadsSince()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// AddDownload records a document file delivered to `aUser`.
+//
+// Download records outside the retention window are removed.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user (if any).
+//	`aBook` The ID of the downloaded document.
+//	`aFormat` The document's format (e.g. `EPUB`).
+//	`aBytes` The number of bytes sent.
+func (udb *TUserDB) AddDownload(aContext context.Context, aUser string, aBook TID, aFormat string, aBytes int64) error {
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`INSERT INTO downloads (book, format, user, bytes, delivered) VALUES (?, ?, ?, ?, ?)`,
+		aBook, strings.ToUpper(aFormat), aUser, aBytes, time.Now().UTC())
+	if (nil != err) || (0 == udbDownloadDays) {
+		return err
+	}
+	_, err = udb.sqlDB.ExecContext(aContext,
+		`DELETE FROM downloads WHERE (delivered < ?)`, downloadsSince())
+
+	return err
+} // AddDownload()
+
+// DownloadCount returns how often `aBook` was downloaded within the
+// retention window.
+//
+//	`aContext` The current web request's context.
+//	`aBook` The ID of the document in question.
+func (udb *TUserDB) DownloadCount(aContext context.Context, aBook TID) (int, error) {
+	var result int
+	err := udb.sqlDB.QueryRowContext(aContext,
+		`SELECT COUNT(*) FROM downloads WHERE (book = ?) AND (delivered >= ?)`,
+		aBook, downloadsSince()).Scan(&result)
+
+	return result, err
+} // DownloadCount()
+
+// Downloads returns the download statistics of the documents most
+// often downloaded within the retention window.
+//
+//	`aContext` The current web request's context.
+//	`aLimit` The maximal number of documents to return (`0` == all).
+func (udb *TUserDB) Downloads(aContext context.Context, aLimit int) ([]TDownloadCount, error) {
+	query := `SELECT book, COUNT(*) AS cnt, SUM(bytes), MAX(delivered) FROM downloads WHERE (delivered >= ?) GROUP BY book ORDER BY cnt DESC, book`
+	if 0 < aLimit {
+		query += ` LIMIT ` + strconv.Itoa(aLimit)
+	}
+	rows, err := udb.sqlDB.QueryContext(aContext, query, downloadsSince())
+	if nil != err {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []TDownloadCount
+	for rows.Next() {
+		var (
+			dc   TDownloadCount
+			last sql.NullString
+		)
+		if err = rows.Scan(&dc.Book, &dc.Count, &dc.Bytes, &last); nil != err {
+			return nil, err
+		}
+		// `MAX()` returns the plain text as stored by the driver:
+		if t, err := time.Parse(`2006-01-02 15:04:05.999999999-07:00`, last.String); nil == err {
+			dc.Last = t.Local()
+		}
+		result = append(result, dc)
+	}
+
+	return result, rows.Err()
+} // Downloads()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `downloadOrder()` returns an ORDER_BY clause to sort the documents
+// by their number of downloads.
+//
+// Only the `dlOrderMax` most downloaded documents are ranked; all
+// other documents are sorted by acquisition (after the ranked ones
+// in DESCending order).
+// Without a user database the result is sorted by acquisition only.
+//
+//	`aContext` The current web request's context.
+//	`aDescending` If `true` the query result is sorted in DESCending order.
+func downloadOrder(aContext context.Context, aDescending bool) (string, error) {
+	udb, err := OpenUserDatabase(aContext)
+	if nil != err {
+		if errNoUserDB == err {
+			return orderBy(qoSortByAcquisition, aDescending), nil
+		}
+		return ``, err
+	}
+	list, err := udb.Downloads(aContext, dlOrderMax)
+	if (nil != err) || (0 == len(list)) {
+		return orderBy(qoSortByAcquisition, aDescending), err
+	}
+	desc := `` // ` ASC ` is default
+	if aDescending {
+		desc = ` DESC`
+	}
+	var result strings.Builder
+	result.WriteString(` ORDER BY CASE b.id`)
+	for _, dc := range list {
+		result.WriteString(` WHEN ` + strconv.Itoa(int(dc.Book)) +
+			` THEN ` + strconv.Itoa(dc.Count))
+	}
+	result.WriteString(` ELSE 0 END` + desc + `, b.timestamp` + desc + `, b.author_sort `)
+
+	return result.String(), nil
+} // downloadOrder()
+
+/* _EoF_ */
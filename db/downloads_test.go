@@ -0,0 +1,110 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTUserDB_Downloads(t *testing.T) {
+	udb := openTestUserDB(t)
+	ctx := context.TODO()
+	defer SetDownloadRetention(0)
+
+	_ = udb.AddDownload(ctx, `alice`, 2, `epub`, 1000)
+	_ = udb.AddDownload(ctx, `bob`, 2, `PDF`, 3000)
+	_ = udb.AddDownload(ctx, ``, 5, `EPUB`, 500)
+	// An old record outside the retention window:
+	_, _ = udb.sqlDB.ExecContext(ctx,
+		`INSERT INTO downloads (book, format, user, bytes, delivered) VALUES (?, ?, ?, ?, ?)`,
+		5, `EPUB`, `alice`, 500, time.Now().UTC().AddDate(0, 0, -100))
+
+	if n, err := udb.DownloadCount(ctx, 5); (nil != err) || (2 != n) {
+		t.Errorf("DownloadCount(5) = %d, %v, want 2", n, err)
+	}
+	SetDownloadRetention(30)
+	if n, _ := udb.DownloadCount(ctx, 5); 1 != n {
+		t.Errorf("DownloadCount(5) = %d, want 1", n)
+	}
+	if n, _ := udb.DownloadCount(ctx, 7); 0 != n {
+		t.Errorf("DownloadCount(7) = %d, want 0", n)
+	}
+
+	list, err := udb.Downloads(ctx, 0)
+	if (nil != err) || (2 != len(list)) {
+		t.Fatalf("Downloads() = %v, %v, want 2 entries", list, err)
+	}
+	if (2 != list[0].Book) || (2 != list[0].Count) || (4000 != list[0].Bytes) || list[0].Last.IsZero() {
+		t.Errorf("Downloads()[0] = %v", list[0])
+	}
+	if list, _ = udb.Downloads(ctx, 1); 1 != len(list) {
+		t.Errorf("Downloads(1) = %v, want 1 entry", list)
+	}
+
+	// Adding a record removes those outside the retention window:
+	_ = udb.AddDownload(ctx, `alice`, 7, `MOBI`, 200)
+	var n int
+	_ = udb.sqlDB.QueryRowContext(ctx, `SELECT COUNT(*) FROM downloads`).Scan(&n)
+	if 4 != n {
+		t.Errorf("AddDownload() kept %d records, want 4", n)
+	}
+} // TestTUserDB_Downloads()
+
+func Test_downloadOrder(t *testing.T) {
+	ctx := context.TODO()
+	if got, _ := downloadOrder(ctx, true); got != orderBy(qoSortByAcquisition, true) {
+		t.Errorf("downloadOrder() = %v, want acquisition order", got)
+	}
+	udb := openTestUserDB(t)
+	if got, _ := downloadOrder(ctx, true); got != orderBy(qoSortByAcquisition, true) {
+		t.Errorf("downloadOrder() = %v, want acquisition order", got)
+	}
+	_ = udb.AddDownload(ctx, `alice`, 2, `EPUB`, 1000)
+	_ = udb.AddDownload(ctx, `alice`, 5, `EPUB`, 1000)
+	_ = udb.AddDownload(ctx, `bob`, 5, `EPUB`, 1000)
+
+	tests := []struct {
+		name string
+		desc bool
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", true, ` ORDER BY CASE b.id WHEN 5 THEN 2 WHEN 2 THEN 1 ELSE 0 END DESC, b.timestamp DESC, b.author_sort `},
+		{" 2", false, ` ORDER BY CASE b.id WHEN 5 THEN 2 WHEN 2 THEN 1 ELSE 0 END, b.timestamp, b.author_sort `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := downloadOrder(ctx, tt.desc)
+			if nil != err {
+				t.Errorf("downloadOrder() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("downloadOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The ORDER_BY clause is limited to the most downloaded documents:
+	for id := TID(10); id < 10+dlOrderMax; id++ {
+		_ = udb.AddDownload(ctx, `carol`, id, `EPUB`, 1000)
+	}
+	got, _ := downloadOrder(ctx, true)
+	if n := strings.Count(got, ` WHEN `); dlOrderMax != n {
+		t.Errorf("downloadOrder() has %d WHEN arms, want %d", n, dlOrderMax)
+	}
+	if !strings.HasPrefix(got, ` ORDER BY CASE b.id WHEN 5 THEN 2 WHEN 2 THEN 1 `) {
+		t.Errorf("downloadOrder() = %.60s…, want most downloaded first", got)
+	}
+} // Test_downloadOrder()
+
+/* _EoF_ */
@@ -0,0 +1,88 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/mwat56/apachelogger"
+)
+
+/*
+ * This file provides the logging of the package's messages.
+ *
+ * By default errors are written by `apachelogger.Err()`; an
+ * application can set its own logger by `SetLogger()` to get all
+ * messages (incl. the debug messages about each query) along with
+ * the ID of the web request they belong to (see `WithRequestID()`).
+ */
+
+type (
+	// TLogFunc is a function logging `aMessage` of `aSender` with
+	// `aLevel` (`debug`, `info`, `warn`, or `error`).
+	TLogFunc func(aContext context.Context, aLevel, aSender, aMessage string)
+
+	// `tRequestIDKey` is the context key of the request ID.
+	tRequestIDKey struct{}
+)
+
+var (
+	// The function set by `SetLogger()`.
+	dbLogger atomic.Value
+)
+
+// `logMessage()` logs `aMessage` of `aSender`.
+//
+//	`aContext` The current web request's context.
+//	`aLevel` The message's level (`debug`, `info`, `warn`, or `error`).
+//	`aSender` The name of the function reporting the message.
+//	`aMessage` The message to log.
+func logMessage(aContext context.Context, aLevel, aSender, aMessage string) {
+	if logger, ok := dbLogger.Load().(TLogFunc); ok && (nil != logger) {
+		logger(aContext, aLevel, aSender, aMessage)
+		return
+	}
+	if `error` == aLevel {
+		if id := RequestID(aContext); 0 < len(id) {
+			aMessage = `[` + id + `] ` + aMessage
+		}
+		apachelogger.Err(aSender, aMessage)
+	}
+} // logMessage()
+
+// RequestID returns the request ID stored in `aContext` (see
+// `WithRequestID()`) or an empty string if there's none.
+//
+//	`aContext` The current web request's context.
+func RequestID(aContext context.Context) string {
+	id, _ := aContext.Value(tRequestIDKey{}).(string)
+
+	return id
+} // RequestID()
+
+// SetLogger sets the function to log the package's messages.
+//
+// Without a logger only errors are logged (by `apachelogger.Err()`).
+//
+//	`aLogger` The function to call with each message.
+func SetLogger(aLogger TLogFunc) {
+	dbLogger.Store(aLogger)
+} // SetLogger()
+
+// WithRequestID returns a copy of `aContext` holding `aID` as the
+// current web request's ID to be included in all log messages.
+//
+//	`aContext` The current web request's context.
+//	`aID` The web request's ID.
+func WithRequestID(aContext context.Context, aID string) context.Context {
+	return context.WithValue(aContext, tRequestIDKey{}, aID)
+} // WithRequestID()
+
+/* _EoF_ */
@@ -0,0 +1,59 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	ctx := WithRequestID(context.TODO(), `abc123`)
+	dbHandle := openDBforTesting(ctx)
+	defer SetLogger(nil)
+
+	var got []string
+	SetLogger(func(aContext context.Context, aLevel, aSender, aMessage string) {
+		got = append(got, RequestID(aContext)+` `+aLevel+` `+aMessage)
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		// TODO: Add test cases.
+		{" 1", `SELECT id FROM books LIMIT 1`, `abc123 debug `},
+		{" 2", `SELECT id FROM nowhere`, `abc123 error no such table: nowhere`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			if rows, err := dbHandle.query(ctx, tt.query); nil == err {
+				rows.Close()
+			}
+			if (1 != len(got)) || !strings.HasPrefix(got[0], tt.want) ||
+				!strings.HasSuffix(got[0], tt.query) {
+				t.Errorf("query() logged %q, want %q…%q", got, tt.want, tt.query)
+			}
+		})
+	}
+} // TestSetLogger()
+
+func TestRequestID(t *testing.T) {
+	if got := RequestID(context.TODO()); `` != got {
+		t.Errorf("RequestID() = %q, want empty string", got)
+	}
+	if got := RequestID(WithRequestID(context.TODO(), `abc123`)); `abc123` != got {
+		t.Errorf("RequestID() = %q, want %q", got, `abc123`)
+	}
+} // TestRequestID()
+
+/* _EoF_ */
@@ -13,6 +13,7 @@ package db
  */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,8 +22,6 @@ import (
 	"sort"
 	"strings"
 	"sync"
-
-	"github.com/mwat56/apachelogger"
 )
 
 const (
@@ -161,14 +160,14 @@ func mdReadFieldMetadata() error {
 func mdReadHiddenVirtualLibraries() error {
 	if err := mdReadMetadataFile(); nil != err {
 		msg := fmt.Sprintf("mdReadMetadataFile(): %v", err)
-		apachelogger.Err("mdReadHiddenVirtualLibraries", msg)
+		logMessage(context.Background(), `error`, "mdReadHiddenVirtualLibraries", msg)
 		return errors.New(msg)
 	}
 
 	section, ok := mdGetMetadataDbPref(mdHiddenVirtualLibraries)
 	if !ok {
 		msg := "no such JSON section: " + mdHiddenVirtualLibraries
-		apachelogger.Err("mdReadHiddenVirtualLibraries", msg)
+		logMessage(context.Background(), `error`, "mdReadHiddenVirtualLibraries", msg)
 		return errors.New(msg)
 	}
 
@@ -246,14 +245,14 @@ func mdReadMetadataFile() error {
 func mdReadVirtualLibraries() error {
 	if err := mdReadMetadataFile(); nil != err {
 		msg := fmt.Sprintf("mdReadMetadataFile(): %v", err)
-		apachelogger.Err("mdReadVirtualLibraries()", msg)
+		logMessage(context.Background(), `error`, "mdReadVirtualLibraries()", msg)
 		return errors.New(msg)
 	}
 
 	section, ok := mdGetMetadataDbPref(mdVirtualLibraries)
 	if !ok {
 		msg := "no such JSON section: " + mdVirtualLibraries
-		apachelogger.Err("mdReadVirtualLibraries()", msg)
+		logMessage(context.Background(), `error`, "mdReadVirtualLibraries()", msg)
 		return errors.New(msg)
 	}
 
@@ -275,12 +274,12 @@ func mdReadVirtualLibraries() error {
 func mdVirtLibDefinitions() (*TVirtLibList, error) {
 	if err := mdReadVirtualLibraries(); nil != err {
 		msg := fmt.Sprintf("mdReadVirtualLibraries(): %v", err)
-		apachelogger.Err("mdVirtualLibDefinitions()", msg)
+		logMessage(context.Background(), `error`, "mdVirtualLibDefinitions()", msg)
 		return nil, errors.New(msg)
 	}
 	if err := mdReadHiddenVirtualLibraries(); nil != err {
 		msg := fmt.Sprintf("mdReadHiddenVirtualLibraries(): %v", err)
-		apachelogger.Err("mdVirtualLibDefinitions()", msg)
+		logMessage(context.Background(), `error`, "mdVirtualLibDefinitions()", msg)
 		return nil, errors.New(msg)
 	}
 
@@ -300,7 +299,7 @@ func mdVirtLibDefinitions() (*TVirtLibList, error) {
 			result[key] = definition
 		} else {
 			msg := fmt.Sprintf("json.value.(string): wrong type %v", value)
-			apachelogger.Err("mdVirtualLibDefinitions", msg)
+			logMessage(context.Background(), `error`, "mdVirtualLibDefinitions", msg)
 		}
 	}
 
@@ -318,7 +317,7 @@ func mdVirtLibDefinitions() (*TVirtLibList, error) {
 func BookFieldVisible(aFieldname string) (bool, error) {
 	if err := mdReadBookDisplayFields(); nil != err {
 		msg := fmt.Sprintf("mdReadBookDisplayFields(): %v", err)
-		apachelogger.Err("md.BookFieldVisible()", msg)
+		logMessage(context.Background(), `error`, "md.BookFieldVisible()", msg)
 		return true, errors.New(msg)
 	}
 	mdBookDisplayFieldsListMtx.RLock()
@@ -329,11 +328,77 @@ func BookFieldVisible(aFieldname string) (bool, error) {
 	}
 
 	msg := "field name doesn't exist: " + aFieldname
-	apachelogger.Err("md.BookFieldVisible()", msg)
+	logMessage(context.Background(), `error`, "md.BookFieldVisible()", msg)
 
 	return true, errors.New(msg)
 } // BookFieldVisible()
 
+// CustomColumn returns the user-defined column identified by `aLabel`
+// or `nil` if there's no such column.
+//
+//	`aLabel` The column's lookup name (with or without leading `#`).
+func CustomColumn(aLabel string) *TCustomColumn {
+	aLabel = strings.ToLower(strings.TrimPrefix(aLabel, `#`))
+	if list := CustomColumns(); nil != list {
+		for idx, cc := range *list {
+			if cc.Label == aLabel {
+				return &(*list)[idx]
+			}
+		}
+	}
+
+	return nil
+} // CustomColumn()
+
+// CustomColumns returns the user-defined columns as defined by the
+// metadata's `field_metadata` section, sorted by their names.
+//
+// If there are no user-defined columns the function returns `nil`.
+func CustomColumns() *TCustomColumnList {
+	if err := mdReadFieldMetadata(); nil != err {
+		msg := fmt.Sprintf("mdReadFieldMetadata(): %v", err)
+		logMessage(context.Background(), `error`, "md.CustomColumns()", msg)
+		return nil
+	}
+	mdFieldsMetadataListMtx.RLock()
+	defer mdFieldsMetadataListMtx.RUnlock()
+
+	result := make(TCustomColumnList, 0, len(*mdFieldsMetadataList))
+	for field, raw := range *mdFieldsMetadataList {
+		if '#' != field[0] {
+			continue
+		}
+		fmd, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if isCustom, _ := fmd[`is_custom`].(bool); !isCustom {
+			continue
+		}
+		cc := TCustomColumn{Label: field[1:]}
+		if colnum, ok := fmd[`colnum`].(float64); ok {
+			cc.ID = int(colnum)
+		}
+		cc.Name, _ = fmd[`name`].(string)
+		if 0 == len(cc.Name) {
+			cc.Name = cc.Label
+		}
+		cc.Datatype, _ = fmd[`datatype`].(string)
+		cc.Normalized = dbNormalizedTypes[cc.Datatype]
+		if 0 < cc.ID {
+			result = append(result, cc)
+		}
+	}
+	if 0 == len(result) {
+		return nil
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return (result[i].Name < result[j].Name)
+	})
+
+	return &result
+} // CustomColumns()
+
 // MetaFieldValue returns the value of `aField` of `aSection`.
 //
 //	`aSection` Name of the field's metadata section.
@@ -341,21 +406,21 @@ func BookFieldVisible(aFieldname string) (bool, error) {
 func MetaFieldValue(aSection, aField string) (interface{}, error) {
 	if (0 == len(aSection)) || (0 == len(aField)) {
 		msg := fmt.Sprintf(`md.MetaFieldValue(): empty arguments ("%s". "%s")`, aSection, aField)
-		apachelogger.Err("md.MetaFieldValue", msg)
+		logMessage(context.Background(), `error`, "md.MetaFieldValue", msg)
 		return nil, errors.New(msg)
 	}
 
 	fmd, err := mdGetFieldData(aSection)
 	if nil != err {
 		msg := fmt.Sprintf("mdGetFieldData(): %v", err)
-		apachelogger.Err("md.MetaFieldValue", msg)
+		logMessage(context.Background(), `error`, "md.MetaFieldValue", msg)
 		return nil, errors.New(msg)
 	}
 
 	result, ok := fmd[aField]
 	if !ok {
 		msg := fmt.Sprintf("no such JSON section: %s[%s]", aSection, aField)
-		apachelogger.Err("md.MetaFieldValue", msg)
+		logMessage(context.Background(), `error`, "md.MetaFieldValue", msg)
 		return nil, errors.New(msg)
 	}
 
@@ -369,7 +434,7 @@ func VirtLibOptions(aSelected string) string {
 	_, err := VirtualLibraryList()
 	if nil != err {
 		msg := fmt.Sprintf("md.VirtualLibraryList(): %v", err)
-		apachelogger.Err("md.VirtLibOptions", msg)
+		logMessage(context.Background(), `error`, "md.VirtLibOptions", msg)
 		return ""
 	}
 	mdVirtLibListMtx.RLock()
@@ -416,7 +481,7 @@ func VirtualLibraryList() (TVirtLibList, error) {
 	jsList, err := mdVirtLibDefinitions()
 	if nil != err {
 		msg := fmt.Sprintf("mdVirtLibDefinitions(): %v", err)
-		apachelogger.Err("md.VirtualLibraryList()", msg)
+		logMessage(context.Background(), `error`, "md.VirtualLibraryList()", msg)
 		return nil, err
 	}
 
@@ -206,6 +206,37 @@ func Test_mdVirtualLibDefinitions(t *testing.T) {
 	}
 } // Test_mdVirtualLibDefinitions()
 
+func Test_CustomColumn(t *testing.T) {
+	SetCalibreLibraryPath("/var/opt/Calibre")
+	tests := []struct {
+		name     string
+		aLabel   string
+		wantID   int
+		wantType string
+	}{
+		// TODO: Add test cases.
+		{" 1", "#read", 1, "bool"},
+		{" 2", "genre", 2, "text"},
+		{" 3", "#Priority", 3, "int"},
+		{" 4", "#unknown", 0, ""},
+		{" 5", "authors", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CustomColumn(tt.aLabel)
+			if 0 == tt.wantID {
+				if nil != got {
+					t.Errorf("CustomColumn() = %v, want nil", got)
+				}
+				return
+			}
+			if (nil == got) || (got.ID != tt.wantID) || (got.Datatype != tt.wantType) {
+				t.Errorf("CustomColumn() = %v, want %d/%s", got, tt.wantID, tt.wantType)
+			}
+		})
+	}
+} // Test_CustomColumn()
+
 func Test_MetaFieldValue(t *testing.T) {
 	SetCalibreLibraryPath("/var/opt/Calibre")
 	type args struct {
@@ -29,8 +29,17 @@ type (
 
 	// tDBpool The list of database connections.
 	tDBpool struct {
-		pList tDBlist     // The actual list of available connections
-		pMtx  *sync.Mutex // A guard against concurrent write accesses
+		pList   tDBlist     // The actual list of available connections
+		pMtx    *sync.Mutex // A guard against concurrent write accesses
+		pOpened int64       // number of connections opened
+		pReused int64       // number of connections reused
+	}
+
+	// TPoolStats are the statistics of the database connection pool.
+	TPoolStats struct {
+		Opened int64 // number of connections opened
+		Reused int64 // number of connections reused
+		Size   int   // number of connections currently available
 	}
 )
 
@@ -81,6 +90,22 @@ func newPool() *tDBpool {
 	return pConnPool
 } // newPool()
 
+// PoolStats returns the current statistics of the database
+// connection pool.
+func PoolStats() (rStats TPoolStats) {
+	if nil == pConnPool {
+		return
+	}
+	pConnPool.pMtx.Lock()
+	defer pConnPool.pMtx.Unlock()
+
+	rStats.Opened = pConnPool.pOpened
+	rStats.Reused = pConnPool.pReused
+	rStats.Size = len(pConnPool.pList)
+
+	return
+} // PoolStats()
+
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
 
 // `clear()` empties the list.
@@ -149,6 +174,7 @@ func (p *tDBpool) get(aContext context.Context) (rConn *sql.DB, rErr error) {
 			if rConn, rErr = sql.Open(`sqlite3`, dsn); nil == rErr {
 				// rConn.Exec("PRAGMA xxx=yyy")
 				go goSQLtrace(`-- opened DB connection`, time.Now()) //REMOVE
+				p.pOpened++
 				rErr = rConn.PingContext(aContext)
 			}
 		}
@@ -169,6 +195,7 @@ func (p *tDBpool) get(aContext context.Context) (rConn *sql.DB, rErr error) {
 		} else { // case (3)
 			p.pList = p.pList[1:] // remove first item from list
 		}
+		p.pReused++
 		go goSQLtrace(`-- reusing DB connection`, time.Now()) //REMOVE
 	}
 
@@ -127,3 +127,21 @@ func Test_tDBpool_put(t *testing.T) {
 		})
 	}
 }
+
+func TestPoolStats(t *testing.T) {
+	ctx := context.Background()
+	prepDBforTesting(ctx)
+	pConnPool.clear()
+
+	before := PoolStats()
+	conn, _ := pConnPool.get(ctx) // opens a new connection
+	pConnPool.put(conn)
+	if got := PoolStats(); (before.Opened+1 != got.Opened) || (1 != got.Size) {
+		t.Errorf("PoolStats() = %v, want one more opened and size 1", got)
+	}
+	conn, _ = pConnPool.get(ctx) // reuses the connection
+	if got := PoolStats(); (before.Reused+1 != got.Reused) || (0 != got.Size) {
+		t.Errorf("PoolStats() = %v, want one more reused and size 0", got)
+	}
+	pConnPool.put(conn)
+} // TestPoolStats()
@@ -10,6 +10,7 @@ package db
 
 import (
 	"fmt"
+	"html"
 	"net/http"
 	"strconv"
 	"strings"
@@ -32,6 +33,8 @@ const (
 	qoSortByTags
 	qoSortByTime
 	qoSortByTitle
+	qoSortByCustom    // user-defined column, see `SortCustom`
+	qoSortByDownloads // number of downloads, see `downloadOrder()`
 )
 
 // Definition of the GUI language to use
@@ -46,6 +49,14 @@ const (
 	QoLayoutGrid = uint8(1)
 )
 
+// Definition of the reading state filter
+const (
+	QoReadAll      = uint8(0)
+	QoReadUnread   = uint8(1)
+	QoReadReading  = uint8(2)
+	QoReadFinished = uint8(3)
+)
+
 // Definition of the CSS theme to use
 const (
 	QoThemeLight = uint8(0)
@@ -60,23 +71,28 @@ type (
 	TQueryOptions struct {
 		ID          TID       // an entity ID to lookup
 		Descending  bool      // sort direction
-		Entity      string    // query for a certain entity (authors, publisher, series, tags)
+		Entity      string    // query for a certain entity (authors, publisher, series, shelves, tags)
 		GuiLang     uint8     // GUI language
 		Layout      uint8     // either `qoLayoutList` or `qoLayoutGrid`
 		LimitLength uint      // number of documents per page
 		LimitStart  uint      // starting number
 		Matching    string    // text to lookup in all documents
 		QueryCount  uint      // number of DB records matching the query options
+		ReadState   uint8     // reading state filter (`QoReadXXX`)
 		SortBy      TSortType // display order of documents (`qoSortByXXX`)
+		SortCustom  string    // user-defined column to sort by (`qoSortByCustom`)
 		Theme       uint8     // CSS presentation theme
+		User        string    // the current user (not stored with the options)
 		VirtLib     string    // virtual libraries
 	}
 )
 
 // Pattern used by `String()` and `Scan()`:
 const (
-	qoStringPattern = `|%d|%t|%q|%d|%d|%d|%d|%q|%d|%d|%d|%q|`
-	//                   |  |  |  |  |  |  |  |  |  |  |  + Theme
+	qoStringPattern = `|%d|%t|%q|%d|%d|%d|%d|%q|%d|%d|%d|%q|%q|%d|`
+	//                   |  |  |  |  |  |  |  |  |  |  |  |  |  + ReadState
+	//                   |  |  |  |  |  |  |  |  |  |  |  |  + SortCustom
+	//                   |  |  |  |  |  |  |  |  |  |  |  + VirtLib
 	//                   |  |  |  |  |  |  |  |  |  |  + Theme
 	//                   |  |  |  |  |  |  |  |  |  + SortBy
 	//                   |  |  |  |  |  |  |  |  + QueryCount
@@ -104,8 +120,11 @@ func (qo *TQueryOptions) clone() *TQueryOptions {
 		LimitStart:  qo.LimitStart,
 		Matching:    qo.Matching,
 		QueryCount:  qo.QueryCount,
+		ReadState:   qo.ReadState,
 		SortBy:      qo.SortBy,
+		SortCustom:  qo.SortCustom,
 		Theme:       qo.Theme,
+		User:        qo.User,
 		VirtLib:     qo.VirtLib,
 	}
 
@@ -136,17 +155,25 @@ func (qo *TQueryOptions) IncLimit() *TQueryOptions {
 //
 //	`aString` The value string to scan.
 func (qo *TQueryOptions) Scan(aString string) *TQueryOptions {
-	var m, v string
+	var c, m, v string
 	_, _ = fmt.Sscanf(aString, qoStringPattern,
 		&qo.ID, &qo.Descending, &qo.Entity, &qo.GuiLang, &qo.Layout,
 		&qo.LimitLength, &qo.LimitStart, &m, &qo.QueryCount,
-		&qo.SortBy, &qo.Theme, &v)
+		&qo.SortBy, &qo.Theme, &v, &c, &qo.ReadState)
 	qo.Matching = strings.TrimSpace(m)
 	if "-" == v {
 		qo.VirtLib = ""
 	} else {
 		qo.VirtLib = strings.TrimSpace(v)
 	}
+	qo.SortCustom = strings.TrimSpace(c)
+	if qoSortByCustom == qo.SortBy {
+		if 0 == len(qo.SortCustom) {
+			qo.SortBy = qoSortByAcquisition
+		}
+	} else {
+		qo.SortCustom = ""
+	}
 
 	return qo
 } // Scan()
@@ -221,12 +248,31 @@ func (qo *TQueryOptions) SelectOrderOptions() *TStringMap {
 	return &result
 } // SelectOrderOptions()
 
+// SelectReadStateOptions returns a list of SELECT/OPTIONs
+// for the reading state filter.
+func (qo *TQueryOptions) SelectReadStateOptions() *TStringMap {
+	result := make(TStringMap, 4)
+	for idx, name := range qoReadStateNames {
+		result[name] = `<option` + qoSelectedLookup[uint8(idx) == qo.ReadState] +
+			` value="` + name + `">`
+	}
+
+	return &result
+} // SelectReadStateOptions()
+
 // SelectSortByOptions returns a list of SELECT/OPTIONs
 // for the order choice.
+//
+// The `custom` entry holds complete OPTIONs for all user-defined
+// columns available for sorting; the `downloads` entry is present
+// only if there's a user database (storing the download statistics).
 func (qo *TQueryOptions) SelectSortByOptions() *TStringMap {
-	result := make(TStringMap, 10)
+	result := make(TStringMap, 12)
 	qo.selectSortByPrim(&result, qoSortByAcquisition, "acquisition")
 	qo.selectSortByPrim(&result, qoSortByAuthor, "authors")
+	if 0 < len(UserDatabaseFile()) {
+		qo.selectSortByPrim(&result, qoSortByDownloads, "downloads")
+	}
 	qo.selectSortByPrim(&result, qoSortByLanguage, "language")
 	qo.selectSortByPrim(&result, qoSortByPublisher, "publisher")
 	qo.selectSortByPrim(&result, qoSortByRating, "rating")
@@ -236,6 +282,19 @@ func (qo *TQueryOptions) SelectSortByOptions() *TStringMap {
 	qo.selectSortByPrim(&result, qoSortByTime, "time")
 	qo.selectSortByPrim(&result, qoSortByTitle, "title")
 
+	var custom []string
+	if list := CustomColumns(); nil != list {
+		for _, cc := range *list {
+			if `composite` == cc.Datatype {
+				continue
+			}
+			selected := (qoSortByCustom == qo.SortBy) && (cc.Label == qo.SortCustom)
+			custom = append(custom, fmt.Sprintf(`<option%s value="#%s">%s</option>`,
+				qoSelectedLookup[selected], cc.Label, html.EscapeString(cc.Name)))
+		}
+	}
+	result["custom"] = strings.Join(custom, "\n")
+
 	return &result
 } // SelectSortByOptions()
 
@@ -247,6 +306,57 @@ func (qo *TQueryOptions) selectSortByPrim(aMap *TStringMap, aSort TSortType, aIn
 	}
 } // sortSelectOptionsPrim()
 
+var (
+	// Names used by the `readstate` form field (by `QoReadXXX` index).
+	qoReadStateNames = [...]string{`all`, `unread`, `reading`, `finished`}
+
+	// Lookup table for the names used by the `sortby` form field.
+	qoSortByLookup = map[string]TSortType{
+		"acquisition": qoSortByAcquisition,
+		"authors":     qoSortByAuthor,
+		"downloads":   qoSortByDownloads,
+		"language":    qoSortByLanguage,
+		"publisher":   qoSortByPublisher,
+		"rating":      qoSortByRating,
+		"series":      qoSortBySeries,
+		"size":        qoSortBySize,
+		"tags":        qoSortByTags,
+		"time":        qoSortByTime,
+		"title":       qoSortByTitle,
+	}
+)
+
+// `sortByName()` returns the sort option identified by `aName`.
+//
+// A name starting with `#` selects the user-defined column of
+// that name; if there's no such column (or `aName` is not a known
+// sort option at all) the order defaults to `acquisition`.
+//
+//	`aName` The name of the sort option as used by the `sortby` form field.
+func sortByName(aName string) (rSort TSortType, rCustom string) {
+	if (1 < len(aName)) && ('#' == aName[0]) {
+		if cc := CustomColumn(aName); (nil != cc) && (`composite` != cc.Datatype) {
+			return qoSortByCustom, cc.Label
+		}
+		return qoSortByAcquisition, ``
+	}
+
+	return qoSortByLookup[aName], ``
+} // sortByName()
+
+// SetSortBy sets the display order of documents.
+//
+// If `aName` is not a known sort option the order defaults to
+// `acquisition`.
+// A name starting with `#` selects a user-defined column.
+//
+//	`aName` The name of the sort option as used by the `sortby` form field.
+func (qo *TQueryOptions) SetSortBy(aName string) *TQueryOptions {
+	qo.SortBy, qo.SortCustom = sortByName(aName)
+
+	return qo
+} // SetSortBy()
+
 // SelectThemeOptions returns a list of SELECT/OPTIONs
 // for the theme choice.
 func (qo *TQueryOptions) SelectThemeOptions() *TStringMap {
@@ -274,7 +384,8 @@ func (qo *TQueryOptions) String() string {
 	return fmt.Sprintf(qoStringPattern,
 		qo.ID, qo.Descending, qo.Entity, qo.GuiLang, qo.Layout,
 		qo.LimitLength, qo.LimitStart, qo.Matching,
-		qo.QueryCount, qo.SortBy, qo.Theme, qo.VirtLib)
+		qo.QueryCount, qo.SortBy, qo.Theme, qo.VirtLib, qo.SortCustom,
+		qo.ReadState)
 } // String()
 
 // Update returns a `TQueryOptions` instance with updated values
@@ -330,33 +441,28 @@ func (qo *TQueryOptions) Update(aRequest *http.Request) *TQueryOptions {
 		qo.Descending = false
 	}
 
-	if fsb := aRequest.FormValue("sortby"); 0 < len(fsb) {
-		var sb TSortType // defaults to `0` == `qoSortByAcquisition`
-		switch fsb {
-		case "authors":
-			sb = qoSortByAuthor
-		case "language":
-			sb = qoSortByLanguage
-		case "publisher":
-			sb = qoSortByPublisher
-		case "rating":
-			sb = qoSortByRating
-		case "series":
-			sb = qoSortBySeries
-		case "size":
-			sb = qoSortBySize
-		case "tags":
-			sb = qoSortByTags
-		case "time":
-			sb = qoSortByTime
-		case "title":
-			sb = qoSortByTitle
+	if frs := aRequest.FormValue("readstate"); 0 < len(frs) {
+		rs := QoReadAll
+		for idx, name := range qoReadStateNames {
+			if name == frs {
+				rs = uint8(idx)
+				break
+			}
+		}
+		if rs != qo.ReadState {
+			qo.LimitStart, qo.ReadState = 0, rs
 		}
-		if sb != qo.SortBy {
-			qo.LimitStart, qo.SortBy = 0, sb
+	} else {
+		qo.ReadState = QoReadAll
+	}
+
+	if fsb := aRequest.FormValue("sortby"); 0 < len(fsb) {
+		// defaults to `0` == `qoSortByAcquisition`
+		if sb, sc := sortByName(fsb); (sb != qo.SortBy) || (sc != qo.SortCustom) {
+			qo.LimitStart, qo.SortBy, qo.SortCustom = 0, sb, sc
 		}
 	} else {
-		qo.SortBy = qoSortByAcquisition
+		qo.SortBy, qo.SortCustom = qoSortByAcquisition, ``
 	}
 
 	if theme := aRequest.FormValue("theme"); 0 < len(theme) {
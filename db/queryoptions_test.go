@@ -8,6 +8,7 @@ package db
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -128,6 +129,21 @@ func TestTQueryOptions_Scan(t *testing.T) {
 		Theme:       QoThemeLight,
 		VirtLib:     "",
 	}
+	o4 := NewQueryOptions(0)
+	s4 := `|0|false|""|0|0|25|0|""|6|10|0|"-"|"priority"|`
+	w4 := &TQueryOptions{
+		LimitLength: 25,
+		QueryCount:  6,
+		SortBy:      qoSortByCustom,
+		SortCustom:  "priority",
+	}
+	o5 := NewQueryOptions(0)
+	s5 := `|0|false|""|0|0|25|0|""|6|0|0|"-"|""|3|`
+	w5 := &TQueryOptions{
+		LimitLength: 25,
+		QueryCount:  6,
+		ReadState:   QoReadFinished,
+	}
 	type args struct {
 		aString string
 	}
@@ -138,6 +154,8 @@ func TestTQueryOptions_Scan(t *testing.T) {
 		want   *TQueryOptions
 	}{
 		// TODO: Add test cases.
+		{" 5", *o5, args{s5}, w5},
+		{" 4", *o4, args{s4}, w4},
 		{" 3", *o3, args{s3}, w3},
 		{" 2", *o2, args{s2}, w2},
 		{" 1", *o1, args{s1}, w1},
@@ -152,13 +170,56 @@ func TestTQueryOptions_Scan(t *testing.T) {
 	}
 } // TestTQueryOptions_Scan()
 
+func TestTQueryOptions_SelectReadStateOptions(t *testing.T) {
+	o1 := TQueryOptions{}
+	w1 := &TStringMap{
+		"all":      `<option SELECTED value="all">`,
+		"unread":   `<option value="unread">`,
+		"reading":  `<option value="reading">`,
+		"finished": `<option value="finished">`,
+	}
+	o2 := TQueryOptions{
+		ReadState: QoReadReading,
+	}
+	w2 := &TStringMap{
+		"all":      `<option value="all">`,
+		"unread":   `<option value="unread">`,
+		"reading":  `<option SELECTED value="reading">`,
+		"finished": `<option value="finished">`,
+	}
+	tests := []struct {
+		name   string
+		fields TQueryOptions
+		want   *TStringMap
+	}{
+		// TODO: Add test cases.
+		{" 1", o1, w1},
+		{" 2", o2, w2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qo := &tt.fields
+			if got := qo.SelectReadStateOptions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TQueryOptions.SelectReadStateOptions() = %v,\nwant %v", got, tt.want)
+			}
+		})
+	}
+} // TestTQueryOptions_SelectReadStateOptions()
+
 func TestTQueryOptions_SortSelectOptions(t *testing.T) {
+	SetCalibreLibraryPath("/var/opt/Calibre")
+	c1 := "<option value=\"#finished\">Finished</option>\n" +
+		"<option value=\"#genre\">Genre</option>\n" +
+		"<option value=\"#priority\">Priority</option>\n" +
+		"<option value=\"#read\">Read</option>\n" +
+		"<option value=\"#saga\">Saga</option>"
 	o1 := TQueryOptions{
 		SortBy: qoSortByAuthor,
 	}
 	w1 := &TStringMap{
 		`acquisition`: `<option value="acquisition">`,
 		`authors`:     `<option SELECTED value="authors">`,
+		`custom`:      c1,
 		`language`:    `<option value="language">`,
 		`publisher`:   `<option value="publisher">`,
 		`rating`:      `<option value="rating">`,
@@ -174,6 +235,7 @@ func TestTQueryOptions_SortSelectOptions(t *testing.T) {
 	w2 := &TStringMap{
 		`acquisition`: `<option value="acquisition">`,
 		`authors`:     `<option value="authors">`,
+		`custom`:      c1,
 		`language`:    `<option value="language">`,
 		`publisher`:   `<option value="publisher">`,
 		`rating`:      `<option value="rating">`,
@@ -183,6 +245,23 @@ func TestTQueryOptions_SortSelectOptions(t *testing.T) {
 		`time`:        `<option SELECTED value="time">`,
 		`title`:       `<option value="title">`,
 	}
+	o3 := TQueryOptions{
+		SortBy:     qoSortByCustom,
+		SortCustom: `priority`,
+	}
+	w3 := &TStringMap{
+		`acquisition`: `<option value="acquisition">`,
+		`authors`:     `<option value="authors">`,
+		`custom`:      strings.Replace(c1, `<option value="#priority">`, `<option SELECTED value="#priority">`, 1),
+		`language`:    `<option value="language">`,
+		`publisher`:   `<option value="publisher">`,
+		`rating`:      `<option value="rating">`,
+		`series`:      `<option value="series">`,
+		`size`:        `<option value="size">`,
+		`tags`:        `<option value="tags">`,
+		`time`:        `<option value="time">`,
+		`title`:       `<option value="title">`,
+	}
 	tests := []struct {
 		name   string
 		fields TQueryOptions
@@ -191,6 +270,7 @@ func TestTQueryOptions_SortSelectOptions(t *testing.T) {
 		// TODO: Add test cases.
 		{" 1", o1, w1},
 		{" 2", o2, w2},
+		{" 3", o3, w3},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -216,7 +296,7 @@ func TestTQueryOptions_String(t *testing.T) {
 		SortBy:      qoSortByAuthor,
 		Theme:       QoThemeDark,
 	}
-	w1 := `|3524|true|"authors"|1|0|50|0|""|100|1|1|""|`
+	w1 := `|3524|true|"authors"|1|0|50|0|""|100|1|1|""|""|0|`
 	o2 := TQueryOptions{
 		ID:          1,
 		Descending:  false,
@@ -230,7 +310,19 @@ func TestTQueryOptions_String(t *testing.T) {
 		SortBy:      qoSortByLanguage,
 		Theme:       QoThemeLight,
 	}
-	w2 := `|1|false|"lang"|0|1|25|0|""|200|2|0|""|`
+	w2 := `|1|false|"lang"|0|1|25|0|""|200|2|0|""|""|0|`
+	o3 := TQueryOptions{
+		LimitLength: 25,
+		SortBy:      qoSortByCustom,
+		SortCustom:  "genre",
+	}
+	w3 := `|0|false|""|0|0|25|0|""|0|10|0|""|"genre"|0|`
+	o4 := TQueryOptions{
+		LimitLength: 25,
+		ReadState:   QoReadUnread,
+		User:        "alice",
+	}
+	w4 := `|0|false|""|0|0|25|0|""|0|0|0|""|""|1|`
 	tests := []struct {
 		name   string
 		fields TQueryOptions
@@ -239,6 +331,8 @@ func TestTQueryOptions_String(t *testing.T) {
 		// TODO: Add test cases.
 		{" 1", o1, w1},
 		{" 2", o2, w2},
+		{" 3", o3, w3},
+		{" 4", o4, w4},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,198 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the per-user restrictions of the visible documents.
+ *
+ * The restrictions are read from a JSON file mapping user names to
+ * a `TRestriction`; the special names `-` (anonymous visitors) and
+ * `*` (all users without an own entry) are supported as well.
+ *
+ * The user is taken from the web request's context (see `WithUser()`)
+ * so that all queries (`QueryBy()`, `QueryDocMini()`, `QueryDocument()`,
+ * `QueryEntities()`, `QuerySearch()`, and `QuerySuggestions()`) are
+ * restricted without further ado.
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+type (
+	// TRestriction limits the documents visible to a user.
+	//
+	// All given conditions must be met by a document to be visible.
+	TRestriction struct {
+		AllowTags []string `json:"allowTags"` // only documents with one of these tags
+		DenyTags  []string `json:"denyTags"`  // no documents with any of these tags
+		VirtLib   string   `json:"virtLib"`   // only documents of this virtual library
+	}
+
+	// `tUserKey` is the type of the context key holding the user.
+	tUserKey struct{}
+)
+
+const (
+	// RestrictAnonymous is the restrictions file's name of
+	// visitors not authenticated.
+	RestrictAnonymous = `-`
+
+	// RestrictDefault is the restrictions file's name used for
+	// all users without an own entry.
+	RestrictDefault = `*`
+)
+
+var (
+	// The restrictions read from the JSON file.
+	rsList map[string]TRestriction
+
+	// Guard against concurrent access of `rsList`.
+	rsMtx sync.RWMutex
+)
+
+// SetRestrictionsFile reads the per-user restrictions from `aFilename`.
+//
+// An empty `aFilename` removes all restrictions.
+//
+//	`aFilename` The JSON file holding the restrictions.
+func SetRestrictionsFile(aFilename string) error {
+	var list map[string]TRestriction
+	if 0 < len(aFilename) {
+		data, err := os.ReadFile(aFilename) // #nosec G304
+		if nil != err {
+			return err
+		}
+		if err = json.Unmarshal(data, &list); nil != err {
+			return fmt.Errorf("%s: %v", aFilename, err)
+		}
+	}
+	rsMtx.Lock()
+	rsList = list
+	rsMtx.Unlock()
+
+	return nil
+} // SetRestrictionsFile()
+
+// WithUser returns a copy of `aContext` holding `aUser` as the
+// current user whose restrictions apply to all queries.
+//
+// Queries using a context without a user (e.g. background jobs)
+// are not restricted.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The authenticated user (or an empty string for anonymous).
+func WithUser(aContext context.Context, aUser string) context.Context {
+	return context.WithValue(aContext, tUserKey{}, aUser)
+} // WithUser()
+
+// ContextUser returns the user stored in `aContext` (see `WithUser()`)
+// and whether there's one at all.
+//
+//	`aContext` The current web request's context.
+func ContextUser(aContext context.Context) (string, bool) {
+	user, ok := aContext.Value(tUserKey{}).(string)
+
+	return user, ok
+} // ContextUser()
+
+// `tagCondition()` returns a condition matching the documents with
+// one of `aTags`.
+//
+//	`aOperator` Either `IN` or `NOT IN`.
+//	`aTags` The list of tag names.
+func tagCondition(aOperator string, aTags []string) string {
+	list := make([]string, len(aTags))
+	for idx, tag := range aTags {
+		list[idx] = `'` + strings.Replace(strings.TrimSpace(tag), `'`, `''`, -1) + `'`
+	}
+
+	return `(b.id ` + aOperator + ` (SELECT bt.book FROM books_tags_link bt JOIN tags t ON(bt.tag = t.id) WHERE (t.name COLLATE NOCASE IN (` + strings.Join(list, `,`) + `))))`
+} // tagCondition()
+
+// `condition()` returns the SQL condition implementing `rs`.
+func (rs *TRestriction) condition() string {
+	var parts []string
+	if 0 < len(rs.AllowTags) {
+		parts = append(parts, tagCondition(`IN`, rs.AllowTags))
+	}
+	if 0 < len(rs.DenyTags) {
+		parts = append(parts, tagCondition(`NOT IN`, rs.DenyTags))
+	}
+	if 0 < len(rs.VirtLib) {
+		// An unknown library must not reveal all documents:
+		where := `(1=0)`
+		if vlList, err := VirtualLibraryList(); nil == err {
+			if def, ok := vlList[rs.VirtLib]; ok {
+				if w := NewSearch(def).Parse().Where(); 0 < len(w) {
+					where = `(` + w + `)`
+				}
+			}
+		}
+		parts = append(parts, where)
+	}
+
+	return strings.Join(parts, ` AND `)
+} // condition()
+
+// IsRestricted returns whether the documents visible to the user of
+// `aContext` are restricted.
+//
+//	`aContext` The current web request's context.
+func IsRestricted(aContext context.Context) bool {
+	return 0 < len(restriction(aContext))
+} // IsRestricted()
+
+// `restriction()` returns the SQL condition limiting the documents
+// to those visible to the user of `aContext`.
+//
+//	`aContext` The current web request's context.
+func restriction(aContext context.Context) string {
+	user, ok := ContextUser(aContext)
+	if !ok {
+		return ``
+	}
+	if 0 == len(user) {
+		user = RestrictAnonymous
+	}
+	rsMtx.RLock()
+	defer rsMtx.RUnlock()
+
+	rs, ok := rsList[user]
+	if !ok {
+		if rs, ok = rsList[RestrictDefault]; !ok {
+			return ``
+		}
+	}
+	if result := rs.condition(); 0 < len(result) {
+		return `(` + result + `)`
+	}
+
+	return ``
+} // restriction()
+
+// `restrictedBooks()` returns a condition limiting `aColumn` to
+// the IDs of the documents visible to the user of `aContext`.
+//
+//	`aContext` The current web request's context.
+//	`aColumn` The column holding a document ID (e.g. `bal.book`).
+func restrictedBooks(aContext context.Context, aColumn string) string {
+	if where := restriction(aContext); 0 < len(where) {
+		return `(` + aColumn + ` IN (SELECT b.id FROM books b WHERE ` + where + `))`
+	}
+
+	return ``
+} // restrictedBooks()
+
+/* _EoF_ */
@@ -0,0 +1,111 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetRestrictionsFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, `good.json`)
+	bad := filepath.Join(dir, `bad.json`)
+	_ = os.WriteFile(good, []byte(`{"kid": {"allowTags": ["Kids"]}}`), 0600)
+	_ = os.WriteFile(bad, []byte(`{"kid": `), 0600)
+	defer SetRestrictionsFile(``)
+
+	tests := []struct {
+		name  string
+		file  string
+		isErr bool
+	}{
+		// TODO: Add test cases.
+		{" 1", good, false},
+		{" 2", bad, true},
+		{" 3", filepath.Join(dir, `missing.json`), true},
+		{" 4", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetRestrictionsFile(tt.file); (nil != err) != tt.isErr {
+				t.Errorf("SetRestrictionsFile() error = %v, wantErr %v", err, tt.isErr)
+			}
+		})
+	}
+} // TestSetRestrictionsFile()
+
+func Test_tagCondition(t *testing.T) {
+	type args struct {
+		aOperator string
+		aTags     []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`IN`, []string{`Kids`}},
+			`(b.id IN (SELECT bt.book FROM books_tags_link bt JOIN tags t ON(bt.tag = t.id) WHERE (t.name COLLATE NOCASE IN ('Kids'))))`},
+		{" 2", args{`NOT IN`, []string{` Horror `, `Rock'n'Roll`}},
+			`(b.id NOT IN (SELECT bt.book FROM books_tags_link bt JOIN tags t ON(bt.tag = t.id) WHERE (t.name COLLATE NOCASE IN ('Horror','Rock''n''Roll'))))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagCondition(tt.args.aOperator, tt.args.aTags); got != tt.want {
+				t.Errorf("tagCondition() = %v,\nwant %v", got, tt.want)
+			}
+		})
+	}
+} // Test_tagCondition()
+
+func Test_restriction(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), `restrict.json`)
+	_ = os.WriteFile(fName, []byte(`{
+		"-": {"denyTags": ["Adult"]},
+		"*": {"denyTags": ["Secret"]},
+		"kid": {"allowTags": ["Kids"], "denyTags": ["Horror"]},
+		"teen": {"virtLib": "does not exist"},
+		"admin": {}
+	}`), 0600)
+	if err := SetRestrictionsFile(fName); nil != err {
+		t.Fatal(err)
+	}
+	defer SetRestrictionsFile(``)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", context.TODO(), ``},
+		{" 2", WithUser(context.TODO(), ``), `(` + tagCondition(`NOT IN`, []string{`Adult`}) + `)`},
+		{" 3", WithUser(context.TODO(), `bob`), `(` + tagCondition(`NOT IN`, []string{`Secret`}) + `)`},
+		{" 4", WithUser(context.TODO(), `kid`), `(` + tagCondition(`IN`, []string{`Kids`}) +
+			` AND ` + tagCondition(`NOT IN`, []string{`Horror`}) + `)`},
+		{" 5", WithUser(context.TODO(), `teen`), `((1=0))`},
+		{" 6", WithUser(context.TODO(), `admin`), ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restriction(tt.ctx); got != tt.want {
+				t.Errorf("restriction() = %v,\nwant %v", got, tt.want)
+			}
+			if got := IsRestricted(tt.ctx); got != (0 < len(tt.want)) {
+				t.Errorf("IsRestricted() = %v, want %v", got, !got)
+			}
+		})
+	}
+} // Test_restriction()
+
+/* _EoF_ */
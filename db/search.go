@@ -62,6 +62,22 @@ func escapeQuery(aSource string) string {
 } // escapeQuery()
 
 
+var (
+	// Replacer to quote a LIKE term (see `likeQuote()`).
+	likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `'`, `''`)
+)
+
+// `likeQuote()` returns `aTerm` quoted for use in a single-quoted
+// LIKE pattern with `ESCAPE '\'`.
+//
+// The wildcard characters contained in `aTerm` are escaped so
+// they are matched literally.
+//
+//	`aTerm` The search term to quote.
+func likeQuote(aTerm string) string {
+	return likeReplacer.Replace(aTerm)
+} // likeQuote()
+
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
 
 type (
@@ -139,25 +155,18 @@ func (exp *tExpression) buildSQL() (rWhere string) {
 		if 0 == len(exp.entity) {
 			return
 		}
-		field := strings.ToLower(exp.entity)
-		if '#' != exp.entity[0] {
-			field = "#" + field
-		}
-		if isCustom, err := MetaFieldValue(field, "is_custom"); (nil != err) || (true != isCustom) {
-			return // no user-defined field
+		cc := CustomColumn(exp.entity)
+		if (nil == cc) || (`composite` == cc.Datatype) {
+			return // no (searchable) user-defined field
 		}
-		if isCategory, err := MetaFieldValue(field, "is_category"); (nil != err) || (true != isCategory) {
-			return
-		}
-		iTable, err := MetaFieldValue(field, "table")
-		if nil != err {
-			return
+		if cc.Normalized {
+			rWhere = fmt.Sprintf(`(b.id IN (SELECT lct.book FROM books_custom_column_%d_link lct JOIN custom_column_%d ct ON(lct.value = ct.id) WHERE (ct.value`, cc.ID, cc.ID) // #nosec G201
+		} else {
+			rWhere = fmt.Sprintf(`(b.id IN (SELECT ct.book FROM custom_column_%d ct WHERE (ct.value`, cc.ID) // #nosec G201
 		}
-		table, ok := iTable.(string)
-		if !ok {
-			return
+		if `bool` == cc.Datatype {
+			exp.matcher, exp.term = `=`, customBool(exp.term)
 		}
-		rWhere = fmt.Sprintf(`(b.id IN (SELECT lct.book FROM books_%s_link lct JOIN %s ct ON(lct.value = ct.id) WHERE (ct.value`, table, table) // #nosec G201
 	}
 
 	term := escapeQuery(exp.term)
@@ -222,6 +231,12 @@ var (
 		`(?i)((!?)(#?\w+):)"([=~]?)([^"]*)"(\s*(AND|OR))?`)
 	//       12222333333311 44444445555555 6666777777776
 
+	// RegEx to find an unquoted user-defined field expression
+	// (e.g. `#read:false`)
+	soUnquotedCustomRE = regexp.MustCompile(
+		`(^|[\s(!])(#\w+):([=~]?)([^\s"()]+)`)
+	//      11111111 2222222 333333 44444444444
+
 	soSearchRemainderRE = regexp.MustCompile(
 		`\s*(!?)\s*([\w ]+)`)
 	//      1      2
@@ -276,6 +291,7 @@ func (so *TSearch) Parse() *TSearch {
 		so.next, so.where = "", ""
 		return so
 	}
+	so.raw = soUnquotedCustomRE.ReplaceAllString(so.raw, `$1$2:"$3$4"`)
 	if soSearchExpressionRE.MatchString(so.raw) {
 		// This is moved to a separate method for easier testing.
 		return so.p1()
@@ -37,6 +37,30 @@ func Test_escapeQuery(t *testing.T) {
 	}
 } // Test_escapeQuery()
 
+func Test_likeQuote(t *testing.T) {
+	type args struct {
+		term string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{""}, ""},
+		{" 2", args{"Hello World!"}, "Hello World!"},
+		{" 3", args{`'Hello' 100%`}, `''Hello'' 100\%`},
+		{" 4", args{`snake_case\path`}, `snake\_case\\path`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := likeQuote(tt.args.term); got != tt.want {
+				t.Errorf("likeQuote() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_likeQuote()
+
 func Test_tExpression_buildSQL(t *testing.T) {
 	SetCalibreLibraryPath("/var/opt/Calibre")
 	ex1 := tExpression{
@@ -210,12 +234,22 @@ func TestTSearch_Parse(t *testing.T) {
 	w8 := &TSearch{
 		where: `(b.id IN (SELECT bl.book FROM books_languages_link bl JOIN languages l ON(bl.lang_code = l.id) WHERE (l.lang_code = "eng")))`,
 	}
+	o9 := NewSearch(`#read:false`)
+	w9 := &TSearch{
+		where: `(b.id IN (SELECT ct.book FROM custom_column_1 ct WHERE (ct.value = "0")))`,
+	}
+	o10 := NewSearch(`#genre:~Hum`)
+	w10 := &TSearch{
+		where: `(b.id IN (SELECT lct.book FROM books_custom_column_2_link lct JOIN custom_column_2 ct ON(lct.value = ct.id) WHERE (ct.value LIKE "%Hum%")))`,
+	}
 	tests := []struct {
 		name   string
 		fields *TSearch
 		want   *TSearch
 	}{
 		// TODO: Add test cases.
+		{"10", o10, w10},
+		{" 9", o9, w9},
 		{" 8", o8, w8},
 		{" 7", o7, w7},
 		{" 6", o6, w6},
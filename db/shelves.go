@@ -0,0 +1,214 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the users' personal shelves stored in Kaliber's
+ * own database (see `userdb.go`).
+ *
+ * Each user has a special (unnamed) shelf holding the favourites;
+ * it's created on demand and can be neither renamed nor deleted.
+ */
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+type (
+	// TShelf is a user's personal collection of documents.
+	TShelf struct {
+		ID        TID
+		Count     int // number of documents on the shelf
+		Favourite bool
+		Name      string
+	}
+)
+
+var (
+	// ErrShelfName is returned if a shelf name is empty or used already.
+	ErrShelfName = errors.New(`invalid or duplicate shelf name`)
+)
+
+// AddToShelf puts `aBook` on `aUser`'s shelf `aShelf`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aShelf` The ID of the shelf to use.
+//	`aBook` The ID of the document to add.
+func (udb *TUserDB) AddToShelf(aContext context.Context, aUser string, aShelf, aBook TID) error {
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`INSERT OR IGNORE INTO shelf_books (shelf, book, added) SELECT id, ?, ? FROM shelves WHERE (id = ?) AND (user = ?)`,
+		aBook, time.Now(), aShelf, aUser)
+
+	return err
+} // AddToShelf()
+
+// BookShelves returns the IDs of all of `aUser`'s shelves holding `aBook`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aBook` The ID of the document in question.
+func (udb *TUserDB) BookShelves(aContext context.Context, aUser string, aBook TID) ([]TID, error) {
+	return udb.queryIDs(aContext,
+		`SELECT s.id FROM shelves s JOIN shelf_books sb ON(sb.shelf = s.id) WHERE (s.user = ?) AND (sb.book = ?) ORDER BY s.id`,
+		aUser, aBook)
+} // BookShelves()
+
+// CreateShelf adds a new shelf named `aName` for `aUser`.
+//
+// If `aName` is empty or used by another of the user's shelves
+// `ErrShelfName` is returned.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aName` The new shelf's name.
+func (udb *TUserDB) CreateShelf(aContext context.Context, aUser, aName string) (TID, error) {
+	if aName = strings.TrimSpace(aName); 0 == len(aName) {
+		return 0, ErrShelfName
+	}
+	res, err := udb.sqlDB.ExecContext(aContext,
+		`INSERT OR IGNORE INTO shelves (user, name) VALUES (?, ?)`, aUser, aName)
+	if nil != err {
+		return 0, err
+	}
+	if num, _ := res.RowsAffected(); 0 == num {
+		return 0, ErrShelfName
+	}
+	id, err := res.LastInsertId()
+
+	return TID(id), err
+} // CreateShelf()
+
+// DeleteShelf removes `aUser`'s shelf `aShelf` (but not the documents
+// on it); the favourites can't be deleted.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aShelf` The ID of the shelf to delete.
+func (udb *TUserDB) DeleteShelf(aContext context.Context, aUser string, aShelf TID) error {
+	tx, err := udb.sqlDB.BeginTx(aContext, nil)
+	if nil != err {
+		return err
+	}
+	if _, err = tx.ExecContext(aContext,
+		`DELETE FROM shelf_books WHERE shelf IN (SELECT id FROM shelves WHERE (id = ?) AND (user = ?) AND (favourite = 0))`,
+		aShelf, aUser); nil == err {
+		_, err = tx.ExecContext(aContext,
+			`DELETE FROM shelves WHERE (id = ?) AND (user = ?) AND (favourite = 0)`,
+			aShelf, aUser)
+	}
+	if nil != err {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+} // DeleteShelf()
+
+// FavouritesShelf returns the ID of `aUser`'s favourites shelf.
+//
+// The shelf is created if it doesn't exist yet.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+func (udb *TUserDB) FavouritesShelf(aContext context.Context, aUser string) (rID TID, rErr error) {
+	if _, rErr = udb.sqlDB.ExecContext(aContext,
+		`INSERT OR IGNORE INTO shelves (user, name, favourite) VALUES (?, '', 1)`,
+		aUser); nil != rErr {
+		return
+	}
+	rErr = udb.sqlDB.QueryRowContext(aContext,
+		`SELECT id FROM shelves WHERE (user = ?) AND (favourite = 1)`,
+		aUser).Scan(&rID)
+
+	return
+} // FavouritesShelf()
+
+// RemoveFromShelf takes `aBook` off `aUser`'s shelf `aShelf`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aShelf` The ID of the shelf to use.
+//	`aBook` The ID of the document to remove.
+func (udb *TUserDB) RemoveFromShelf(aContext context.Context, aUser string, aShelf, aBook TID) error {
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`DELETE FROM shelf_books WHERE (book = ?) AND shelf IN (SELECT id FROM shelves WHERE (id = ?) AND (user = ?))`,
+		aBook, aShelf, aUser)
+
+	return err
+} // RemoveFromShelf()
+
+// RenameShelf changes the name of `aUser`'s shelf `aShelf`.
+//
+// If `aName` is empty or used by another of the user's shelves
+// (or if there's no such shelf) `ErrShelfName` is returned.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aShelf` The ID of the shelf to rename.
+//	`aName` The shelf's new name.
+func (udb *TUserDB) RenameShelf(aContext context.Context, aUser string, aShelf TID, aName string) error {
+	if aName = strings.TrimSpace(aName); 0 == len(aName) {
+		return ErrShelfName
+	}
+	res, err := udb.sqlDB.ExecContext(aContext,
+		`UPDATE OR IGNORE shelves SET name = ? WHERE (id = ?) AND (user = ?) AND (favourite = 0)`,
+		aName, aShelf, aUser)
+	if nil != err {
+		return err
+	}
+	if num, _ := res.RowsAffected(); 0 == num {
+		return ErrShelfName
+	}
+
+	return nil
+} // RenameShelf()
+
+// ShelfBookIDs returns the IDs of all documents on `aUser`'s
+// shelf `aShelf`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aShelf` The ID of the shelf in question.
+func (udb *TUserDB) ShelfBookIDs(aContext context.Context, aUser string, aShelf TID) ([]TID, error) {
+	return udb.queryIDs(aContext,
+		`SELECT sb.book FROM shelf_books sb JOIN shelves s ON(s.id = sb.shelf) WHERE (s.id = ?) AND (s.user = ?) ORDER BY sb.book`,
+		aShelf, aUser)
+} // ShelfBookIDs()
+
+// Shelves returns all of `aUser`'s shelves, the favourites first
+// and the others ordered by name.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+func (udb *TUserDB) Shelves(aContext context.Context, aUser string) ([]TShelf, error) {
+	rows, err := udb.sqlDB.QueryContext(aContext,
+		`SELECT s.id, s.name, s.favourite, COUNT(sb.book) FROM shelves s LEFT JOIN shelf_books sb ON(sb.shelf = s.id) WHERE (s.user = ?) GROUP BY s.id ORDER BY s.favourite DESC, s.name COLLATE NOCASE`,
+		aUser)
+	if nil != err {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []TShelf
+	for rows.Next() {
+		var shelf TShelf
+		if err = rows.Scan(&shelf.ID, &shelf.Name, &shelf.Favourite, &shelf.Count); nil != err {
+			return nil, err
+		}
+		result = append(result, shelf)
+	}
+
+	return result, rows.Err()
+} // Shelves()
+
+/* _EoF_ */
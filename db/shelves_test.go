@@ -0,0 +1,130 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTUserDB_Shelves(t *testing.T) {
+	ctx := context.TODO()
+	udb := openTestUserDB(t)
+
+	kids, err := udb.CreateShelf(ctx, `alice`, ` for the kids `)
+	if nil != err {
+		t.Fatalf("CreateShelf() error = %v", err)
+	}
+	next, _ := udb.CreateShelf(ctx, `alice`, `To read next`)
+	if _, err = udb.CreateShelf(ctx, `alice`, `To read next`); ErrShelfName != err {
+		t.Errorf("CreateShelf(duplicate) error = %v, want %v", err, ErrShelfName)
+	}
+	if _, err = udb.CreateShelf(ctx, `alice`, ` `); ErrShelfName != err {
+		t.Errorf("CreateShelf(empty) error = %v, want %v", err, ErrShelfName)
+	}
+	// Other users may use the same names:
+	bobs, err := udb.CreateShelf(ctx, `bob`, `To read next`)
+	if nil != err {
+		t.Errorf("CreateShelf(bob) error = %v", err)
+	}
+	fav, _ := udb.FavouritesShelf(ctx, `alice`)
+	if again, _ := udb.FavouritesShelf(ctx, `alice`); again != fav {
+		t.Errorf("FavouritesShelf() = %d, want %d", again, fav)
+	}
+
+	_ = udb.AddToShelf(ctx, `alice`, kids, 3)
+	_ = udb.AddToShelf(ctx, `alice`, kids, 1)
+	_ = udb.AddToShelf(ctx, `alice`, kids, 1)
+	_ = udb.AddToShelf(ctx, `alice`, fav, 1)
+	_ = udb.AddToShelf(ctx, `alice`, bobs, 2) // not alice's shelf
+	ids, _ := udb.ShelfBookIDs(ctx, `alice`, kids)
+	if want := []TID{1, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ShelfBookIDs() = %v, want %v", ids, want)
+	}
+	if ids, _ = udb.ShelfBookIDs(ctx, `alice`, bobs); 0 != len(ids) {
+		t.Errorf("ShelfBookIDs(bob's) = %v, want []", ids)
+	}
+	ids, _ = udb.BookShelves(ctx, `alice`, 1)
+	if want := []TID{kids, fav}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("BookShelves() = %v, want %v", ids, want)
+	}
+
+	if err = udb.RenameShelf(ctx, `alice`, next, `for the kids`); ErrShelfName != err {
+		t.Errorf("RenameShelf(duplicate) error = %v, want %v", err, ErrShelfName)
+	}
+	if err = udb.RenameShelf(ctx, `alice`, fav, `Favs`); ErrShelfName != err {
+		t.Errorf("RenameShelf(favourites) error = %v, want %v", err, ErrShelfName)
+	}
+	if err = udb.RenameShelf(ctx, `alice`, next, `Holidays`); nil != err {
+		t.Errorf("RenameShelf() error = %v", err)
+	}
+	shelves, _ := udb.Shelves(ctx, `alice`)
+	want := []TShelf{
+		{ID: fav, Count: 1, Favourite: true},
+		{ID: kids, Count: 2, Name: `for the kids`},
+		{ID: next, Name: `Holidays`},
+	}
+	if !reflect.DeepEqual(shelves, want) {
+		t.Errorf("Shelves() = %v, want %v", shelves, want)
+	}
+
+	_ = udb.RemoveFromShelf(ctx, `bob`, kids, 3) // not bob's shelf
+	_ = udb.RemoveFromShelf(ctx, `alice`, kids, 1)
+	if ids, _ = udb.ShelfBookIDs(ctx, `alice`, kids); !reflect.DeepEqual(ids, []TID{3}) {
+		t.Errorf("RemoveFromShelf() = %v, want [3]", ids)
+	}
+	_ = udb.DeleteShelf(ctx, `alice`, fav)
+	_ = udb.DeleteShelf(ctx, `bob`, kids)
+	_ = udb.DeleteShelf(ctx, `alice`, kids)
+	shelves, _ = udb.Shelves(ctx, `alice`)
+	if (2 != len(shelves)) || (fav != shelves[0].ID) || (next != shelves[1].ID) {
+		t.Errorf("DeleteShelf() = %v", shelves)
+	}
+	if ids, _ = udb.ShelfBookIDs(ctx, `alice`, kids); 0 != len(ids) {
+		t.Errorf("DeleteShelf() left %v", ids)
+	}
+} // TestTUserDB_Shelves()
+
+func Test_shelfFilter(t *testing.T) {
+	ctx := context.TODO()
+	udb := openTestUserDB(t)
+	shelf, _ := udb.CreateShelf(ctx, `alice`, `Kids`)
+	_ = udb.AddToShelf(ctx, `alice`, shelf, 2)
+	_ = udb.AddToShelf(ctx, `alice`, shelf, 5)
+
+	tests := []struct {
+		name   string
+		entity string
+		id     TID
+		user   string
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `series`, shelf, `alice`, ``},
+		{" 2", `shelves`, 0, `alice`, ``},
+		{" 3", `shelves`, shelf, `alice`, `(b.id IN (2,5))`},
+		{" 4", `shelves`, shelf, `bob`, `(b.id IN ())`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qo := &TQueryOptions{Entity: tt.entity, ID: tt.id, User: tt.user}
+			got, err := shelfFilter(ctx, qo)
+			if nil != err {
+				t.Errorf("shelfFilter() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("shelfFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_shelfFilter()
+
+/* _EoF_ */
@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -21,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // anonymous import
@@ -56,7 +58,10 @@ var (
 // This function should be called before using the database.
 func Init() {
 	// Prepare the local database copy:
-	if copied, _ := syncDatabaseFile(); copied {
+	if copied, err := syncDatabaseFile(); nil != err {
+		msg := fmt.Sprintf("syncDatabaseFile(): %v", err)
+		logMessage(context.Background(), `error`, "Init()", msg)
+	} else if copied {
 		// Signal for `rDB.reOpen()`:
 		syncCopiedChan <- struct{}{}
 	}
@@ -197,16 +202,148 @@ func having(aEntity string, aID TID) string {
 	if (0 == len(aEntity)) || (`all` == aEntity) || (0 == aID) {
 		return ``
 	}
+	clause, ok := dbHaving[aEntity]
+	if !ok { // e.g. `shelves`, see `shelfFilter()`
+		return ``
+	}
 
-	return fmt.Sprintf(dbHaving[aEntity], aID)
+	return fmt.Sprintf(clause, aID)
 } // having()
 
+// `andWhere()` adds `aCondition` to the WHERE clause of `aClause`.
+//
+// If `aClause` has no WHERE clause (yet) a new one is appended.
+//
+//	`aClause` The query part (e.g. as returned by `having()`) to extend.
+//	`aCondition` The additional condition (if any).
+func andWhere(aClause, aCondition string) string {
+	if 0 == len(aCondition) {
+		return aClause
+	}
+	// The first WHERE belongs to the main query (all others
+	// are part of sub-selects):
+	if pos := strings.Index(aClause, `WHERE `); 0 <= pos {
+		return aClause[:pos] + `WHERE (` + strings.TrimSpace(aClause[pos+6:]) +
+			`) AND ` + aCondition + ` `
+	}
+
+	return aClause + ` WHERE ` + aCondition + ` `
+} // andWhere()
+
+// `allOf()` returns the non-empty `aConditions` combined by `AND`.
+//
+//	`aConditions` The conditions to combine.
+func allOf(aConditions ...string) string {
+	list := make([]string, 0, len(aConditions))
+	for _, cond := range aConditions {
+		if 0 < len(cond) {
+			list = append(list, cond)
+		}
+	}
+
+	return strings.Join(list, ` AND `)
+} // allOf()
+
 // `limit()` returns a LIMIT clause defined by `aStart` and `aLength`.
 func limit(aStart, aLength uint) string {
 	return `LIMIT ` + strconv.FormatInt(int64(aStart), 10) +
 		`,` + strconv.FormatInt(int64(aLength), 10)
 } // limit()
 
+// `readStateFilter()` returns a condition limiting the documents
+// to the reading state selected by `aOptions`.
+//
+// If no user database is configured the filter is ignored.
+//
+//	`aContext` The current web request's context.
+//	`aOptions` The options to configure the query.
+func readStateFilter(aContext context.Context, aOptions *TQueryOptions) (string, error) {
+	if QoReadAll == aOptions.ReadState {
+		return ``, nil
+	}
+	udb, err := OpenUserDatabase(aContext)
+	if nil != err {
+		if errNoUserDB == err {
+			return ``, nil
+		}
+		return ``, err
+	}
+
+	var (
+		ids []TID
+		op  = `IN`
+	)
+	switch aOptions.ReadState {
+	case QoReadUnread:
+		op = `NOT IN`
+		ids, err = udb.BookIDs(aContext, aOptions.User, RsReading, RsFinished)
+	case QoReadReading:
+		ids, err = udb.BookIDs(aContext, aOptions.User, RsReading)
+	case QoReadFinished:
+		ids, err = udb.BookIDs(aContext, aOptions.User, RsFinished)
+	default:
+		return ``, nil
+	}
+	if nil != err {
+		return ``, err
+	}
+
+	return idCondition(op, ids), nil
+} // readStateFilter()
+
+// `shelfFilter()` returns a condition limiting the documents to
+// those on the user's shelf selected by `aOptions`.
+//
+//	`aContext` The current web request's context.
+//	`aOptions` The options to configure the query.
+func shelfFilter(aContext context.Context, aOptions *TQueryOptions) (string, error) {
+	if (`shelves` != aOptions.Entity) || (0 == aOptions.ID) {
+		return ``, nil
+	}
+	udb, err := OpenUserDatabase(aContext)
+	if nil != err {
+		if errNoUserDB == err {
+			return idCondition(`IN`, nil), nil
+		}
+		return ``, err
+	}
+	ids, err := udb.ShelfBookIDs(aContext, aOptions.User, aOptions.ID)
+	if nil != err {
+		return ``, err
+	}
+
+	return idCondition(`IN`, ids), nil
+} // shelfFilter()
+
+// `idCondition()` returns a condition checking the document IDs
+// against `aIDs`.
+//
+//	`aOperator` Either `IN` or `NOT IN`.
+//	`aIDs` The list of document IDs.
+func idCondition(aOperator string, aIDs []TID) string {
+	list := make([]string, len(aIDs))
+	for idx, id := range aIDs {
+		list[idx] = strconv.Itoa(int(id))
+	}
+
+	return `(b.id ` + aOperator + ` (` + strings.Join(list, `,`) + `))`
+} // idCondition()
+
+// `orderClause()` returns the ORDER_BY clause defined by `aOptions`.
+//
+//	`aContext` The current web request's context.
+//	`aOptions` The options to configure the query.
+func orderClause(aContext context.Context, aOptions *TQueryOptions) (string, error) {
+	switch aOptions.SortBy {
+	case qoSortByCustom:
+		return orderByCustom(aOptions.SortCustom, aOptions.Descending), nil
+	case qoSortByDownloads:
+		return downloadOrder(aContext, aOptions.Descending)
+	}
+
+	return orderBy(aOptions.SortBy, aOptions.Descending), nil
+} // orderClause()
+
 // `orderBy()` returns a ORDER_BY clause defined by `aOrder` and `aDesc`.
 //
 // The `aOrder` argument can be one of the following constants:
@@ -757,6 +894,19 @@ func (db *TDataBase) doQueryGrid(aContext context.Context, aQuery string) (rList
 	return
 } // doQueryGrid()
 
+var (
+	// The function to call with the duration of each `query()`.
+	dbQueryObserver atomic.Value
+)
+
+// SetQueryObserver sets a function to be called with the duration
+// of each database query (e.g. to collect metrics).
+//
+//	`aObserver` The function to call after each query.
+func SetQueryObserver(aObserver func(aDuration time.Duration)) {
+	dbQueryObserver.Store(aObserver)
+} // SetQueryObserver()
+
 // `query()` executes a query that returns rows, typically a SELECT.
 // The `args` are for any placeholder parameters in the query.
 //
@@ -773,14 +923,44 @@ func (db *TDataBase) query(aContext context.Context, aQuery string) (rRows *sql.
 			return
 		}
 	}
-	go goSQLtrace(aQuery, time.Now())
+	start := time.Now()
+	go goSQLtrace(aQuery, start)
 
 	rRows, rErr = db.sqlDB.QueryContext(aContext, aQuery)
 	db.Close() // recycle the connection
+	elapsed := time.Since(start)
+	if observer, ok := dbQueryObserver.Load().(func(time.Duration)); ok && (nil != observer) {
+		observer(elapsed)
+	}
+	if nil != rErr {
+		logMessage(aContext, `error`, "TDataBase.query()",
+			fmt.Sprintf("%v: %s", rErr, oneLine(aQuery)))
+	} else {
+		logMessage(aContext, `debug`, "TDataBase.query()",
+			fmt.Sprintf("%v: %s", elapsed, oneLine(aQuery)))
+	}
 
 	return
 } // query()
 
+// Ping runs a simple test query.
+//
+// The method returns either `nil` or the error occurred.
+//
+//	`aContext` The current web request's context.
+func (db *TDataBase) Ping(aContext context.Context) error {
+	rows, err := db.query(aContext, `SELECT id FROM books LIMIT 1`)
+	if nil != err {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		// just read the result
+	}
+
+	return rows.Err()
+} // Ping()
+
 // QueryBy returns all documents according to `aOptions`.
 //
 // The method returns in `rCount` the number of documents found,
@@ -790,9 +970,22 @@ func (db *TDataBase) query(aContext context.Context, aQuery string) (rRows *sql.
 //	`aContext` The current web request's context.
 //	`aOptions` The options to configure the query.
 func (db *TDataBase) QueryBy(aContext context.Context, aOptions *TQueryOptions) (rCount int, rList *TDocList, rErr error) {
-	var rows *sql.Rows
-	rows, rErr = db.query(aContext,
-		dbCountQuery+having(aOptions.Entity, aOptions.ID))
+	var (
+		rows                *sql.Rows
+		order, shelf, state string
+	)
+	if state, rErr = readStateFilter(aContext, aOptions); nil != rErr {
+		return
+	}
+	if shelf, rErr = shelfFilter(aContext, aOptions); nil != rErr {
+		return
+	}
+	if order, rErr = orderClause(aContext, aOptions); nil != rErr {
+		return
+	}
+	where := andWhere(having(aOptions.Entity, aOptions.ID),
+		allOf(shelf, state, restriction(aContext)))
+	rows, rErr = db.query(aContext, dbCountQuery+where)
 	if nil != rErr {
 		return
 	}
@@ -810,14 +1003,14 @@ func (db *TDataBase) QueryBy(aContext context.Context, aOptions *TQueryOptions)
 			if QoLayoutList == aOptions.Layout {
 				rList, rErr = db.doQueryAll(aContext,
 					dbBaseQuery+
-						having(aOptions.Entity, aOptions.ID)+
-						orderBy(aOptions.SortBy, aOptions.Descending)+
+						where+
+						order+
 						limit(aOptions.LimitStart, aOptions.LimitLength))
 			} else {
 				rList, rErr = db.doQueryGrid(aContext,
 					dbGridQuery+
-						having(aOptions.Entity, aOptions.ID)+
-						orderBy(aOptions.SortBy, aOptions.Descending)+
+						where+
+						order+
 						limit(aOptions.LimitStart, aOptions.LimitLength))
 			}
 		}
@@ -828,7 +1021,7 @@ func (db *TDataBase) QueryBy(aContext context.Context, aOptions *TQueryOptions)
 
 const (
 	// see `QueryCustomColumns()`
-	dbCustomColumnsQuery = `SELECT id, label, name, datatype FROM custom_columns `
+	dbCustomColumnsQuery = `SELECT id, label, name, datatype, normalized FROM custom_columns WHERE (mark_for_delete = 0) ORDER BY name `
 )
 
 type (
@@ -838,6 +1031,7 @@ type (
 	TCustomColumn struct {
 		ID                    int
 		Label, Name, Datatype string
+		Normalized            bool // values are stored in a separate table
 	}
 
 	// TCustomColumnList is a list of `TCustomColumn` instances.
@@ -857,7 +1051,7 @@ func (db *TDataBase) QueryCustomColumns(aContext context.Context) (*TCustomColum
 	result := make(TCustomColumnList, 0, 8)
 	for rows.Next() {
 		var cc TCustomColumn
-		if err = rows.Scan(&cc.ID, &cc.Label, &cc.Name, &cc.Datatype); nil == err {
+		if err = rows.Scan(&cc.ID, &cc.Label, &cc.Name, &cc.Datatype, &cc.Normalized); nil == err {
 			result = append(result, cc)
 		}
 
@@ -882,6 +1076,18 @@ FROM books b
 WHERE b.id = `
 )
 
+// `andRestricted()` returns the restriction (if any) of the user
+// of `aContext` to append to a WHERE clause.
+//
+//	`aContext` The current web request's context.
+func andRestricted(aContext context.Context) string {
+	if where := restriction(aContext); 0 < len(where) {
+		return ` AND ` + where
+	}
+
+	return ``
+} // andRestricted()
+
 // QueryDocMini returns the document identified by `aID`.
 //
 // This function fills only the document properties `ID`, `formats`,
@@ -892,7 +1098,8 @@ WHERE b.id = `
 //	`aID` The document ID to lookup.
 func (db *TDataBase) QueryDocMini(aContext context.Context, aID TID) (rDoc *TDocument) {
 	rows, err := db.query(aContext,
-		dbDocMiniQuery+strconv.FormatInt(int64(aID), 10))
+		dbDocMiniQuery+strconv.FormatInt(int64(aID), 10)+
+			andRestricted(aContext))
 	if nil != err {
 		return
 	}
@@ -920,8 +1127,10 @@ func (db *TDataBase) QueryDocument(aContext context.Context, aID TID) *TDocument
 	if list, err := db.doQueryAll(aContext, dbBaseQuery+
 		`WHERE b.id=`+
 		strconv.FormatInt(int64(aID), 10)+
+		andRestricted(aContext)+
 		` LIMIT 1`); (nil == err) && (0 < len(*list)) {
 		doc := (*list)[0]
+		doc.customs = db.queryCustomFields(aContext, aID)
 
 		return &doc
 	}
@@ -929,6 +1138,141 @@ func (db *TDataBase) QueryDocument(aContext context.Context, aID TID) *TDocument
 	return nil
 } // QueryDocument()
 
+type (
+	// `tEntitySQL` holds the SQL snippets to list a certain entity.
+	tEntitySQL struct {
+		list   string // SQL to select ID, name, and document count
+		book   string // the column holding the document ID
+		group  string // SQL to group the selected rows by entity
+		sortBy string // field(s) to sort the entity list by
+	}
+)
+
+var (
+	// `dbEntityQueries` defines the queries used by `QueryEntities()`.
+	dbEntityQueries = map[string]tEntitySQL{
+		`authors`: {
+			list:   `SELECT a.id, a.name, COUNT(bal.book) FROM authors a JOIN books_authors_link bal ON(bal.author = a.id) `,
+			book:   `bal.book`,
+			group:  `GROUP BY a.id `,
+			sortBy: `IFNULL(a.sort, a.name)`,
+		},
+		`languages`: {
+			list:   `SELECT l.id, l.lang_code, COUNT(bll.book) FROM languages l JOIN books_languages_link bll ON(bll.lang_code = l.id) `,
+			book:   `bll.book`,
+			group:  `GROUP BY l.id `,
+			sortBy: `l.lang_code`,
+		},
+		`publisher`: {
+			list:   `SELECT p.id, p.name, COUNT(bpl.book) FROM publishers p JOIN books_publishers_link bpl ON(bpl.publisher = p.id) `,
+			book:   `bpl.book`,
+			group:  `GROUP BY p.id `,
+			sortBy: `IFNULL(p.sort, p.name)`,
+		},
+		`series`: {
+			list:   `SELECT s.id, s.name, COUNT(bsl.book) FROM series s JOIN books_series_link bsl ON(bsl.series = s.id) `,
+			book:   `bsl.book`,
+			group:  `GROUP BY s.id `,
+			sortBy: `IFNULL(s.sort, s.name)`,
+		},
+		`tags`: {
+			list:   `SELECT t.id, t.name, COUNT(btl.book) FROM tags t JOIN books_tags_link btl ON(btl.tag = t.id) `,
+			book:   `btl.book`,
+			group:  `GROUP BY t.id `,
+			sortBy: `t.name`,
+		},
+	}
+)
+
+// `entityInitial()` returns the SQL WHERE clause to limit the entity
+// rows to those whose sort field `aSortBy` starts with `aInitial`.
+//
+// The special initial `#` selects all rows not starting with
+// a letter `A` to `Z`.
+//
+//	`aSortBy` The field(s) the entity list is sorted by.
+//	`aInitial` The first letter of the entities to select.
+func entityInitial(aSortBy, aInitial string) string {
+	if 0 == len(aInitial) {
+		return ``
+	}
+	first := `UPPER(SUBSTR(` + aSortBy + `, 1, 1))`
+	if `#` == aInitial {
+		return `WHERE ` + first + ` NOT BETWEEN 'A' AND 'Z' `
+	}
+	letter := strings.ToUpper(string([]rune(aInitial)[0]))
+
+	return `WHERE ` + first + ` = '` + strings.Replace(letter, `'`, `''`, -1) + `' `
+} // entityInitial()
+
+// QueryEntities returns a list of all `aEntity` rows used by at least
+// one document, sorted either alphabetically or by their number of
+// documents.
+//
+// The method returns in `rCount` the number of entities found,
+// in `rList` either `nil` or a list of entities (with their
+// respective number of documents in the `Count` field),
+// in `rErr` either `nil` or the error occurred during the search.
+//
+//	`aContext` The current web request's context.
+//	`aEntity` The entity to list (e.g. `authors`, `series`, `tags`).
+//	`aInitial` If not empty only entities starting with this letter.
+//	`aByCount` Whether to sort by the number of documents.
+//	`aStart` The number of the first entity to return.
+//	`aLength` The max. number of entities to return.
+func (db *TDataBase) QueryEntities(aContext context.Context, aEntity, aInitial string, aByCount bool, aStart, aLength uint) (rCount int, rList *TEntityList, rErr error) {
+	eSQL, ok := dbEntityQueries[aEntity]
+	if !ok {
+		rErr = fmt.Errorf("QueryEntities(): unknown entity '%s'", aEntity)
+		return
+	}
+	selection := eSQL.list +
+		andWhere(entityInitial(eSQL.sortBy, aInitial), restrictedBooks(aContext, eSQL.book)) +
+		eSQL.group
+
+	var rows *sql.Rows
+	if rows, rErr = db.query(aContext, `SELECT COUNT(*) FROM (`+selection+`)`); nil != rErr {
+		return
+	}
+	if rows.Next() {
+		_ = rows.Scan(&rCount)
+	}
+	_ = rows.Close()
+	if 0 == rCount {
+		return
+	}
+
+	order := ` ORDER BY ` + eSQL.sortBy + ` `
+	if aByCount {
+		order = ` ORDER BY 3 DESC, ` + eSQL.sortBy + ` `
+	}
+	if rows, rErr = db.query(aContext, selection+order+
+		limit(aStart, aLength)); nil != rErr {
+		return
+	}
+	defer rows.Close()
+
+	result := make(TEntityList, 0, aLength)
+	for rows.Next() {
+		var ent TEntity
+		if err := rows.Scan(&ent.ID, &ent.Name, &ent.Count); nil != err {
+			continue
+		}
+		ent.URL = fmt.Sprintf("/%s/%d/%s", aEntity, ent.ID, url.PathEscape(ent.Name))
+
+		select {
+		case <-aContext.Done():
+			rErr = aContext.Err()
+			return
+		default:
+			result = append(result, ent)
+		}
+	}
+	rList = &result
+
+	return
+} // QueryEntities()
+
 const (
 	// see `QueryIDs()`
 	dbIDQuery = `SELECT id, path FROM books `
@@ -975,9 +1319,19 @@ func (db *TDataBase) QueryIDs(aContext context.Context) (rList *TDocList, rErr e
 //	`aContext` The current request's context.
 //	`aOptions` The options to configure the query.
 func (db *TDataBase) QuerySearch(aContext context.Context, aOptions *TQueryOptions) (rCount int, rList *TDocList, rErr error) {
-	var rows *sql.Rows
-	where := NewSearch(aOptions.Matching)
-	if rows, rErr = db.query(aContext, dbCountQuery+where.Clause()); nil != rErr {
+	var (
+		rows         *sql.Rows
+		order, state string
+	)
+	if state, rErr = readStateFilter(aContext, aOptions); nil != rErr {
+		return
+	}
+	if order, rErr = orderClause(aContext, aOptions); nil != rErr {
+		return
+	}
+	where := andWhere(NewSearch(aOptions.Matching).Clause(),
+		allOf(state, restriction(aContext)))
+	if rows, rErr = db.query(aContext, dbCountQuery+where); nil != rErr {
 		return
 	}
 	defer rows.Close()
@@ -995,14 +1349,14 @@ func (db *TDataBase) QuerySearch(aContext context.Context, aOptions *TQueryOptio
 			if QoLayoutList == aOptions.Layout {
 				rList, rErr = db.doQueryAll(aContext,
 					dbBaseQuery+
-						where.Clause()+
-						orderBy(aOptions.SortBy, aOptions.Descending)+
+						where+
+						order+
 						limit(aOptions.LimitStart, aOptions.LimitLength))
 			} else {
 				rList, rErr = db.doQueryGrid(aContext,
 					dbGridQuery+
-						where.Clause()+
-						orderBy(aOptions.SortBy, aOptions.Descending)+
+						where+
+						order+
 						limit(aOptions.LimitStart, aOptions.LimitLength))
 			}
 		}
@@ -1011,6 +1365,79 @@ func (db *TDataBase) QuerySearch(aContext context.Context, aOptions *TQueryOptio
 	return
 } // QuerySearch()
 
+const (
+	// see `QuerySuggestions()`; the `%[1]s` placeholders get
+	// replaced by the LIKE pattern(s) to match.
+	dbSuggestionsQuery = `SELECT 'authors', a.id, a.name, COUNT(bal.book) AS cnt FROM authors a JOIN books_authors_link bal ON(bal.author = a.id) WHERE %[1]s GROUP BY a.id
+UNION ALL SELECT 'publisher', p.id, p.name, COUNT(bpl.book) AS cnt FROM publishers p JOIN books_publishers_link bpl ON(bpl.publisher = p.id) WHERE %[2]s GROUP BY p.id
+UNION ALL SELECT 'series', s.id, s.name, COUNT(bsl.book) AS cnt FROM series s JOIN books_series_link bsl ON(bsl.series = s.id) WHERE %[3]s GROUP BY s.id
+UNION ALL SELECT 'tags', t.id, t.name, COUNT(btl.book) AS cnt FROM tags t JOIN books_tags_link btl ON(btl.tag = t.id) WHERE %[4]s GROUP BY t.id
+UNION ALL SELECT 'title', b.id, b.title, 1 AS cnt FROM books b WHERE %[5]s
+ORDER BY cnt DESC, 3 `
+)
+
+// QuerySuggestions returns a list of author, publisher, series, tag,
+// and title names starting with `aPrefix`.
+//
+// The entities are ordered by their respective number of documents;
+// their `URL` field starts with the entity's name (e.g. `/authors/`)
+// while titles link to the respective document page.
+//
+//	`aContext` The current web request's context.
+//	`aPrefix` The start of the names to lookup.
+//	`aLimit` The max. number of suggestions to return.
+func (db *TDataBase) QuerySuggestions(aContext context.Context, aPrefix string, aLimit uint) (rList *TEntityList, rErr error) {
+	if aPrefix = strings.TrimSpace(aPrefix); 0 == len(aPrefix) {
+		return
+	}
+	term := likeQuote(aPrefix)
+	match := func(aField, aBook string) string {
+		// match either the start of the field or the start of a word
+		// of the documents visible to the current user:
+		return allOf(`((`+aField+` LIKE '`+term+`%' ESCAPE '\') OR (`+
+			aField+` LIKE '% `+term+`%' ESCAPE '\'))`,
+			restrictedBooks(aContext, aBook))
+	} // match()
+
+	var rows *sql.Rows
+	if rows, rErr = db.query(aContext, fmt.Sprintf(dbSuggestionsQuery,
+		match(`a.name`, `bal.book`), match(`p.name`, `bpl.book`),
+		match(`s.name`, `bsl.book`), match(`t.name`, `btl.book`),
+		match(`b.title`, `b.id`))+
+		limit(0, aLimit)); nil != rErr {
+		return
+	}
+	defer rows.Close()
+
+	result := make(TEntityList, 0, aLimit)
+	for rows.Next() {
+		var (
+			ent  TEntity
+			kind string
+		)
+		if err := rows.Scan(&kind, &ent.ID, &ent.Name, &ent.Count); nil != err {
+			continue
+		}
+		if `title` == kind {
+			ent.Count = 0
+			ent.URL = fmt.Sprintf("/doc/%d/doc.html", ent.ID)
+		} else {
+			ent.URL = fmt.Sprintf("/%s/%d/%s", kind, ent.ID, url.PathEscape(ent.Name))
+		}
+
+		select {
+		case <-aContext.Done():
+			rErr = aContext.Err()
+			return
+		default:
+			result = append(result, ent)
+		}
+	}
+	rList = &result
+
+	return
+} // QuerySuggestions()
+
 // `reOpen()` checks whether the SQLite database file has changed
 // since the last access.
 // If so, the current database connection is closed and a new one
@@ -17,6 +17,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -36,6 +37,55 @@ func openDBforTesting(aContext context.Context) *TDataBase {
 	return result
 } // openDBforTesting()
 
+func Test_andWhere(t *testing.T) {
+	type args struct {
+		aClause    string
+		aCondition string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{``, ``}, ``},
+		{" 2", args{``, `(b.id IN (1,2))`}, ` WHERE (b.id IN (1,2)) `},
+		{" 3", args{having(`series`, 3), `(b.id IN (1))`},
+			`JOIN books_series_link s ON(s.book = b.id) WHERE ((s.series = 3)) AND (b.id IN (1)) `},
+		{" 4", args{` WHERE (a = 1) OR (b = 2)`, `(b.id NOT IN ())`},
+			` WHERE ((a = 1) OR (b = 2)) AND (b.id NOT IN ()) `},
+		{" 5", args{having(`tags`, 1), ``}, having(`tags`, 1)},
+		{" 6", args{having(`shelves`, 2), `(b.id IN (7))`}, ` WHERE (b.id IN (7)) `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := andWhere(tt.args.aClause, tt.args.aCondition); got != tt.want {
+				t.Errorf("andWhere() = '%v',\nwant '%v'", got, tt.want)
+			}
+		})
+	}
+} // Test_andWhere()
+
+func Test_allOf(t *testing.T) {
+	tests := []struct {
+		name        string
+		aConditions []string
+		want        string
+	}{
+		// TODO: Add test cases.
+		{" 1", nil, ``},
+		{" 2", []string{``, `(a)`, ``}, `(a)`},
+		{" 3", []string{`(a)`, ``, `(b)`}, `(a) AND (b)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allOf(tt.aConditions...); got != tt.want {
+				t.Errorf("allOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_allOf()
+
 func Test_prepAuthors(t *testing.T) {
 	w0 := &tAuthorList{}
 	a1 := "Willy Wichtig|1"
@@ -542,6 +592,79 @@ func TestTDataBase_QueryDocument(t *testing.T) {
 	}
 } // TestTDataBase_QueryDocument()
 
+func Test_entityInitial(t *testing.T) {
+	type args struct {
+		aSortBy  string
+		aInitial string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`t.name`, ``}, ``},
+		{" 2", args{`t.name`, `a`}, `WHERE UPPER(SUBSTR(t.name, 1, 1)) = 'A' `},
+		{" 3", args{`t.name`, `#`}, `WHERE UPPER(SUBSTR(t.name, 1, 1)) NOT BETWEEN 'A' AND 'Z' `},
+		{" 4", args{`t.name`, `'x`}, `WHERE UPPER(SUBSTR(t.name, 1, 1)) = '''' `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := entityInitial(tt.args.aSortBy, tt.args.aInitial); got != tt.want {
+				t.Errorf("entityInitial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_entityInitial()
+
+func TestTDataBase_QueryEntities(t *testing.T) {
+	ctx := context.TODO()
+	dbHandle := openDBforTesting(ctx)
+
+	type args struct {
+		aContext context.Context
+		aEntity  string
+		aInitial string
+		aByCount bool
+		aStart   uint
+		aLength  uint
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantCount bool // rCount > 0
+		wantErr   bool
+	}{
+		// TODO: Add test cases.
+		{" 1", args{ctx, "authors", "", false, 0, 50}, true, false},
+		{" 2", args{ctx, "languages", "", false, 0, 50}, true, false},
+		{" 3", args{ctx, "publisher", "", false, 0, 50}, true, false},
+		{" 4", args{ctx, "series", "", false, 0, 50}, true, false},
+		{" 5", args{ctx, "tags", "", false, 0, 50}, true, false},
+		{" 6", args{ctx, "format", "", false, 0, 50}, false, true},
+		{" 7", args{ctx, "", "", false, 0, 50}, false, true},
+		{" 8", args{ctx, "authors", "", true, 0, 50}, true, false},
+		{" 9", args{ctx, "tags", "#", false, 0, 50}, false, false},
+		{"10", args{ctx, "authors", "'", false, 0, 50}, false, false},
+		{"11", args{ctx, "authors", "p", false, 0, 50}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRCount, gotRList, err := dbHandle.QueryEntities(tt.args.aContext, tt.args.aEntity, tt.args.aInitial, tt.args.aByCount, tt.args.aStart, tt.args.aLength)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TDataBase.QueryEntities() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (0 < gotRCount) != tt.wantCount {
+				t.Errorf("TDataBase.QueryEntities() gotRCount = %v, want %v", gotRCount, tt.wantCount)
+			}
+			if tt.wantCount && ((nil == gotRList) || (0 == len(*gotRList))) {
+				t.Errorf("TDataBase.QueryEntities() gotRList = %v", gotRList)
+			}
+		})
+	}
+} // TestTDataBase_QueryEntities()
+
 func TestTDataBase_QueryIDs(t *testing.T) {
 	ctx := context.TODO()
 	dbHandle := openDBforTesting(ctx)
@@ -624,3 +747,68 @@ func TestTDataBase_QuerySearch(t *testing.T) {
 		})
 	}
 } // TestTDataBase_QuerySearch()
+
+func TestTDataBase_QuerySuggestions(t *testing.T) {
+	ctx := context.TODO()
+	dbHandle := openDBforTesting(ctx)
+
+	type args struct {
+		aContext context.Context
+		aPrefix  string
+		aLimit   uint
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantRList bool // *TEntityList
+		wantErr   bool
+	}{
+		// TODO: Add test cases.
+		{" 0", args{ctx, "", 10}, false, false},
+		{" 1", args{ctx, "a", 10}, true, false},
+		{" 2", args{ctx, `'; DROP TABLE books; --`, 10}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRList, err := dbHandle.QuerySuggestions(tt.args.aContext, tt.args.aPrefix, tt.args.aLimit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TDataBase.QuerySuggestions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (nil != gotRList) != tt.wantRList {
+				t.Errorf("TDataBase.QuerySuggestions() = %v, want %v", gotRList, tt.wantRList)
+			}
+			if (nil != gotRList) && (uint(len(*gotRList)) > tt.args.aLimit) {
+				t.Errorf("TDataBase.QuerySuggestions() = %d items, want max. %d", len(*gotRList), tt.args.aLimit)
+			}
+		})
+	}
+} // TestTDataBase_QuerySuggestions()
+
+func TestSetQueryObserver(t *testing.T) {
+	ctx := context.TODO()
+	dbHandle := openDBforTesting(ctx)
+	defer SetQueryObserver(nil)
+
+	var count int
+	SetQueryObserver(func(aDuration time.Duration) {
+		if 0 <= aDuration {
+			count++
+		}
+	})
+	_ = dbHandle.QueryDocMini(ctx, 1)
+	if 1 != count {
+		t.Errorf("SetQueryObserver() observed %d queries, want 1", count)
+	}
+} // TestSetQueryObserver()
+
+func TestTDataBase_Ping(t *testing.T) {
+	ctx := context.TODO()
+	dbHandle := openDBforTesting(ctx)
+	if err := dbHandle.Ping(ctx); nil != err {
+		t.Errorf("TDataBase.Ping() error = %v", err)
+	}
+	if err := CheckCopy(); nil != err {
+		t.Errorf("CheckCopy() error = %v", err)
+	}
+} // TestTDataBase_Ping()
@@ -9,12 +9,14 @@ package db
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	// sqlite "github.com/mattn/go-sqlite3"
 )
@@ -43,6 +45,21 @@ var (
 	// Guard against parallel database copies.
 	syncCopyMtx = new(sync.Mutex)
 
+	// The generation (i.e. modification time) of the database copy.
+	syncGeneration int64
+
+	// The number of database copies made.
+	syncCopies int64
+
+	// The number of failed database syncs.
+	syncFailures int64
+
+	// The time (in nanoseconds) the database was copied last.
+	syncLastCopy int64
+
+	// The error message of the latest sync (empty if it succeeded).
+	syncLastError atomic.Value
+
 	// The channel to send SQL to and read trace messages from.
 	syncSQLTraceChannel = make(chan string, 127)
 
@@ -64,7 +81,12 @@ func goSyncFile() {
 	for {
 		select {
 		case <-timer.C:
-			if copied, err := syncDatabaseFile(); copied && (nil == err) {
+			if copied, err := syncDatabaseFile(); nil != err {
+				msg := fmt.Sprintf("syncDatabaseFile(): %v", err)
+				logMessage(context.Background(), `error`, "goSyncFile()", msg)
+			} else if copied {
+				logMessage(context.Background(), `info`, "goSyncFile()",
+					"copied the Calibre database")
 				syncCopiedChan <- struct{}{}
 			}
 			_ = timer.Reset(time.Minute)
@@ -83,12 +105,19 @@ func goSQLtrace(aQuery string, aWhen time.Time) {
 	if 0 == len(syncSQLTraceFile) {
 		return
 	}
+	syncSQLTraceChannel <- aWhen.Format(`2006-01-02 15:04:05.000 `) +
+		oneLine(aQuery)
+} // goSQLtrace()
+
+// `oneLine()` returns `aQuery` as a single line.
+//
+//	`aQuery` The SQL query to convert.
+func oneLine(aQuery string) string {
 	aQuery = strings.Replace(aQuery, "\t", ` `, -1)
 	aQuery = strings.Replace(aQuery, "\n", ` `, -1)
 
-	syncSQLTraceChannel <- aWhen.Format(`2006-01-02 15:04:05.000 `) +
-		strings.Replace(aQuery, `  `, ` `, -1)
-} // goSQLtrace()
+	return strings.Replace(aQuery, `  `, ` `, -1)
+} // oneLine()
 
 const (
 	// Timer interval to wait for trace file closing after inactivity.
@@ -96,6 +125,9 @@ const (
 
 	// Mode of opening the logfile(s).
 	syncOpenFlags = os.O_CREATE | os.O_APPEND | os.O_WRONLY | os.O_SYNC
+
+	// The first bytes of an SQLite database file.
+	syncSQLiteHeader = "SQLite format 3\x00"
 )
 
 // `goWriteSQLtrace()` performs the actual file writes.
@@ -202,6 +234,15 @@ func SQLtraceFile() string {
 	return syncSQLTraceFile
 } // SQLtraceFile()
 
+// DatabaseGeneration returns a value identifying the currently used
+// copy of Calibre's database file.
+//
+// The value changes whenever the database file gets copied again
+// so it can be used e.g. to invalidate cached pages.
+func DatabaseGeneration() int64 {
+	return atomic.LoadInt64(&syncGeneration)
+} // DatabaseGeneration()
+
 // `syncDatabaseFile()` copies Calibre's original database file
 // to the configured cache directory.
 //
@@ -221,6 +262,15 @@ func syncDatabaseFile() (rCopied bool, rErr error) {
 		if nil != tmpFile {
 			_ = tmpFile.Close()
 		}
+		if nil != rErr {
+			atomic.AddInt64(&syncFailures, 1)
+			syncLastError.Store(rErr.Error())
+			return
+		}
+		syncLastError.Store(``)
+		if rCopied {
+			atomic.AddInt64(&syncCopies, 1)
+		}
 	}()
 	syncCopyMtx.Lock()
 	defer syncCopyMtx.Unlock()
@@ -233,6 +283,7 @@ func syncDatabaseFile() (rCopied bool, rErr error) {
 	dstName := filepath.Join(dbCalibreCachePath, dbCalibreDatabaseFilename)
 	if dstFI, rErr = os.Stat(dstName); nil == rErr {
 		if srcFI.ModTime().Before(dstFI.ModTime()) {
+			atomic.CompareAndSwapInt64(&syncGeneration, 0, dstFI.ModTime().UnixNano())
 			return
 		}
 	}
@@ -251,9 +302,73 @@ func syncDatabaseFile() (rCopied bool, rErr error) {
 	}
 	go goSQLtrace(`-- copied `+srcName+` to `+dstName, time.Now())
 
-	return true, os.Rename(tmpName, dstName)
+	if rErr = os.Rename(tmpName, dstName); nil != rErr {
+		return
+	}
+	if dstFI, rErr = os.Stat(dstName); nil == rErr {
+		atomic.StoreInt64(&syncGeneration, dstFI.ModTime().UnixNano())
+	}
+	atomic.StoreInt64(&syncLastCopy, time.Now().UnixNano())
+
+	return true, rErr
 } // syncDatabaseFile()
 
+type (
+	// TSyncStatus is the state of the copied `Calibre` database.
+	TSyncStatus struct {
+		Copied    time.Time // the time of the latest copy (zero if none)
+		Copies    int64     // number of database copies made
+		CopyMod   time.Time // modification time of the database copy
+		Failures  int64     // number of failed syncs
+		LastError string    // the latest sync's error (empty if none)
+		SourceMod time.Time // modification time of the original database
+	}
+)
+
+// SyncStatus returns the state of the copied `Calibre` database.
+//
+// The modification times are zero if the respective file can't
+// be accessed.
+func SyncStatus() (rStatus TSyncStatus) {
+	if last := atomic.LoadInt64(&syncLastCopy); 0 < last {
+		rStatus.Copied = time.Unix(0, last)
+	}
+	rStatus.Copies = atomic.LoadInt64(&syncCopies)
+	rStatus.Failures = atomic.LoadInt64(&syncFailures)
+	rStatus.LastError, _ = syncLastError.Load().(string)
+	if fi, err := os.Stat(filepath.Join(dbCalibreLibraryPath, dbCalibreDatabaseFilename)); nil == err {
+		rStatus.SourceMod = fi.ModTime()
+	}
+	if fi, err := os.Stat(filepath.Join(dbCalibreCachePath, dbCalibreDatabaseFilename)); nil == err {
+		rStatus.CopyMod = fi.ModTime()
+	}
+
+	return
+} // SyncStatus()
+
+// CheckCopy reports whether the copy of `Calibre's` database
+// exists and is a readable SQLite database file.
+//
+// The function returns either `nil` or the error found.
+func CheckCopy() error {
+	fName := filepath.Join(dbCalibreCachePath, dbCalibreDatabaseFilename)
+	file, err := os.OpenFile(fName, os.O_RDONLY, 0) /* #nosec G304 */
+	if nil != err {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(syncSQLiteHeader))
+	if _, err = io.ReadFull(file, header); nil != err {
+		return fmt.Errorf("%s: %w", fName, err)
+	}
+	if syncSQLiteHeader != string(header) {
+		return fmt.Errorf("%s: not an SQLite database", fName)
+	}
+
+	return nil
+} // CheckCopy()
+
 /*
 func syncBackupDataBase() (bool, error) {
 	syncCopyMtx.Lock()
@@ -0,0 +1,61 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCopy(t *testing.T) {
+	saved := dbCalibreCachePath
+	defer func() { dbCalibreCachePath = saved }()
+	dbCalibreCachePath = t.TempDir()
+	fName := filepath.Join(dbCalibreCachePath, dbCalibreDatabaseFilename)
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, true}, // missing file
+		{" 2", `SQLite`, true},
+		{" 3", `no database at all`, true},
+		{" 4", syncSQLiteHeader + `some pages`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if 0 < len(tt.data) {
+				_ = ioutil.WriteFile(fName, []byte(tt.data), 0600)
+			}
+			if err := CheckCopy(); (nil != err) != tt.wantErr {
+				t.Errorf("CheckCopy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+} // TestCheckCopy()
+
+func TestSyncStatus(t *testing.T) {
+	saved := dbCalibreLibraryPath
+	defer func() { dbCalibreLibraryPath = saved }()
+	dbCalibreLibraryPath = t.TempDir() // without a database file
+
+	before := SyncStatus()
+	if _, err := syncDatabaseFile(); nil == err {
+		t.Fatal("syncDatabaseFile() error = nil, want an error")
+	}
+	got := SyncStatus()
+	if (before.Failures+1 != got.Failures) || (0 == len(got.LastError)) {
+		t.Errorf("SyncStatus() = %v, want one more failure and an error", got)
+	}
+} // TestSyncStatus()
+
+/* _EoF_ */
@@ -0,0 +1,214 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the users' API tokens stored in Kaliber's own
+ * database (see `userdb.go`).
+ *
+ * Only a hash of each token is stored; the token itself is shown
+ * just once when it's created.
+ */
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+type (
+	// TToken is a user's API token (without the secret itself).
+	TToken struct {
+		ID      int64
+		Created time.Time
+		Expires time.Time // zero if the token never expires
+		Name    string
+		Scope   string    // `TokenScopeCatalog` or `TokenScopeDownload`
+		Used    time.Time // zero if the token wasn't used (yet)
+		User    string
+	}
+)
+
+// The scopes of the API tokens.
+const (
+	// TokenScopeCatalog allows read-only access to the catalog.
+	TokenScopeCatalog = `catalog`
+
+	// TokenScopeDownload allows downloads in addition to the catalog.
+	TokenScopeDownload = `download`
+)
+
+var (
+	// ErrTokenScope is returned if an unknown token scope is used.
+	ErrTokenScope = errors.New(`invalid token scope`)
+
+	// ErrTokenUnknown is returned if a token doesn't exist or is expired.
+	ErrTokenUnknown = errors.New(`unknown or expired token`)
+)
+
+// `hashToken()` returns the hash stored for `aToken`.
+//
+//	`aToken` The token to hash.
+func hashToken(aToken string) string {
+	sum := sha256.Sum256([]byte(aToken))
+
+	return hex.EncodeToString(sum[:])
+} // hashToken()
+
+// `scanToken()` reads a `TToken` from `aRow`.
+//
+//	`aRow` The result row to scan.
+func scanToken(aRow interface{ Scan(...interface{}) error }) (*TToken, error) {
+	var (
+		expires, used sql.NullTime
+		result        TToken
+	)
+	if err := aRow.Scan(&result.ID, &result.User, &result.Name, &result.Scope,
+		&result.Created, &expires, &used); nil != err {
+		return nil, err
+	}
+	result.Expires, result.Used = expires.Time, used.Time
+
+	return &result, nil
+} // scanToken()
+
+// `tokenColumns` are the columns read by `scanToken()`.
+const tokenColumns = `id, user, name, scope, created, expires, used`
+
+// CreateToken adds a new API token for `aUser` and returns the
+// token's secret.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the token's owner.
+//	`aName` A name (e.g. the client app) to identify the token.
+//	`aScope` The token's scope (`TokenScopeCatalog` or `TokenScopeDownload`).
+//	`aExpires` The token's expiry (zero for no expiry).
+func (udb *TUserDB) CreateToken(aContext context.Context, aUser, aName, aScope string, aExpires time.Time) (string, error) {
+	if (TokenScopeCatalog != aScope) && (TokenScopeDownload != aScope) {
+		return ``, ErrTokenScope
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); nil != err {
+		return ``, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	var expires sql.NullTime
+	if !aExpires.IsZero() {
+		expires = sql.NullTime{Time: aExpires, Valid: true}
+	}
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`INSERT INTO tokens (user, name, hash, scope, created, expires) VALUES (?, ?, ?, ?, ?, ?)`,
+		aUser, strings.TrimSpace(aName), hashToken(token), aScope, time.Now(), expires)
+	if nil != err {
+		return ``, err
+	}
+
+	return token, nil
+} // CreateToken()
+
+// RevokeToken removes an API token.
+//
+// If `aUser` is empty any user's token is removed (e.g. by the
+// administrator), otherwise only `aUser`'s own token.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the token's owner.
+//	`aID` The ID of the token to remove.
+func (udb *TUserDB) RevokeToken(aContext context.Context, aUser string, aID int64) error {
+	res, err := udb.sqlDB.ExecContext(aContext,
+		`DELETE FROM tokens WHERE (id = ?1) AND ((?2 = '') OR (user = ?2))`, aID, aUser)
+	if nil != err {
+		return err
+	}
+	if n, _ := res.RowsAffected(); 0 == n {
+		return ErrTokenUnknown
+	}
+
+	return nil
+} // RevokeToken()
+
+// RevokeTokens removes all API tokens of `aUser` (e.g. when the
+// user is deleted) and returns the number of removed tokens.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the tokens' owner.
+func (udb *TUserDB) RevokeTokens(aContext context.Context, aUser string) (int64, error) {
+	if 0 == len(aUser) {
+		return 0, ErrTokenUnknown
+	}
+	res, err := udb.sqlDB.ExecContext(aContext,
+		`DELETE FROM tokens WHERE (user = ?)`, aUser)
+	if nil != err {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+} // RevokeTokens()
+
+// TokenByValue returns the (valid) API token `aToken`.
+//
+// The token's last usage is updated (at most once per minute).
+//
+//	`aContext` The current web request's context.
+//	`aToken` The token's secret.
+func (udb *TUserDB) TokenByValue(aContext context.Context, aToken string) (*TToken, error) {
+	now := time.Now()
+	result, err := scanToken(udb.sqlDB.QueryRowContext(aContext,
+		`SELECT `+tokenColumns+` FROM tokens WHERE (hash = ?)`, hashToken(aToken)))
+	if nil != err {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTokenUnknown
+		}
+		return nil, err
+	}
+	if (!result.Expires.IsZero()) && result.Expires.Before(now) {
+		return nil, ErrTokenUnknown
+	}
+	if now.Sub(result.Used) > time.Minute {
+		result.Used = now
+		_, err = udb.sqlDB.ExecContext(aContext,
+			`UPDATE tokens SET used = ? WHERE (id = ?)`, now, result.ID)
+	}
+
+	return result, err
+} // TokenByValue()
+
+// Tokens returns the API tokens of `aUser` (or of all users if
+// `aUser` is empty).
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the tokens' owner.
+func (udb *TUserDB) Tokens(aContext context.Context, aUser string) ([]TToken, error) {
+	rows, err := udb.sqlDB.QueryContext(aContext,
+		`SELECT `+tokenColumns+` FROM tokens WHERE (?1 = '') OR (user = ?1) ORDER BY user, created`,
+		aUser)
+	if nil != err {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []TToken
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, *token)
+	}
+
+	return result, rows.Err()
+} // Tokens()
+
+/* _EoF_ */
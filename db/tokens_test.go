@@ -0,0 +1,114 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTUserDB_Tokens(t *testing.T) {
+	udb := openTestUserDB(t)
+	ctx := context.TODO()
+
+	if _, err := udb.CreateToken(ctx, `alice`, `tablet`, `admin`, time.Time{}); ErrTokenScope != err {
+		t.Errorf("CreateToken(admin) error = %v, want %v", err, ErrTokenScope)
+	}
+	t1, err := udb.CreateToken(ctx, `alice`, ` tablet `, TokenScopeCatalog, time.Time{})
+	if nil != err {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	t2, _ := udb.CreateToken(ctx, `alice`, `script`, TokenScopeDownload, time.Now().Add(time.Hour))
+	t3, _ := udb.CreateToken(ctx, `bob`, `old`, TokenScopeCatalog, time.Now().Add(-time.Hour))
+	if (t1 == t2) || (32 != len(t1)) {
+		t.Errorf("CreateToken() = %q, %q", t1, t2)
+	}
+
+	tok, err := udb.TokenByValue(ctx, t1)
+	if (nil != err) || (`alice` != tok.User) || (`tablet` != tok.Name) ||
+		(TokenScopeCatalog != tok.Scope) || (!tok.Expires.IsZero()) || tok.Used.IsZero() {
+		t.Errorf("TokenByValue(t1) = %v, %v", tok, err)
+	}
+	if tok, err = udb.TokenByValue(ctx, t2); (nil != err) || (TokenScopeDownload != tok.Scope) {
+		t.Errorf("TokenByValue(t2) = %v, %v", tok, err)
+	}
+	if _, err = udb.TokenByValue(ctx, t3); ErrTokenUnknown != err {
+		t.Errorf("TokenByValue(expired) error = %v, want %v", err, ErrTokenUnknown)
+	}
+	if _, err = udb.TokenByValue(ctx, `bogus`); ErrTokenUnknown != err {
+		t.Errorf("TokenByValue(bogus) error = %v, want %v", err, ErrTokenUnknown)
+	}
+
+	list, _ := udb.Tokens(ctx, `alice`)
+	if 2 != len(list) {
+		t.Fatalf("Tokens(alice) = %v, want 2 tokens", list)
+	}
+	if all, _ := udb.Tokens(ctx, ``); 3 != len(all) {
+		t.Errorf("Tokens() = %v, want 3 tokens", all)
+	}
+
+	// Users can't revoke other users' tokens:
+	if err = udb.RevokeToken(ctx, `bob`, list[0].ID); ErrTokenUnknown != err {
+		t.Errorf("RevokeToken(bob) error = %v, want %v", err, ErrTokenUnknown)
+	}
+	if err = udb.RevokeToken(ctx, `alice`, list[0].ID); nil != err {
+		t.Errorf("RevokeToken(alice) error = %v", err)
+	}
+	if err = udb.RevokeToken(ctx, ``, list[1].ID); nil != err {
+		t.Errorf("RevokeToken() error = %v", err)
+	}
+	if _, err = udb.TokenByValue(ctx, t1); ErrTokenUnknown != err {
+		t.Errorf("TokenByValue(revoked) error = %v, want %v", err, ErrTokenUnknown)
+	}
+	if list, _ = udb.Tokens(ctx, `alice`); 0 != len(list) {
+		t.Errorf("Tokens(alice) = %v, want none", list)
+	}
+} // TestTUserDB_Tokens()
+
+func TestTUserDB_RevokeTokens(t *testing.T) {
+	udb := openTestUserDB(t)
+	ctx := context.TODO()
+	t1, _ := udb.CreateToken(ctx, `alice`, `tablet`, TokenScopeCatalog, time.Time{})
+	_, _ = udb.CreateToken(ctx, `alice`, `script`, TokenScopeDownload, time.Time{})
+	t3, _ := udb.CreateToken(ctx, `bob`, `tablet`, TokenScopeCatalog, time.Time{})
+
+	tests := []struct {
+		name    string
+		user    string
+		want    int64
+		wantErr bool
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, 0, true},
+		{" 2", `carol`, 0, false},
+		{" 3", `alice`, 2, false},
+		{" 4", `alice`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := udb.RevokeTokens(ctx, tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RevokeTokens() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("RevokeTokens() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := udb.TokenByValue(ctx, t1); ErrTokenUnknown != err {
+		t.Errorf("TokenByValue(alice) error = %v, want %v", err, ErrTokenUnknown)
+	}
+	if _, err := udb.TokenByValue(ctx, t3); nil != err {
+		t.Errorf("TokenByValue(bob) error = %v", err)
+	}
+} // TestTUserDB_RevokeTokens()
+
+/* _EoF_ */
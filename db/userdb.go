@@ -0,0 +1,415 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+/*
+ * This file provides the access to Kaliber's own database storing
+ * the users' reading state, bookmarks, shelves, API tokens, and the
+ * download statistics.
+ *
+ * Other than the `Calibre` database (which is used read-only) this
+ * database belongs to Kaliber and is written to.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// TReadState is a user's reading state of a document.
+	TReadState uint8
+
+	// TReadingState is a user's reading progress of a document.
+	TReadingState struct {
+		Book     TID
+		Finished time.Time // zero if not finished (yet)
+		Position string    // the last reading position (i.e. the reader's URL)
+		Started  time.Time // zero if not started (yet)
+		State    TReadState
+		Updated  time.Time
+	}
+
+	// TBookmark is a single bookmark set by a user.
+	TBookmark struct {
+		ID       int64
+		Book     TID
+		Created  time.Time
+		Note     string
+		Position string // the bookmarked position (i.e. the reader's URL)
+	}
+
+	// TUserDB provides the methods to access Kaliber's own database.
+	TUserDB struct {
+		sqlDB *sql.DB
+	}
+)
+
+// The reading states of a document.
+const (
+	RsUnread = TReadState(iota)
+	RsReading
+	RsFinished
+)
+
+const (
+	// `udbSchema` creates the tables used by `TUserDB`.
+	udbSchema = `CREATE TABLE IF NOT EXISTS reading (
+	user TEXT NOT NULL,
+	book INTEGER NOT NULL,
+	state INTEGER NOT NULL DEFAULT 0,
+	position TEXT NOT NULL DEFAULT '',
+	started TIMESTAMP,
+	finished TIMESTAMP,
+	updated TIMESTAMP NOT NULL,
+	PRIMARY KEY (user, book)
+);
+CREATE TABLE IF NOT EXISTS bookmarks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user TEXT NOT NULL,
+	book INTEGER NOT NULL,
+	position TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	created TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bookmarks_user_book ON bookmarks (user, book);
+CREATE TABLE IF NOT EXISTS shelves (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user TEXT NOT NULL,
+	name TEXT NOT NULL,
+	favourite INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (user, name)
+);
+CREATE TABLE IF NOT EXISTS shelf_books (
+	shelf INTEGER NOT NULL,
+	book INTEGER NOT NULL,
+	added TIMESTAMP NOT NULL,
+	PRIMARY KEY (shelf, book)
+);
+CREATE TABLE IF NOT EXISTS tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	hash TEXT NOT NULL UNIQUE,
+	scope TEXT NOT NULL,
+	created TIMESTAMP NOT NULL,
+	expires TIMESTAMP,
+	used TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS downloads (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	book INTEGER NOT NULL,
+	format TEXT NOT NULL,
+	user TEXT NOT NULL DEFAULT '',
+	bytes INTEGER NOT NULL DEFAULT 0,
+	delivered TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS downloads_book ON downloads (book);
+CREATE INDEX IF NOT EXISTS downloads_delivered ON downloads (delivered);`
+)
+
+var (
+	// `errNoUserDB` is returned if there's no user database configured.
+	errNoUserDB = errors.New(`no user database configured`)
+
+	// Guard against concurrent opening of the database.
+	udbMtx sync.Mutex
+
+	// Path-/filename of Kaliber's own database.
+	udbFilename = ``
+
+	// The user database instance shared by all requests.
+	udbInstance *TUserDB
+
+	// Lookup table for the names of the reading states.
+	udbStateNames = [...]string{`unread`, `reading`, `finished`}
+)
+
+// ReadStateByName returns the reading state identified by `aName`.
+//
+// Unknown names result in `RsUnread`.
+//
+//	`aName` The state's name (i.e. `unread`, `reading`, or `finished`).
+func ReadStateByName(aName string) TReadState {
+	aName = strings.ToLower(strings.TrimSpace(aName))
+	for idx, name := range udbStateNames {
+		if name == aName {
+			return TReadState(idx)
+		}
+	}
+
+	return RsUnread
+} // ReadStateByName()
+
+// String returns the state's name.
+func (rs TReadState) String() string {
+	if int(rs) < len(udbStateNames) {
+		return udbStateNames[rs]
+	}
+
+	return udbStateNames[RsUnread]
+} // String()
+
+// SetUserDatabaseFile sets the path-/filename of Kaliber's own database.
+//
+// If the provided `aFilename` is empty the reading state, bookmarks,
+// shelves, API token, and download statistics features are disabled.
+//
+//	`aFilename` The database file to use.
+func SetUserDatabaseFile(aFilename string) {
+	udbMtx.Lock()
+	defer udbMtx.Unlock()
+
+	if nil != udbInstance {
+		_ = udbInstance.sqlDB.Close()
+		udbInstance = nil
+	}
+	udbFilename = ``
+	if 0 < len(aFilename) {
+		if path, err := filepath.Abs(aFilename); nil == err {
+			udbFilename = path
+		}
+	}
+} // SetUserDatabaseFile()
+
+// UserDatabaseFile returns the path-/filename of Kaliber's own database.
+func UserDatabaseFile() string {
+	return udbFilename
+} // UserDatabaseFile()
+
+// OpenUserDatabase returns the handle of Kaliber's own database.
+//
+// The database (and its tables) are created if necessary.
+//
+//	`aContext` The current web request's context.
+func OpenUserDatabase(aContext context.Context) (*TUserDB, error) {
+	udbMtx.Lock()
+	defer udbMtx.Unlock()
+
+	if nil != udbInstance {
+		return udbInstance, nil
+	}
+	if 0 == len(udbFilename) {
+		return nil, errNoUserDB
+	}
+
+	// `_txlock=immediate` avoids deadlocks of concurrent writers.
+	dsn := `file:` + udbFilename + `?_busy_timeout=5000&_txlock=immediate&loc=auto`
+	conn, err := sql.Open(`sqlite3`, dsn)
+	if nil != err {
+		return nil, err
+	}
+	if _, err = conn.ExecContext(aContext, udbSchema); nil != err {
+		_ = conn.Close()
+		return nil, err
+	}
+	udbInstance = &TUserDB{sqlDB: conn}
+
+	return udbInstance, nil
+} // OpenUserDatabase()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// AddBookmark stores a new bookmark for `aUser`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aBook` The ID of the bookmarked document.
+//	`aPosition` The bookmarked position.
+//	`aNote` An optional note for the bookmark.
+func (udb *TUserDB) AddBookmark(aContext context.Context, aUser string, aBook TID, aPosition, aNote string) error {
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`INSERT INTO bookmarks (user, book, position, note, created) VALUES (?, ?, ?, ?, ?)`,
+		aUser, aBook, aPosition, strings.TrimSpace(aNote), time.Now())
+
+	return err
+} // AddBookmark()
+
+// BookIDs returns the IDs of all documents `aUser` has marked with
+// one of the given `aStates`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aStates` The reading states to look for.
+func (udb *TUserDB) BookIDs(aContext context.Context, aUser string, aStates ...TReadState) ([]TID, error) {
+	if 0 == len(aStates) {
+		return nil, nil
+	}
+	states := make([]string, len(aStates))
+	for idx, state := range aStates {
+		states[idx] = strconv.Itoa(int(state))
+	}
+
+	return udb.queryIDs(aContext,
+		`SELECT book FROM reading WHERE (user = ?) AND (state IN (`+
+			strings.Join(states, `,`)+`)) ORDER BY book`, aUser) // #nosec G202
+} // BookIDs()
+
+// Bookmarks returns all bookmarks `aUser` has set for `aBook`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aBook` The ID of the document in question.
+func (udb *TUserDB) Bookmarks(aContext context.Context, aUser string, aBook TID) ([]TBookmark, error) {
+	rows, err := udb.sqlDB.QueryContext(aContext,
+		`SELECT id, book, position, note, created FROM bookmarks WHERE (user = ?) AND (book = ?) ORDER BY created`,
+		aUser, aBook)
+	if nil != err {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []TBookmark
+	for rows.Next() {
+		var bm TBookmark
+		if err = rows.Scan(&bm.ID, &bm.Book, &bm.Position, &bm.Note, &bm.Created); nil != err {
+			return nil, err
+		}
+		result = append(result, bm)
+	}
+
+	return result, rows.Err()
+} // Bookmarks()
+
+// Close closes the database.
+func (udb *TUserDB) Close() error {
+	udbMtx.Lock()
+	defer udbMtx.Unlock()
+
+	if udb == udbInstance {
+		udbInstance = nil
+	}
+
+	return udb.sqlDB.Close()
+} // Close()
+
+// DeleteBookmark removes one of `aUser`'s bookmarks.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aID` The ID of the bookmark to remove.
+func (udb *TUserDB) DeleteBookmark(aContext context.Context, aUser string, aID int64) error {
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`DELETE FROM bookmarks WHERE (id = ?) AND (user = ?)`, aID, aUser)
+
+	return err
+} // DeleteBookmark()
+
+// `queryIDs()` returns the IDs selected by `aQuery`.
+//
+//	`aContext` The current web request's context.
+//	`aQuery` The SQL query selecting a single ID column.
+//	`aArgs` The query's arguments.
+func (udb *TUserDB) queryIDs(aContext context.Context, aQuery string, aArgs ...interface{}) ([]TID, error) {
+	rows, err := udb.sqlDB.QueryContext(aContext, aQuery, aArgs...)
+	if nil != err {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []TID
+	for rows.Next() {
+		var id TID
+		if err = rows.Scan(&id); nil != err {
+			return nil, err
+		}
+		result = append(result, id)
+	}
+
+	return result, rows.Err()
+} // queryIDs()
+
+// ReadingState returns `aUser`'s reading progress of `aBook`.
+//
+// If the user didn't start reading the document (yet) the returned
+// state is `RsUnread`.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aBook` The ID of the document in question.
+func (udb *TUserDB) ReadingState(aContext context.Context, aUser string, aBook TID) (*TReadingState, error) {
+	var (
+		finished, started sql.NullTime
+		state             uint8
+	)
+	result := &TReadingState{Book: aBook}
+	err := udb.sqlDB.QueryRowContext(aContext,
+		`SELECT state, position, started, finished, updated FROM reading WHERE (user = ?) AND (book = ?)`,
+		aUser, aBook).Scan(&state, &result.Position, &started, &finished, &result.Updated)
+	if nil != err {
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, nil
+		}
+		return nil, err
+	}
+	result.State = TReadState(state)
+	result.Started, result.Finished = started.Time, finished.Time
+
+	return result, nil
+} // ReadingState()
+
+// SetPosition stores `aUser`'s last reading position of `aBook`.
+//
+// An unread document is marked as being read.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aBook` The ID of the document in question.
+//	`aPosition` The current reading position.
+func (udb *TUserDB) SetPosition(aContext context.Context, aUser string, aBook TID, aPosition string) error {
+	now := time.Now()
+	_, err := udb.sqlDB.ExecContext(aContext,
+		`INSERT INTO reading (user, book, state, position, started, updated) VALUES (?1, ?2, ?3, ?4, ?5, ?5)
+ON CONFLICT (user, book) DO UPDATE SET position = ?4, updated = ?5,
+	started = IFNULL(started, ?5),
+	state = CASE WHEN (state = ?6) THEN ?3 ELSE state END`,
+		aUser, aBook, RsReading, aPosition, now, RsUnread)
+
+	return err
+} // SetPosition()
+
+// SetReadingState changes `aUser`'s reading state of `aBook`.
+//
+// The start and finish dates are set accordingly; marking a document
+// as unread clears them along with the last reading position.
+//
+//	`aContext` The current web request's context.
+//	`aUser` The name of the current user.
+//	`aBook` The ID of the document in question.
+//	`aState` The new reading state.
+func (udb *TUserDB) SetReadingState(aContext context.Context, aUser string, aBook TID, aState TReadState) (rErr error) {
+	now := time.Now()
+	switch aState {
+	case RsReading:
+		_, rErr = udb.sqlDB.ExecContext(aContext,
+			`INSERT INTO reading (user, book, state, started, updated) VALUES (?1, ?2, ?3, ?4, ?4)
+ON CONFLICT (user, book) DO UPDATE SET state = ?3, started = IFNULL(started, ?4), finished = NULL, updated = ?4`,
+			aUser, aBook, RsReading, now)
+
+	case RsFinished:
+		_, rErr = udb.sqlDB.ExecContext(aContext,
+			`INSERT INTO reading (user, book, state, started, finished, updated) VALUES (?1, ?2, ?3, ?4, ?4, ?4)
+ON CONFLICT (user, book) DO UPDATE SET state = ?3, started = IFNULL(started, ?4), finished = ?4, updated = ?4`,
+			aUser, aBook, RsFinished, now)
+
+	default:
+		_, rErr = udb.sqlDB.ExecContext(aContext,
+			`DELETE FROM reading WHERE (user = ?) AND (book = ?)`, aUser, aBook)
+	}
+
+	return
+} // SetReadingState()
+
+/* _EoF_ */
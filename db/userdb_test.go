@@ -0,0 +1,144 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package db
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// `openTestUserDB()` returns a user database in a temporary directory.
+func openTestUserDB(t *testing.T) *TUserDB {
+	SetUserDatabaseFile(filepath.Join(t.TempDir(), `kaliber.db`))
+	t.Cleanup(func() { SetUserDatabaseFile(``) })
+
+	udb, err := OpenUserDatabase(context.TODO())
+	if nil != err {
+		t.Fatalf("OpenUserDatabase() error = %v", err)
+	}
+
+	return udb
+} // openTestUserDB()
+
+func TestReadStateByName(t *testing.T) {
+	tests := []struct {
+		name  string
+		aName string
+		want  TReadState
+	}{
+		// TODO: Add test cases.
+		{" 1", `unread`, RsUnread},
+		{" 2", `Reading`, RsReading},
+		{" 3", ` finished `, RsFinished},
+		{" 4", `bogus`, RsUnread},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReadStateByName(tt.aName)
+			if got != tt.want {
+				t.Errorf("ReadStateByName() = %v, want %v", got, tt.want)
+			}
+			if (`bogus` != tt.aName) && (got.String() != ReadStateByName(tt.aName).String()) {
+				t.Errorf("TReadState.String() = %v", got.String())
+			}
+		})
+	}
+} // TestReadStateByName()
+
+func TestOpenUserDatabase(t *testing.T) {
+	SetUserDatabaseFile(``)
+	if _, err := OpenUserDatabase(context.TODO()); errNoUserDB != err {
+		t.Errorf("OpenUserDatabase() error = %v, want %v", err, errNoUserDB)
+	}
+	udb := openTestUserDB(t)
+	if again, _ := OpenUserDatabase(context.TODO()); again != udb {
+		t.Errorf("OpenUserDatabase() = %p, want %p", again, udb)
+	}
+} // TestOpenUserDatabase()
+
+func TestTUserDB_ReadingState(t *testing.T) {
+	ctx := context.TODO()
+	udb := openTestUserDB(t)
+
+	state, err := udb.ReadingState(ctx, `alice`, 1)
+	if (nil != err) || (RsUnread != state.State) || !state.Started.IsZero() {
+		t.Fatalf("ReadingState() = %v, %v", state, err)
+	}
+	if err = udb.SetPosition(ctx, `alice`, 1, `/read/1/?c=2`); nil != err {
+		t.Fatal(err)
+	}
+	state, _ = udb.ReadingState(ctx, `alice`, 1)
+	if (RsReading != state.State) || (`/read/1/?c=2` != state.Position) || state.Started.IsZero() {
+		t.Errorf("SetPosition() state = %v", state)
+	}
+	started := state.Started
+
+	if err = udb.SetReadingState(ctx, `alice`, 1, RsFinished); nil != err {
+		t.Fatal(err)
+	}
+	state, _ = udb.ReadingState(ctx, `alice`, 1)
+	if (RsFinished != state.State) || state.Finished.IsZero() || !state.Started.Equal(started) {
+		t.Errorf("SetReadingState(finished) state = %v", state)
+	}
+	// Reading on in a finished book doesn't change the state:
+	_ = udb.SetPosition(ctx, `alice`, 1, `/read/1/?c=3`)
+	if state, _ = udb.ReadingState(ctx, `alice`, 1); RsFinished != state.State {
+		t.Errorf("SetPosition() state = %v, want %v", state.State, RsFinished)
+	}
+	// Other users are not affected:
+	if state, _ = udb.ReadingState(ctx, `bob`, 1); RsUnread != state.State {
+		t.Errorf("ReadingState(bob) = %v, want %v", state.State, RsUnread)
+	}
+
+	_ = udb.SetReadingState(ctx, `alice`, 2, RsReading)
+	_ = udb.SetReadingState(ctx, `alice`, 3, RsFinished)
+	_ = udb.SetReadingState(ctx, `bob`, 4, RsFinished)
+	ids, _ := udb.BookIDs(ctx, `alice`, RsReading, RsFinished)
+	if want := []TID{1, 2, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("BookIDs() = %v, want %v", ids, want)
+	}
+	ids, _ = udb.BookIDs(ctx, `alice`, RsReading)
+	if want := []TID{2}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("BookIDs() = %v, want %v", ids, want)
+	}
+
+	if err = udb.SetReadingState(ctx, `alice`, 1, RsUnread); nil != err {
+		t.Fatal(err)
+	}
+	state, _ = udb.ReadingState(ctx, `alice`, 1)
+	if (RsUnread != state.State) || (0 < len(state.Position)) || !state.Started.IsZero() {
+		t.Errorf("SetReadingState(unread) state = %v", state)
+	}
+} // TestTUserDB_ReadingState()
+
+func TestTUserDB_Bookmarks(t *testing.T) {
+	ctx := context.TODO()
+	udb := openTestUserDB(t)
+
+	_ = udb.AddBookmark(ctx, `alice`, 1, `/read/1/?c=1`, ` one `)
+	_ = udb.AddBookmark(ctx, `alice`, 1, `/read/1/?c=5`, ``)
+	_ = udb.AddBookmark(ctx, `bob`, 1, `/read/1/?c=9`, `bob's`)
+	marks, err := udb.Bookmarks(ctx, `alice`, 1)
+	if (nil != err) || (2 != len(marks)) {
+		t.Fatalf("Bookmarks() = %v, %v", marks, err)
+	}
+	if (`one` != marks[0].Note) || (`/read/1/?c=5` != marks[1].Position) {
+		t.Errorf("Bookmarks() = %v", marks)
+	}
+	// Users can't delete the bookmarks of others:
+	_ = udb.DeleteBookmark(ctx, `bob`, marks[0].ID)
+	_ = udb.DeleteBookmark(ctx, `alice`, marks[1].ID)
+	if marks, _ = udb.Bookmarks(ctx, `alice`, 1); (1 != len(marks)) || (`one` != marks[0].Note) {
+		t.Errorf("DeleteBookmark() = %v", marks)
+	}
+} // TestTUserDB_Bookmarks()
+
+/* _EoF_ */
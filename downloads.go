@@ -0,0 +1,124 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides the recording of the documents' downloads.
+ *
+ * Every document file delivered completely by `/file/` is stored
+ * (document, format, user, time, and size) in Kaliber's own database;
+ * range requests (e.g. by reading devices) and `304` replies are not
+ * counted.
+ */
+
+type (
+	// `tDownloadWriter` counts the bytes written to an HTTP response.
+	tDownloadWriter struct {
+		http.ResponseWriter
+		bytes  int64
+		status int
+	}
+)
+
+// Write counts and writes `aData` to the HTTP response.
+//
+//	`aData` The data to write.
+func (dw *tDownloadWriter) Write(aData []byte) (int, error) {
+	if 0 == dw.status {
+		dw.status = http.StatusOK
+	}
+	n, err := dw.ResponseWriter.Write(aData)
+	dw.bytes += int64(n)
+
+	return n, err
+} // Write()
+
+// WriteHeader remembers and sends the HTTP response's status code.
+//
+//	`aStatus` The HTTP status code to send.
+func (dw *tDownloadWriter) WriteHeader(aStatus int) {
+	if 0 == dw.status {
+		dw.status = aStatus
+	}
+	dw.ResponseWriter.WriteHeader(aStatus)
+} // WriteHeader()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `serveDownload()` sends the document file `aFile` and records the
+// download.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aID` The document's ID.
+//	`aFormat` The document's format (e.g. `EPUB`).
+//	`aFile` The file's path relative to the library.
+func (ph *TPageHandler) serveDownload(aWriter http.ResponseWriter, aRequest *http.Request, aID db.TID, aFormat, aFile string) {
+	dw := &tDownloadWriter{ResponseWriter: aWriter}
+	aRequest.URL.Path = aFile
+	ph.docFS.ServeHTTP(dw, aRequest)
+	if (http.StatusOK == dw.status) || (http.StatusPartialContent == dw.status) {
+		srvMetrics.addBytes(aFormat, dw.bytes)
+	}
+
+	if (`GET` != aRequest.Method) || (http.StatusOK != dw.status) ||
+		(0 == len(db.UserDatabaseFile())) {
+		return
+	}
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil == err {
+		err = udb.AddDownload(aRequest.Context(), ph.authUser(aRequest),
+			aID, aFormat, dw.bytes)
+	}
+	if nil != err {
+		msg := fmt.Sprintf("AddDownload(%d, %s): %v", aID, aFormat, err)
+		logRequest(aRequest, "TPageHandler.serveDownload()", msg)
+	}
+} // serveDownload()
+
+// `setDownloadData()` adds the number of downloads of the document
+// `aID` to `aPageData`.
+//
+// The function returns the number of downloads (to be used for the
+// page's ETag).
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aPageData` The page's template data.
+//	`aID` The document's ID.
+func (ph *TPageHandler) setDownloadData(aRequest *http.Request, aPageData *TemplateData, aID db.TID) int {
+	if 0 == len(db.UserDatabaseFile()) {
+		return 0
+	}
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		msg := fmt.Sprintf("OpenUserDatabase(): %v", err)
+		logRequest(aRequest, "TPageHandler.setDownloadData()", msg)
+		return 0
+	}
+	count, err := udb.DownloadCount(aRequest.Context(), aID)
+	if nil != err {
+		msg := fmt.Sprintf("DownloadCount(%d): %v", aID, err)
+		logRequest(aRequest, "TPageHandler.setDownloadData()", msg)
+		return 0
+	}
+	aPageData.Set("DownloadCount", count).
+		Set("DownloadDays", db.DownloadRetention()).
+		Set("HasDownloads", true)
+
+	return count
+} // setDownloadData()
+
+/* _EoF_ */
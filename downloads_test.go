@@ -0,0 +1,69 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func TestTPageHandler_serveDownload(t *testing.T) {
+	dir := t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(dir, `book.epub`), []byte(`0123456789`), 0600)
+	db.SetUserDatabaseFile(filepath.Join(dir, `kaliber.db`))
+	defer db.SetUserDatabaseFile(``)
+	udb, err := db.OpenUserDatabase(context.TODO())
+	if nil != err {
+		t.Fatal(err)
+	}
+	ph := &TPageHandler{docFS: http.FileServer(http.Dir(dir))}
+
+	tests := []struct {
+		name       string
+		method     string
+		rangeHdr   string
+		wantStatus int
+		wantCount  int
+	}{
+		// TODO: Add test cases.
+		{" 1", `GET`, ``, http.StatusOK, 1},
+		{" 2", `HEAD`, ``, http.StatusOK, 1},
+		{" 3", `GET`, `bytes=0-3`, http.StatusPartialContent, 1},
+		{" 4", `GET`, ``, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, `/file/7/EPUB/book.epub`, nil)
+			if 0 < len(tt.rangeHdr) {
+				r.Header.Set(`Range`, tt.rangeHdr)
+			}
+			ph.serveDownload(w, r, 7, `epub`, `/book.epub`)
+			if w.Code != tt.wantStatus {
+				t.Errorf("serveDownload() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got, _ := udb.DownloadCount(context.TODO(), 7); got != tt.wantCount {
+				t.Errorf("DownloadCount() = %d, want %d", got, tt.wantCount)
+			}
+		})
+	}
+
+	list, _ := udb.Downloads(context.TODO(), 0)
+	if (1 != len(list)) || (20 != list[0].Bytes) {
+		t.Errorf("Downloads() = %v, want 20 bytes of document 7", list)
+	}
+} // TestTPageHandler_serveDownload()
+
+/* _EoF_ */
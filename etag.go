@@ -0,0 +1,124 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+ * This file provides functions to handle conditional GET requests
+ * (i.e. `If-None-Match` and `If-Modified-Since`) by means of
+ * ETags and `304 Not Modified` replies.
+ */
+
+// `newETag()` returns a strong entity tag computed from `aParts`.
+//
+//	`aParts` The values identifying a certain response version.
+func newETag(aParts ...interface{}) string {
+	hash := fnv.New64a()
+	for _, part := range aParts {
+		fmt.Fprintf(hash, "%v|", part)
+	}
+
+	return fmt.Sprintf(`"%016x"`, hash.Sum64())
+} // newETag()
+
+// `etagMatches()` reports whether `aETag` is contained in the
+// `If-None-Match` header value `aHeader`.
+//
+// As required for `If-None-Match` the weak comparison is used,
+// i.e. a `W/` prefix is ignored.
+//
+//	`aHeader` The value of the request's `If-None-Match` header.
+//	`aETag` The current entity tag of the requested resource.
+func etagMatches(aHeader, aETag string) bool {
+	if 0 == len(aETag) {
+		return false
+	}
+	aETag = strings.TrimPrefix(aETag, `W/`)
+	for _, tag := range strings.Split(aHeader, `,`) {
+		tag = strings.TrimSpace(tag)
+		if (`*` == tag) || (strings.TrimPrefix(tag, `W/`) == aETag) {
+			return true
+		}
+	}
+
+	return false
+} // etagMatches()
+
+// `notModified()` sets the `ETag` and `Last-Modified` headers and
+// checks whether the client's cached copy is still valid.
+//
+// If so, a `304 Not Modified` reply is sent and `true` is returned;
+// otherwise the caller has to send the full response.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aETag` The current entity tag of the requested resource.
+//	`aModTime` The last modification time of the requested resource.
+func notModified(aWriter http.ResponseWriter, aRequest *http.Request, aETag string, aModTime time.Time) bool {
+	header := aWriter.Header()
+	if 0 < len(aETag) {
+		header.Set(`ETag`, aETag)
+	}
+	if !aModTime.IsZero() {
+		header.Set(`Last-Modified`, aModTime.UTC().Format(http.TimeFormat))
+	}
+	if (`GET` != aRequest.Method) && (`HEAD` != aRequest.Method) {
+		return false
+	}
+
+	// `If-None-Match` takes precedence over `If-Modified-Since`:
+	if inm := aRequest.Header.Get(`If-None-Match`); 0 < len(inm) {
+		if !etagMatches(inm, aETag) {
+			return false
+		}
+	} else if ims := aRequest.Header.Get(`If-Modified-Since`); (0 < len(ims)) && !aModTime.IsZero() {
+		since, err := http.ParseTime(ims)
+		if (nil != err) || aModTime.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	delete(header, `Content-Type`)
+	delete(header, `Content-Length`)
+	aWriter.WriteHeader(http.StatusNotModified)
+
+	return true
+} // notModified()
+
+// `fileNotModified()` works like `notModified()` using the
+// modification time and size of `aFilename` as validators.
+//
+// If `aFilename` can't be accessed `false` is returned leaving the
+// error handling to the file server.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aFilename` The name of the file to send.
+func fileNotModified(aWriter http.ResponseWriter, aRequest *http.Request, aFilename string) bool {
+	fi, err := os.Stat(aFilename)
+	if nil != err {
+		return false
+	}
+	mTime := fi.ModTime()
+
+	return notModified(aWriter, aRequest,
+		newETag(mTime.UnixNano(), fi.Size()), mTime)
+} // fileNotModified()
+
+/* _EoF_ */
@@ -0,0 +1,96 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_etagMatches(t *testing.T) {
+	type args struct {
+		aHeader string
+		aETag   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`"abc"`, `"abc"`}, true},
+		{" 2", args{`"xyz", W/"abc"`, `"abc"`}, true},
+		{" 3", args{`*`, `"abc"`}, true},
+		{" 4", args{`"xyz"`, `"abc"`}, false},
+		{" 5", args{`"abc"`, ``}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.args.aHeader, tt.args.aETag); got != tt.want {
+				t.Errorf("etagMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_etagMatches()
+
+func Test_newETag(t *testing.T) {
+	e1 := newETag(1, int64(1234), `abc`)
+	if e1 != newETag(1, int64(1234), `abc`) {
+		t.Errorf("newETag() = %v, not stable", e1)
+	}
+	if e1 == newETag(1, int64(1235), `abc`) {
+		t.Errorf("newETag() = %v, not unique", e1)
+	}
+	if 18 != len(e1) || '"' != e1[0] || '"' != e1[17] {
+		t.Errorf("newETag() = %v, not a quoted strong tag", e1)
+	}
+} // Test_newETag()
+
+func Test_notModified(t *testing.T) {
+	mTime := time.Date(2020, 2, 20, 12, 34, 56, 789, time.UTC)
+	etag := newETag(mTime.UnixNano())
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		want   bool
+	}{
+		// TODO: Add test cases.
+		{" 1", `GET`, ``, ``, false},
+		{" 2", `GET`, `If-None-Match`, etag, true},
+		{" 3", `HEAD`, `If-None-Match`, `"other"`, false},
+		{" 4", `GET`, `If-Modified-Since`, mTime.Format(http.TimeFormat), true},
+		{" 5", `GET`, `If-Modified-Since`, mTime.Add(-time.Hour).Format(http.TimeFormat), false},
+		{" 6", `POST`, `If-None-Match`, etag, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, `/doc/1/doc.html`, nil)
+			if 0 < len(tt.header) {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			got := notModified(rec, req, etag, mTime)
+			if got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+			if got && (http.StatusNotModified != rec.Code) {
+				t.Errorf("notModified() status = %v, want %v", rec.Code, http.StatusNotModified)
+			}
+			if etag != rec.Header().Get(`ETag`) {
+				t.Errorf("notModified() ETag = %v, want %v", rec.Header().Get(`ETag`), etag)
+			}
+		})
+	}
+} // Test_notModified()
+
+/* _EoF_ */
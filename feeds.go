@@ -0,0 +1,300 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides Atom and RSS feeds of recently added documents.
+ */
+
+type (
+	// `tAtomFeed` is an Atom feed for feed readers.
+	tAtomFeed struct {
+		XMLName xml.Name     `xml:"feed"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		ID      string       `xml:"id"`
+		Title   string       `xml:"title"`
+		Updated string       `xml:"updated"`
+		Author  tOPDSAuthor  `xml:"author"`
+		Links   []tOPDSLink  `xml:"link"`
+		Entries []tOPDSEntry `xml:"entry"`
+	}
+
+	// `tRSSItem` is a single item of an RSS channel.
+	tRSSItem struct {
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+		GUID  struct {
+			IsPermaLink bool   `xml:"isPermaLink,attr"`
+			ID          string `xml:",chardata"`
+		} `xml:"guid"`
+		PubDate     string `xml:"pubDate"`
+		Creator     string `xml:"dc:creator,omitempty"`
+		Description string `xml:"description"`
+	}
+
+	// `tRSSFeed` is an RSS 2.0 feed for feed readers.
+	tRSSFeed struct {
+		XMLName  xml.Name `xml:"rss"`
+		Version  string   `xml:"version,attr"`
+		XmlnsA   string   `xml:"xmlns:atom,attr"`
+		XmlnsDC  string   `xml:"xmlns:dc,attr"`
+		Title    string   `xml:"channel>title"`
+		Link     string   `xml:"channel>link"`
+		Desc     string   `xml:"channel>description"`
+		Language string   `xml:"channel>language,omitempty"`
+		Build    string   `xml:"channel>lastBuildDate"`
+		Self     struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"channel>atom:link"`
+		Items []tRSSItem `xml:"channel>item"`
+	}
+)
+
+var (
+	// Template to render the HTML content of a single feed entry.
+	fdContentTemplate = template.Must(template.New(`feed`).Parse(
+		`<p><a href="{{.Base}}{{.Doc.DocLink}}"><img src="{{.Base}}{{.Doc.Thumb}}" alt="{{.Doc.Title}}"></a></p>` +
+			`{{with .Doc.Authors}}<p>{{range $i, $a := .}}{{if $i}}, {{end}}<a href="{{$.Base}}{{$a.URL}}">{{$a.Name}}</a>{{end}}</p>{{end}}` +
+			`{{with .Doc.Series}}<p><a href="{{$.Base}}{{.URL}}">{{.Name}}</a> [{{$.Doc.SeriesIndex}}]</p>{{end}}` +
+			`{{.Comment}}`))
+)
+
+// `feedCacheControl()` returns the `Cache-Control` header value for
+// the feed requested by `aRequest`.
+//
+// Shared caches (proxies) may store only the feeds which are the
+// same for everybody, i.e. neither authenticated nor restricted.
+//
+//	`aRequest` The HTTP request received by the server.
+func feedCacheControl(aRequest *http.Request) string {
+	user, _ := db.ContextUser(aRequest.Context())
+	if (0 < len(user)) || (0 < len(aRequest.Header.Get(`Authorization`))) ||
+		db.IsRestricted(aRequest.Context()) {
+		return `private, max-age=900` // 15 minutes
+	}
+
+	return `public, max-age=900`
+} // feedCacheControl()
+
+// `feedContent()` returns the HTML content of the feed entry of `aDoc`.
+//
+//	`aBaseURL` The scheme and host to prepend to all links.
+//	`aDoc` The document to describe.
+func feedContent(aBaseURL string, aDoc *db.TDocument) string {
+	var buf bytes.Buffer
+	err := fdContentTemplate.Execute(&buf, map[string]interface{}{
+		`Base`:    aBaseURL,
+		`Comment`: template.HTML(sanitizeHTML(string(aDoc.Comment()))), // #nosec G203
+		`Doc`:     aDoc,
+	})
+	if nil != err {
+		msg := fmt.Sprintf("fdContentTemplate.Execute(): %v", err)
+		logError("feedContent()", msg)
+	}
+
+	return buf.String()
+} // feedContent()
+
+// `feedAtom()` returns the Atom feed of `aList`.
+//
+//	`aBaseURL` The scheme and host to prepend to all links.
+//	`aSelf` The feed's own (relative) URL.
+//	`aTitle` The feed's title.
+//	`aList` The documents to include.
+func feedAtom(aBaseURL, aSelf, aTitle string, aList *db.TDocList) *tAtomFeed {
+	result := &tAtomFeed{
+		Xmlns:   `http://www.w3.org/2005/Atom`,
+		ID:      aBaseURL + aSelf,
+		Title:   aTitle,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  tOPDSAuthor{Name: AppArgs.Realm},
+		Links: []tOPDSLink{
+			{Href: aBaseURL + aSelf, Rel: `self`, Type: `application/atom+xml`},
+			{Href: aBaseURL + `/`, Rel: `alternate`, Type: `text/html`},
+		},
+	}
+	if nil == aList {
+		return result
+	}
+
+	var newest time.Time
+	result.Entries = make([]tOPDSEntry, 0, len(*aList))
+	for idx := range *aList {
+		doc := &(*aList)[idx]
+		if t := doc.Acquisition(); t.After(newest) {
+			newest = t
+		}
+		entry := tOPDSEntry{
+			Title:   doc.Title,
+			ID:      `urn:uuid:` + doc.UUID(),
+			Updated: doc.Acquisition().UTC().Format(time.RFC3339),
+			Content: &tOPDSContent{Type: `html`, Text: feedContent(aBaseURL, doc)},
+			Links: []tOPDSLink{
+				{Href: aBaseURL + doc.DocLink(), Rel: `alternate`, Type: `text/html`},
+				{Href: aBaseURL + doc.Thumb(), Rel: `enclosure`, Type: `image/jpeg`},
+			},
+		}
+		if list := doc.Authors(); nil != list {
+			for _, author := range *list {
+				entry.Authors = append(entry.Authors,
+					tOPDSAuthor{Name: author.Name, URI: aBaseURL + author.URL})
+			}
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	if !newest.IsZero() {
+		result.Updated = newest.UTC().Format(time.RFC3339)
+	}
+
+	return result
+} // feedAtom()
+
+// `feedRSS()` returns the RSS feed of `aList`.
+//
+//	`aBaseURL` The scheme and host to prepend to all links.
+//	`aSelf` The feed's own (relative) URL.
+//	`aTitle` The feed's title.
+//	`aList` The documents to include.
+func feedRSS(aBaseURL, aSelf, aTitle string, aList *db.TDocList) *tRSSFeed {
+	result := &tRSSFeed{
+		Version:  `2.0`,
+		XmlnsA:   `http://www.w3.org/2005/Atom`,
+		XmlnsDC:  `http://purl.org/dc/elements/1.1/`,
+		Title:    aTitle,
+		Link:     aBaseURL + `/`,
+		Desc:     aTitle,
+		Language: AppArgs.Lang,
+		Build:    time.Now().UTC().Format(time.RFC1123Z),
+	}
+	result.Self.Href = aBaseURL + aSelf
+	result.Self.Rel = `self`
+	result.Self.Type = `application/rss+xml`
+	if nil == aList {
+		return result
+	}
+
+	result.Items = make([]tRSSItem, 0, len(*aList))
+	for idx := range *aList {
+		doc := &(*aList)[idx]
+		item := tRSSItem{
+			Title:       doc.Title,
+			Link:        aBaseURL + doc.DocLink(),
+			PubDate:     doc.Acquisition().UTC().Format(time.RFC1123Z),
+			Creator:     doc.AuthorList(),
+			Description: feedContent(aBaseURL, doc),
+		}
+		item.GUID.ID = `urn:uuid:` + doc.UUID()
+		result.Items = append(result.Items, item)
+	}
+
+	return result
+} // feedRSS()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleFeed()` serves the feeds below `/feed/`.
+//
+// Supported are `/feed/new.atom`, `/feed/new.rss` as well as
+// `/feed/search.atom` and `/feed/search.rss`; all of them can be
+// limited by the `matching` and `virtlib` parameters.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL path following `/feed/`.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleFeed(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aDB *db.TDataBase) {
+	var name, format string
+	if idx := strings.LastIndex(aTail, `.`); 0 < idx {
+		name, format = aTail[:idx], aTail[idx+1:]
+	}
+	if ((`new` != name) && (`search` != name)) ||
+		((`atom` != format) && (`rss` != format)) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+
+	qo := db.NewQueryOptions(AppArgs.BooksPerPage)
+	qo.Layout = db.QoLayoutList
+	qo.SetSortBy(`acquisition`).Descending = true
+	title := AppArgs.Realm + `: `
+	if matching := strings.TrimSpace(aRequest.FormValue(`matching`)); 0 < len(matching) {
+		qo.Matching = matching
+		title += matching
+	} else if vl := aRequest.FormValue(`virtlib`); 0 < len(vl) {
+		if vlList, err := db.VirtualLibraryList(); nil == err {
+			qo.Matching = vlList[vl]
+		}
+		if 0 == len(qo.Matching) {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		qo.VirtLib = vl
+		title += vl
+	} else if `search` == name {
+		http.Error(aWriter, `missing 'matching' or 'virtlib' parameter`,
+			http.StatusBadRequest)
+		return
+	} else {
+		title += `Recently added`
+	}
+
+	var (
+		doclist *db.TDocList
+		err     error
+	)
+	if 0 < len(qo.Matching) {
+		_, doclist, err = aDB.QuerySearch(aRequest.Context(), qo)
+	} else {
+		_, doclist, err = aDB.QueryBy(aRequest.Context(), qo)
+	}
+	if nil != err {
+		msg := fmt.Sprintf("QueryBy/QuerySearch: %v", err)
+		logRequest(aRequest, "TPageHandler.handleFeed()", msg)
+	}
+
+	var (
+		contentType string
+		feed        interface{}
+	)
+	base, self := requestBaseURL(aRequest), aRequest.URL.RequestURI()
+	if `atom` == format {
+		contentType = `application/atom+xml; charset=utf-8`
+		feed = feedAtom(base, self, title, doclist)
+	} else {
+		contentType = `application/rss+xml; charset=utf-8`
+		feed = feedRSS(base, self, title, doclist)
+	}
+	page, err := xml.MarshalIndent(feed, ``, ` `)
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleFeed()`,
+			fmt.Sprintf("xml.MarshalIndent(): %v", err))
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, contentType)
+	aWriter.Header().Set(`Cache-Control`, feedCacheControl(aRequest))
+	_, _ = aWriter.Write([]byte(xml.Header))
+	_, _ = aWriter.Write(page)
+} // handleFeed()
+
+/* _EoF_ */
@@ -0,0 +1,55 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func Test_feedCacheControl(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), `restrict.json`)
+	_ = os.WriteFile(fName, []byte(`{"kid": {"allowTags": ["Kids"]}}`), 0600)
+	if err := db.SetRestrictionsFile(fName); nil != err {
+		t.Fatal(err)
+	}
+	defer db.SetRestrictionsFile(``)
+
+	tests := []struct {
+		name string
+		user string
+		auth string
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, ``, `public, max-age=900`},
+		{" 2", ``, `Basic Ym9iOnNlY3JldA==`, `private, max-age=900`},
+		{" 3", `bob`, ``, `private, max-age=900`},
+		{" 4", `kid`, ``, `private, max-age=900`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(`GET`, `/feed/new.atom`, nil)
+			r = r.WithContext(db.WithUser(context.TODO(), tt.user))
+			if 0 < len(tt.auth) {
+				r.Header.Set(`Authorization`, tt.auth)
+			}
+			if got := feedCacheControl(r); got != tt.want {
+				t.Errorf("feedCacheControl() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_feedCacheControl()
+
+/* _EoF_ */
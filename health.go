@@ -0,0 +1,134 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides the health (`/healthz`) and readiness (`/readyz`)
+ * checks used e.g. by container orchestration.
+ *
+ * `/healthz` just tells that the process is alive while `/readyz`
+ * checks whether the `Calibre` database copy can be used; failing
+ * checks are answered with a `503 Service Unavailable` status.
+ * Both replies are JSON formatted.
+ *
+ * Since the checks are available without login the replies name
+ * just the failed checks while the details (which may contain e.g.
+ * file paths) are logged.
+ */
+
+type (
+	// `tHealthCheck` is the result of a single readiness check.
+	tHealthCheck struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	// `tHealthReply` is the JSON reply of the health checks.
+	tHealthReply struct {
+		Status string         `json:"status"`
+		Checks []tHealthCheck `json:"checks,omitempty"`
+	}
+)
+
+const (
+	// The status of a passed check.
+	healthOK = `ok`
+
+	// The status of a failed check.
+	healthFailed = `failed`
+)
+
+// `handleHealth()` tells the remote client that the server is alive.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleHealth(aWriter http.ResponseWriter, aRequest *http.Request) {
+	aWriter.Header().Set(`Cache-Control`, `no-store`)
+	apiSendJSON(aWriter, http.StatusOK, tHealthReply{Status: healthOK})
+} // handleHealth()
+
+// `handleReady()` tells the remote client whether the server is
+// able to serve the library.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleReady(aWriter http.ResponseWriter, aRequest *http.Request) {
+	reply := tHealthReply{
+		Status: healthOK,
+		Checks: readyChecks(aRequest),
+	}
+	status := http.StatusOK
+	for _, check := range reply.Checks {
+		if healthOK != check.Status {
+			reply.Status = healthFailed
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `no-store`)
+	apiSendJSON(aWriter, status, reply)
+} // handleReady()
+
+// `newHealthCheck()` returns the result of the check `aName`.
+//
+// A check's error is logged while the reply shows just `aReason`.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aName` The check's name.
+//	`aReason` The failure reason to show.
+//	`aErr` The check's error (if any).
+func newHealthCheck(aRequest *http.Request, aName, aReason string, aErr error) tHealthCheck {
+	if nil == aErr {
+		return tHealthCheck{Name: aName, Status: healthOK}
+	}
+	logContext(aRequest.Context(), levelWarn, "TPageHandler.handleReady()",
+		fmt.Sprintf("%s: %v", aName, aErr))
+
+	return tHealthCheck{Name: aName, Status: healthFailed, Error: aReason}
+} // newHealthCheck()
+
+// `readyChecks()` runs the readiness checks:
+// the database copy must be readable, the latest sync with the
+// `Calibre` library must have succeeded, and a test query must work.
+//
+//	`aRequest` The HTTP request received by the server.
+func readyChecks(aRequest *http.Request) []tHealthCheck {
+	result := []tHealthCheck{
+		newHealthCheck(aRequest, `database copy`,
+			`database copy missing or unreadable`, db.CheckCopy()),
+	}
+
+	var err error
+	if msg := db.SyncStatus().LastError; 0 < len(msg) {
+		err = errors.New(msg)
+	}
+	result = append(result, newHealthCheck(aRequest, `database sync`,
+		`latest sync failed`, err))
+
+	dbHandle, err := db.OpenDatabase(aRequest.Context())
+	if nil == err {
+		err = dbHandle.Ping(aRequest.Context())
+		dbHandle.Close()
+	}
+
+	return append(result, newHealthCheck(aRequest, `test query`,
+		`test query failed`, err))
+} // readyChecks()
+
+/* _EoF_ */
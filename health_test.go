@@ -0,0 +1,58 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func TestTPageHandler_handleHealth(t *testing.T) {
+	ph := &TPageHandler{}
+	w := httptest.NewRecorder()
+	ph.handleHealth(w, httptest.NewRequest(`GET`, `/healthz`, nil))
+	if http.StatusOK != w.Code {
+		t.Errorf("handleHealth() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if want := `{"status":"ok"}`; w.Body.String() != want {
+		t.Errorf("handleHealth() = %s, want %s", w.Body.String(), want)
+	}
+} // TestTPageHandler_handleHealth()
+
+func TestTPageHandler_handleReady(t *testing.T) {
+	saved := db.CalibreCachePath()
+	defer func() { _ = db.SetCalibreCachePath(saved) }()
+	_ = db.SetCalibreCachePath(t.TempDir()) // without a database copy
+
+	ph := &TPageHandler{}
+	w := httptest.NewRecorder()
+	ph.handleReady(w, httptest.NewRequest(`GET`, `/readyz`, nil))
+	if http.StatusServiceUnavailable != w.Code {
+		t.Errorf("handleReady() status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	var reply tHealthReply
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); nil != err {
+		t.Fatalf("handleReady() = %s: %v", w.Body.String(), err)
+	}
+	if (healthFailed != reply.Status) || (3 != len(reply.Checks)) ||
+		(healthFailed != reply.Checks[0].Status) ||
+		(`database copy missing or unreadable` != reply.Checks[0].Error) {
+		t.Errorf("handleReady() = %s, want a failed database copy", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), db.CalibreCachePath()) {
+		t.Errorf("handleReady() = %s, shows a file path", w.Body.String())
+	}
+} // TestTPageHandler_handleReady()
+
+/* _EoF_ */
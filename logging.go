@@ -0,0 +1,293 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwat56/apachelogger"
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides the logging of the server's messages.
+ *
+ * Each web request gets an ID (either a valid `X-Request-ID` header
+ * sent by a proxy or a newly generated one) which is sent back to
+ * the client in an `X-Request-ID` header, shown on error pages, and
+ * logged along with all messages belonging to that request (incl.
+ * the database queries).
+ *
+ * Depending on the `logFormat` option the messages are written either
+ * by `apachelogger.Err()` or as JSON or `logfmt` lines (to the
+ * `errorLog` file or `stderr`); the `logLevel` option selects the
+ * least important messages to log.
+ */
+
+type (
+	// `tLogLevel` is the importance of a log message.
+	tLogLevel int
+
+	// `tJSONLogEntry` is a log message in JSON format.
+	tJSONLogEntry struct {
+		Time      string `json:"time"`
+		Level     string `json:"level"`
+		RequestID string `json:"request_id,omitempty"`
+		Sender    string `json:"sender"`
+		Message   string `json:"msg"`
+	}
+)
+
+const (
+	levelDebug tLogLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+const (
+	// The header to send (and receive) the request ID.
+	requestIDHeader = `X-Request-ID`
+
+	// Time format of the structured log messages.
+	logTimeFormat = `2006-01-02T15:04:05.000Z07:00`
+)
+
+var (
+	// The names of the log levels.
+	logLevelNames = map[tLogLevel]string{
+		levelDebug: `debug`,
+		levelInfo:  `info`,
+		levelWarn:  `warn`,
+		levelError: `error`,
+	}
+
+	// The log levels by name.
+	logLevels = map[string]tLogLevel{
+		`debug`: levelDebug,
+		`info`:  levelInfo,
+		`warn`:  levelWarn,
+		`error`: levelError,
+	}
+
+	// Guard against interleaved log lines.
+	logMtx sync.Mutex
+
+	// Where to write the structured log messages (for testing);
+	// if `nil` the `errorLog` file or `stderr` is used.
+	logOutput io.Writer
+
+	// Fallback for request IDs if there's no random data.
+	logRequestCounter uint64
+
+	// RegEx to validate request IDs sent by the client.
+	logRequestIDRE = regexp.MustCompile(`^[\w.:-]{1,64}$`)
+)
+
+// `logContext()` logs `aMessage` of `aSender` with the request ID
+// found in `aContext`.
+//
+//	`aContext` The current web request's context.
+//	`aLevel` The message's importance.
+//	`aSender` The name of the function reporting the message.
+//	`aMessage` The message to log.
+func logContext(aContext context.Context, aLevel tLogLevel, aSender, aMessage string) {
+	logEntry(aLevel, db.RequestID(aContext), aSender, aMessage)
+} // logContext()
+
+// `logDB()` logs the messages of the `db` package.
+//
+//	`aContext` The current web request's context.
+//	`aLevel` The message's level (`debug`, `info`, `warn`, or `error`).
+//	`aSender` The name of the function reporting the message.
+//	`aMessage` The message to log.
+func logDB(aContext context.Context, aLevel, aSender, aMessage string) {
+	level, ok := logLevels[aLevel]
+	if !ok {
+		level = levelError
+	}
+	logContext(aContext, level, aSender, aMessage)
+} // logDB()
+
+// `logEntry()` logs `aMessage` according to the `logFormat` and
+// `logLevel` options.
+//
+// Errors are kept for the admin page as well.
+//
+//	`aLevel` The message's importance.
+//	`aRequestID` The ID of the web request (may be empty).
+//	`aSender` The name of the function reporting the message.
+//	`aMessage` The message to log.
+func logEntry(aLevel tLogLevel, aRequestID, aSender, aMessage string) {
+	if aLevel < logMinLevel() {
+		return
+	}
+	now := time.Now()
+	if levelError == aLevel {
+		adminErrors.add(tLogEntry{
+			Message:   aMessage,
+			RequestID: aRequestID,
+			Sender:    aSender,
+			Time:      now,
+		})
+	}
+
+	var line []byte
+	switch AppArgs.LogFormat {
+	case `json`:
+		line, _ = json.Marshal(tJSONLogEntry{
+			Time:      now.Format(logTimeFormat),
+			Level:     logLevelNames[aLevel],
+			RequestID: aRequestID,
+			Sender:    aSender,
+			Message:   aMessage,
+		})
+		line = append(line, '\n')
+
+	case `logfmt`:
+		var sb strings.Builder
+		sb.WriteString(`time=` + now.Format(logTimeFormat))
+		sb.WriteString(` level=` + logLevelNames[aLevel])
+		if 0 < len(aRequestID) {
+			sb.WriteString(` request_id=` + logfmtValue(aRequestID))
+		}
+		sb.WriteString(` sender=` + logfmtValue(aSender))
+		sb.WriteString(` msg=` + logfmtValue(aMessage) + "\n")
+		line = []byte(sb.String())
+
+	default:
+		if 0 < len(aRequestID) {
+			aMessage = `[` + aRequestID + `] ` + aMessage
+		}
+		if levelError != aLevel {
+			aMessage = strings.ToUpper(logLevelNames[aLevel]) + `: ` + aMessage
+		}
+		apachelogger.Err(aSender, aMessage)
+		return
+	}
+
+	logWrite(line)
+} // logEntry()
+
+// `logError()` logs the error `aMessage` of `aSender`.
+//
+//	`aSender` The name of the function reporting the error.
+//	`aMessage` The error message to log.
+func logError(aSender, aMessage string) {
+	logEntry(levelError, ``, aSender, aMessage)
+} // logError()
+
+// `logfmtValue()` returns `aValue` quoted if necessary.
+//
+//	`aValue` The value to prepare for a `logfmt` line.
+func logfmtValue(aValue string) string {
+	if (0 == len(aValue)) || strings.ContainsAny(aValue, " \t\r\n\"=\\") {
+		return strconv.Quote(aValue)
+	}
+
+	return aValue
+} // logfmtValue()
+
+// `logMinLevel()` returns the least important level to log.
+func logMinLevel() tLogLevel {
+	if level, ok := logLevels[AppArgs.LogLevel]; ok {
+		return level
+	}
+
+	return levelInfo
+} // logMinLevel()
+
+// `logRequest()` logs the error `aMessage` of `aSender` with the ID
+// of `aRequest`.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aSender` The name of the function reporting the error.
+//	`aMessage` The error message to log.
+func logRequest(aRequest *http.Request, aSender, aMessage string) {
+	logContext(aRequest.Context(), levelError, aSender, aMessage)
+} // logRequest()
+
+// `warnRequest()` logs the warning `aMessage` of `aSender` with the
+// ID of `aRequest`.
+//
+// Failures caused by the client (like failed logins) are warnings
+// so that they don't crowd out the server's errors on the admin page.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aSender` The name of the function reporting the failure.
+//	`aMessage` The message to log.
+func warnRequest(aRequest *http.Request, aSender, aMessage string) {
+	logContext(aRequest.Context(), levelWarn, aSender, aMessage)
+} // warnRequest()
+
+// `logWrite()` writes `aLine` to the `errorLog` file or `stderr`.
+//
+//	`aLine` The log message to write.
+func logWrite(aLine []byte) {
+	logMtx.Lock()
+	defer logMtx.Unlock()
+
+	if nil != logOutput {
+		_, _ = logOutput.Write(aLine)
+		return
+	}
+	if 0 < len(AppArgs.ErrorLog) {
+		// The file is opened for each message so that it can be
+		// rotated without restarting the server.
+		file, err := os.OpenFile(AppArgs.ErrorLog,
+			os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640) /* #nosec G302 */
+		if nil == err {
+			_, _ = file.Write(aLine)
+			_ = file.Close()
+			return
+		}
+	}
+	_, _ = os.Stderr.Write(aLine)
+} // logWrite()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `newRequestID()` returns a new random request ID.
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); nil != err {
+		return fmt.Sprintf("%x-%d", time.Now().UnixNano(),
+			atomic.AddUint64(&logRequestCounter, 1))
+	}
+
+	return hex.EncodeToString(buf)
+} // newRequestID()
+
+// `requestID()` returns the ID to use for `aRequest`: either the
+// `X-Request-ID` header sent by the client (e.g. a proxy) or a newly
+// generated ID.
+//
+//	`aRequest` The HTTP request received by the server.
+func requestID(aRequest *http.Request) string {
+	if id := aRequest.Header.Get(requestIDHeader); logRequestIDRE.MatchString(id) {
+		return id
+	}
+
+	return newRequestID()
+} // requestID()
+
+/* _EoF_ */
@@ -0,0 +1,211 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func Test_logEntry(t *testing.T) {
+	savedFormat, savedLevel := AppArgs.LogFormat, AppArgs.LogLevel
+	defer func() {
+		AppArgs.LogFormat, AppArgs.LogLevel = savedFormat, savedLevel
+		logOutput = nil
+	}()
+	buf := &bytes.Buffer{}
+	logOutput = buf
+	ctx := db.WithRequestID(context.TODO(), `abc123`)
+
+	tests := []struct {
+		name   string
+		format string
+		level  string
+		lvl    tLogLevel
+		msg    string
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `json`, `info`, levelError, `query failed`,
+			`{"time":"*","level":"error","request_id":"abc123","sender":"test()","msg":"query failed"}`},
+		{" 2", `logfmt`, `info`, levelWarn, `user "bob" denied`,
+			`time=* level=warn request_id=abc123 sender=test() msg="user \"bob\" denied"`},
+		{" 3", `logfmt`, `info`, levelDebug, `hidden`, ``},
+		{" 4", `logfmt`, `debug`, levelDebug, `shown`,
+			`time=* level=debug request_id=abc123 sender=test() msg=shown`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			AppArgs.LogFormat, AppArgs.LogLevel = tt.format, tt.level
+			logContext(ctx, tt.lvl, `test()`, tt.msg)
+			got := strings.TrimSpace(buf.String())
+			want := regexp.QuoteMeta(tt.want)
+			want = `^` + strings.Replace(want, `\*`, `[^" ]+`, 1) + `$`
+			if !regexp.MustCompile(want).MatchString(got) {
+				t.Errorf("logContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_logEntry()
+
+func Test_logEntryFail2ban(t *testing.T) {
+	savedFormat := AppArgs.LogFormat
+	defer func() {
+		AppArgs.LogFormat = savedFormat
+		logOutput = nil
+	}()
+	buf := &bytes.Buffer{}
+	logOutput = buf
+
+	// The `failregex` documented in the INI file:
+	ini, err := os.ReadFile(`kaliber.ini`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	match := regexp.MustCompile("(?m)^\\s*#\\s+`(authentication .*<HOST>)`$").FindSubmatch(ini)
+	if nil == match {
+		t.Fatal("kaliber.ini: missing `failregex`")
+	}
+	failRE := regexp.MustCompile(strings.Replace(string(match[1]),
+		`<HOST>`, `([0-9a-fA-F.:]+)`, 1))
+
+	tests := []struct {
+		name   string
+		format string
+		user   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `apache`, `bob`},
+		{" 2", `json`, `bob`},
+		{" 3", `logfmt`, `bob`},
+		{" 4", `json`, `x" rhost=10.0.0.1`},
+		{" 5", `logfmt`, `x" rhost=10.0.0.1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			AppArgs.LogFormat = tt.format
+			msg := fmt.Sprintf("authentication failure; user=%q rhost=%s",
+				tt.user, `192.0.2.1`)
+			logEntry(levelWarn, `abc123`, `test()`, msg)
+			line := buf.String()
+			if `apache` == tt.format {
+				// written by `apachelogger.Err()` unchanged:
+				line = `[abc123] WARN: ` + msg
+			}
+			got := failRE.FindStringSubmatch(line)
+			if (nil == got) || (`192.0.2.1` != got[2]) {
+				t.Errorf("failregex doesn't match %q: %v", line, got)
+			}
+		})
+	}
+} // Test_logEntryFail2ban()
+
+func Test_warnRequest(t *testing.T) {
+	savedErrors, savedFormat := adminErrors, AppArgs.LogFormat
+	defer func() {
+		adminErrors, AppArgs.LogFormat = savedErrors, savedFormat
+		logOutput = nil
+	}()
+	adminErrors = &tErrorList{entries: make([]tLogEntry, 0, adminErrorsLength)}
+	AppArgs.LogFormat = `logfmt`
+	logOutput = &bytes.Buffer{}
+	r := httptest.NewRequest(`GET`, `/`, nil)
+
+	// Client-caused failures don't show up on the admin page ...
+	warnRequest(r, `test()`, `authentication failure; user="bob" rhost=192.0.2.1`)
+	if n := len(adminErrors.list()); 0 != n {
+		t.Errorf("warnRequest() admin errors = %d, want 0", n)
+	}
+	// ... but the server's errors do:
+	logRequest(r, `test()`, `query failed`)
+	if n := len(adminErrors.list()); 1 != n {
+		t.Errorf("logRequest() admin errors = %d, want 1", n)
+	}
+} // Test_warnRequest()
+
+func Test_requestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `proxy-4711`, `proxy-4711`},
+		{" 2", `<script>`, ``},
+		{" 3", strings.Repeat(`x`, 65), ``},
+		{" 4", ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(`GET`, `/`, nil)
+			if 0 < len(tt.header) {
+				r.Header.Set(requestIDHeader, tt.header)
+			}
+			got := requestID(r)
+			if 0 < len(tt.want) {
+				if got != tt.want {
+					t.Errorf("requestID() = %q, want %q", got, tt.want)
+				}
+			} else if (got == tt.header) || (16 != len(got)) {
+				t.Errorf("requestID() = %q, want a new ID", got)
+			}
+		})
+	}
+} // Test_requestID()
+
+func TestWrapErrorPages(t *testing.T) {
+	vl, err := newViewList(`./views`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	handler := WrapErrorPages(&TPageHandler{viewList: vl})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `/no/such/page`, http.StatusNotFound, `404`},
+		{" 2", `/t/bogus/opds`, http.StatusUnauthorized, `invalid API token`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(`GET`, tt.path, nil)
+			r.Header.Set(requestIDHeader, `proxy-4711`)
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("WrapErrorPages() status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get(requestIDHeader); `proxy-4711` != got {
+				t.Errorf("WrapErrorPages() %s = %q, want %q", requestIDHeader, got, `proxy-4711`)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, `<code>proxy-4711</code>`) ||
+				!strings.Contains(body, tt.want) {
+				t.Errorf("WrapErrorPages() = %q,\nmisses request ID or %q", body, tt.want)
+			}
+		})
+	}
+} // TestWrapErrorPages()
+
+/* _EoF_ */
@@ -0,0 +1,388 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides the server's metrics in Prometheus' text
+ * exposition format (`/metrics`).
+ *
+ * The page is available only to clients from the `metricsAllow`
+ * networks or sending the `metricsToken` as an
+ * `Authorization: Bearer {token}` header.
+ * Requests forwarded by a reverse proxy which isn't listed in
+ * `trustedProxies` need the token since their client's IP is unknown.
+ */
+
+type (
+	// `tHistogram` counts observed durations in cumulative buckets.
+	tHistogram struct {
+		buckets []uint64 // observations per upper bound (cumulative)
+		count   uint64   // number of observations
+		sum     float64  // sum of all observations (in seconds)
+	}
+
+	// `tRequestKey` identifies the requests counted per route and
+	// status code.
+	tRequestKey struct {
+		route string
+		code  int
+	}
+
+	// `tMetrics` collects the server's metrics.
+	tMetrics struct {
+		sync.Mutex
+		bytes       map[string]int64       // bytes sent per format
+		durations   map[string]*tHistogram // request durations per route
+		queries     *tHistogram            // DB query durations
+		requests    map[tRequestKey]int64  // requests per route and code
+		thumbHits   int64                  // thumbnails found in cache
+		thumbMisses int64                  // thumbnails to generate
+		thumbTimes  *tHistogram            // thumbnail generation durations
+	}
+
+	// `tStatusWriter` remembers an HTTP response's status code.
+	tStatusWriter struct {
+		http.ResponseWriter
+		status int
+	}
+)
+
+var (
+	// Upper bounds (in seconds) of the histograms' buckets.
+	metricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// The routes of `handleGET()` and `handlePOST()`; all other
+	// requests are counted as `other`.
+	metricsRoutes = map[string]bool{
+		`account`: true, `admin`: true, `api`: true, `authors`: true,
+		`back`: true, `bookmark`: true, `certs`: true, `comic`: true,
+		`cover`: true, `css`: true, `datenschutz`: true, `doc`: true,
+		`faq`: true, `favicon.ico`: true, `favourites`: true,
+		`feed`: true, `file`: true, `first`: true, `fonts`: true,
+		`format`: true, `healthz`: true, `help`: true, `hilfe`: true,
+		`img`: true, `imprint`: true, `impressum`: true,
+		`languages`: true, `last`: true, `licence`: true,
+		`license`: true, `lizenz`: true, `metrics`: true, `next`: true,
+		`opds`: true, `opds2`: true, `opensearch.xml`: true,
+		`post`: true, `prev`: true, `privacy`: true, `publisher`: true,
+		`qo`: true, `read`: true, `reading`: true, `readyz`: true,
+		`robots.txt`: true, `search`: true, `send`: true,
+		`series`: true, `sessions`: true, `shelf`: true,
+		`shelves`: true, `suggest`: true, `tags`: true, `thumb`: true,
+		`views`: true, `zip`: true,
+	}
+
+	// The server's metrics.
+	srvMetrics = newMetrics()
+)
+
+// `newHistogram()` returns a new `tHistogram` instance.
+func newHistogram() *tHistogram {
+	return &tHistogram{
+		buckets: make([]uint64, len(metricsBuckets)),
+	}
+} // newHistogram()
+
+// `observe()` adds `aDuration` to the histogram.
+//
+//	`aDuration` The duration to count.
+func (h *tHistogram) observe(aDuration time.Duration) {
+	seconds := aDuration.Seconds()
+	for idx, bound := range metricsBuckets {
+		if seconds <= bound {
+			h.buckets[idx]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+} // observe()
+
+// `write()` writes the histogram `aName` to `aWriter`.
+//
+//	`aWriter` The writer to use.
+//	`aName` The histogram's name.
+//	`aLabels` Additional labels (e.g. `route="doc"`), may be empty.
+func (h *tHistogram) write(aWriter io.Writer, aName, aLabels string) {
+	prefix := ``
+	if 0 < len(aLabels) {
+		prefix = aLabels + `,`
+	}
+	for idx, bound := range metricsBuckets {
+		fmt.Fprintf(aWriter, "%s_bucket{%sle=%q} %d\n", aName, prefix,
+			strconv.FormatFloat(bound, 'g', -1, 64), h.buckets[idx])
+	}
+	fmt.Fprintf(aWriter, "%s_bucket{%sle=\"+Inf\"} %d\n", aName, prefix, h.count)
+	if 0 < len(aLabels) {
+		aLabels = `{` + aLabels + `}`
+	}
+	fmt.Fprintf(aWriter, "%s_sum%s %s\n", aName, aLabels,
+		strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(aWriter, "%s_count%s %d\n", aName, aLabels, h.count)
+} // write()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `newMetrics()` returns a new `tMetrics` instance.
+func newMetrics() *tMetrics {
+	return &tMetrics{
+		bytes:      make(map[string]int64),
+		durations:  make(map[string]*tHistogram),
+		queries:    newHistogram(),
+		requests:   make(map[tRequestKey]int64),
+		thumbTimes: newHistogram(),
+	}
+} // newMetrics()
+
+// `addBytes()` counts `aBytes` sent of a document in `aFormat`.
+//
+//	`aFormat` The document's format (e.g. `EPUB`).
+//	`aBytes` The number of bytes sent.
+func (m *tMetrics) addBytes(aFormat string, aBytes int64) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.bytes[strings.ToUpper(aFormat)] += aBytes
+} // addBytes()
+
+// `observeQuery()` counts a database query.
+//
+//	`aDuration` The query's duration.
+func (m *tMetrics) observeQuery(aDuration time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.queries.observe(aDuration)
+} // observeQuery()
+
+// `observeRequest()` counts an HTTP request.
+//
+//	`aRoute` The request's route (i.e. the first URL path part).
+//	`aStatus` The reply's HTTP status code.
+//	`aDuration` The request's duration.
+func (m *tMetrics) observeRequest(aRoute string, aStatus int, aDuration time.Duration) {
+	if `` == aRoute {
+		aRoute = `first`
+	} else if !metricsRoutes[aRoute] {
+		aRoute = `other`
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	m.requests[tRequestKey{aRoute, aStatus}]++
+	h, ok := m.durations[aRoute]
+	if !ok {
+		h = newHistogram()
+		m.durations[aRoute] = h
+	}
+	h.observe(aDuration)
+} // observeRequest()
+
+// `observeThumb()` counts a thumbnail request.
+//
+//	`aHit` Whether the thumbnail was found in the cache.
+func (m *tMetrics) observeThumb(aHit bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	if aHit {
+		m.thumbHits++
+	} else {
+		m.thumbMisses++
+	}
+} // observeThumb()
+
+// `observeThumbTime()` counts a thumbnail generation.
+//
+//	`aDuration` The generation's duration.
+func (m *tMetrics) observeThumbTime(aDuration time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.thumbTimes.observe(aDuration)
+} // observeThumbTime()
+
+// `write()` writes all metrics to `aWriter`.
+//
+//	`aWriter` The writer to use.
+func (m *tMetrics) write(aWriter io.Writer) {
+	pool := db.PoolStats()
+	status := db.SyncStatus()
+
+	m.Lock()
+	defer m.Unlock()
+
+	keys := make([]tRequestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route == keys[j].route {
+			return keys[i].code < keys[j].code
+		}
+		return keys[i].route < keys[j].route
+	})
+	writeMetricHead(aWriter, `kaliber_http_requests_total`, `counter`,
+		`Number of HTTP requests per route and status code.`)
+	for _, key := range keys {
+		fmt.Fprintf(aWriter, "kaliber_http_requests_total{route=%q,code=\"%d\"} %d\n",
+			key.route, key.code, m.requests[key])
+	}
+
+	routes := make([]string, 0, len(m.durations))
+	for route := range m.durations {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	writeMetricHead(aWriter, `kaliber_http_request_duration_seconds`, `histogram`,
+		`Duration of HTTP requests per route.`)
+	for _, route := range routes {
+		m.durations[route].write(aWriter, `kaliber_http_request_duration_seconds`,
+			fmt.Sprintf("route=%q", route))
+	}
+
+	formats := make([]string, 0, len(m.bytes))
+	for format := range m.bytes {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	writeMetricHead(aWriter, `kaliber_bytes_served_total`, `counter`,
+		`Number of document bytes sent per format.`)
+	for _, format := range formats {
+		fmt.Fprintf(aWriter, "kaliber_bytes_served_total{format=%q} %d\n",
+			format, m.bytes[format])
+	}
+
+	writeMetricHead(aWriter, `kaliber_db_query_duration_seconds`, `histogram`,
+		`Duration of database queries.`)
+	m.queries.write(aWriter, `kaliber_db_query_duration_seconds`, ``)
+
+	writeMetric(aWriter, `kaliber_db_pool_idle_connections`, `gauge`,
+		`Number of idle database connections.`, int64(pool.Size))
+	writeMetric(aWriter, `kaliber_db_pool_opened_total`, `counter`,
+		`Number of database connections opened.`, pool.Opened)
+	writeMetric(aWriter, `kaliber_db_pool_reused_total`, `counter`,
+		`Number of database connections reused.`, pool.Reused)
+	writeMetric(aWriter, `kaliber_db_sync_copies_total`, `counter`,
+		`Number of copies of the Calibre database.`, status.Copies)
+	writeMetric(aWriter, `kaliber_db_sync_failures_total`, `counter`,
+		`Number of failed syncs of the Calibre database.`, status.Failures)
+
+	writeMetric(aWriter, `kaliber_thumbnail_cache_hits_total`, `counter`,
+		`Number of thumbnails found in the cache.`, m.thumbHits)
+	writeMetric(aWriter, `kaliber_thumbnail_cache_misses_total`, `counter`,
+		`Number of thumbnails missing in the cache.`, m.thumbMisses)
+	writeMetricHead(aWriter, `kaliber_thumbnail_generation_seconds`, `histogram`,
+		`Duration of thumbnail generations.`)
+	m.thumbTimes.write(aWriter, `kaliber_thumbnail_generation_seconds`, ``)
+} // write()
+
+// `writeMetric()` writes the single value metric `aName` to `aWriter`.
+//
+//	`aWriter` The writer to use.
+//	`aName` The metric's name.
+//	`aType` The metric's type (`counter` or `gauge`).
+//	`aHelp` The metric's description.
+//	`aValue` The metric's value.
+func writeMetric(aWriter io.Writer, aName, aType, aHelp string, aValue int64) {
+	writeMetricHead(aWriter, aName, aType, aHelp)
+	fmt.Fprintf(aWriter, "%s %d\n", aName, aValue)
+} // writeMetric()
+
+// `writeMetricHead()` writes the `HELP` and `TYPE` lines of the
+// metric `aName` to `aWriter`.
+//
+//	`aWriter` The writer to use.
+//	`aName` The metric's name.
+//	`aType` The metric's type (`counter`, `gauge`, or `histogram`).
+//	`aHelp` The metric's description.
+func writeMetricHead(aWriter io.Writer, aName, aType, aHelp string) {
+	fmt.Fprintf(aWriter, "# HELP %s %s\n# TYPE %s %s\n", aName, aHelp, aName, aType)
+} // writeMetricHead()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// WriteHeader remembers and sends the HTTP response's status code.
+//
+//	`aStatus` The HTTP status code to send.
+func (sw *tStatusWriter) WriteHeader(aStatus int) {
+	if 0 == sw.status {
+		sw.status = aStatus
+	}
+	sw.ResponseWriter.WriteHeader(aStatus)
+} // WriteHeader()
+
+// `code()` returns the HTTP response's status code.
+func (sw *tStatusWriter) code() int {
+	if 0 == sw.status {
+		return http.StatusOK
+	}
+
+	return sw.status
+} // code()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleMetrics()` sends the server's metrics.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleMetrics(aWriter http.ResponseWriter, aRequest *http.Request) {
+	if (0 == len(ph.metricsNets)) && (0 == len(AppArgs.MetricsToken)) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	if !ph.metricsAllowed(aRequest) {
+		msg := fmt.Sprintf("client %s may not access %q", clientIP(aRequest), aRequest.URL.Path)
+		logContext(aRequest.Context(), levelWarn, "TPageHandler.handleMetrics()", msg)
+
+		http.Error(aWriter, `access forbidden`, http.StatusForbidden)
+		return
+	}
+
+	aWriter.Header().Set(`Cache-Control`, `no-store`)
+	aWriter.Header().Set(`Content-Type`, `text/plain; version=0.0.4; charset=utf-8`)
+	srvMetrics.write(aWriter)
+} // handleMetrics()
+
+// `metricsAllowed()` reports whether the client may access the
+// metrics.
+//
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) metricsAllowed(aRequest *http.Request) bool {
+	if token := AppArgs.MetricsToken; 0 < len(token) {
+		if auth := aRequest.Header.Get(`Authorization`); (7 < len(auth)) &&
+			strings.EqualFold(`Bearer `, auth[:7]) &&
+			(1 == subtle.ConstantTimeCompare([]byte(strings.TrimSpace(auth[7:])), []byte(token))) {
+			return true
+		}
+	}
+
+	if viaUntrustedProxy(aRequest) {
+		// The proxy's address would stand in for all its clients.
+		return false
+	}
+
+	return inNetworks(clientIP(aRequest), ph.metricsNets)
+} // metricsAllowed()
+
+/* _EoF_ */
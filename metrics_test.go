@@ -0,0 +1,152 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tHistogram_write(t *testing.T) {
+	h := newHistogram()
+	h.observe(20 * time.Millisecond)
+	h.observe(3 * time.Second)
+	buf := &bytes.Buffer{}
+	h.write(buf, `test_seconds`, `route="doc"`)
+	got := buf.String()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", "test_seconds_bucket{route=\"doc\",le=\"0.01\"} 0\n"},
+		{" 2", "test_seconds_bucket{route=\"doc\",le=\"0.025\"} 1\n"},
+		{" 3", "test_seconds_bucket{route=\"doc\",le=\"5\"} 2\n"},
+		{" 4", "test_seconds_bucket{route=\"doc\",le=\"+Inf\"} 2\n"},
+		{" 5", "test_seconds_sum{route=\"doc\"} 3.02\n"},
+		{" 6", "test_seconds_count{route=\"doc\"} 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("tHistogram.write() = %s\nmisses %q", got, tt.want)
+			}
+		})
+	}
+} // Test_tHistogram_write()
+
+func Test_tMetrics_observeRequest(t *testing.T) {
+	m := newMetrics()
+	m.observeRequest(``, http.StatusOK, time.Millisecond)
+	m.observeRequest(`doc`, http.StatusOK, time.Millisecond)
+	m.observeRequest(`doc`, http.StatusNotFound, time.Millisecond)
+	m.observeRequest(`wp-login.php`, http.StatusNotFound, time.Millisecond)
+	m.addBytes(`epub`, 100)
+	m.addBytes(`EPUB`, 20)
+	buf := &bytes.Buffer{}
+	m.write(buf)
+	got := buf.String()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", "kaliber_http_requests_total{route=\"first\",code=\"200\"} 1\n"},
+		{" 2", "kaliber_http_requests_total{route=\"doc\",code=\"200\"} 1\n"},
+		{" 3", "kaliber_http_requests_total{route=\"doc\",code=\"404\"} 1\n"},
+		{" 4", "kaliber_http_requests_total{route=\"other\",code=\"404\"} 1\n"},
+		{" 5", "kaliber_http_request_duration_seconds_count{route=\"doc\"} 2\n"},
+		{" 6", "kaliber_bytes_served_total{format=\"EPUB\"} 120\n"},
+		{" 7", "# TYPE kaliber_db_pool_idle_connections gauge\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("tMetrics.write() = %s\nmisses %q", got, tt.want)
+			}
+		})
+	}
+} // Test_tMetrics_observeRequest()
+
+func TestTPageHandler_handleMetrics(t *testing.T) {
+	saved, savedProxies := AppArgs.MetricsToken, trustedProxies
+	defer func() { AppArgs.MetricsToken, trustedProxies = saved, savedProxies }()
+	nets, _ := parseNetworks(`10.0.0.0/8`)
+	trustedProxies, _ = parseNetworks(`10.9.9.9`)
+
+	tests := []struct {
+		name   string
+		nets   string
+		token  string
+		remote string
+		xff    string
+		auth   string
+		want   int
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, ``, `10.1.2.3:1234`, ``, ``, http.StatusNotFound},
+		{" 2", `10.0.0.0/8`, ``, `10.1.2.3:1234`, ``, ``, http.StatusOK},
+		{" 3", `10.0.0.0/8`, ``, `192.0.2.1:1234`, ``, ``, http.StatusForbidden},
+		{" 4", `10.0.0.0/8`, `secret`, `192.0.2.1:1234`, ``, `Bearer secret`, http.StatusOK},
+		{" 5", ``, `secret`, `192.0.2.1:1234`, ``, `Bearer wrong`, http.StatusForbidden},
+		{" 6", ``, `secret`, `192.0.2.1:1234`, ``, ``, http.StatusForbidden},
+		{" 7", `10.0.0.0/8`, ``, `10.1.2.3:1234`, `192.0.2.1`, ``, http.StatusForbidden},
+		{" 8", `10.0.0.0/8`, `secret`, `10.1.2.3:1234`, `192.0.2.1`, `Bearer secret`, http.StatusOK},
+		{" 9", `10.0.0.0/8`, ``, `10.9.9.9:1234`, `192.0.2.1`, ``, http.StatusForbidden},
+		{"10", `10.0.0.0/8`, ``, `10.9.9.9:1234`, `10.1.2.3`, ``, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ph := &TPageHandler{}
+			if 0 < len(tt.nets) {
+				ph.metricsNets = nets
+			}
+			AppArgs.MetricsToken = tt.token
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(`GET`, `/metrics`, nil)
+			r.RemoteAddr = tt.remote
+			if 0 < len(tt.xff) {
+				r.Header.Set(`X-Forwarded-For`, tt.xff)
+			}
+			if 0 < len(tt.auth) {
+				r.Header.Set(`Authorization`, tt.auth)
+			}
+			ph.handleMetrics(w, r)
+			if w.Code != tt.want {
+				t.Errorf("handleMetrics() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+} // TestTPageHandler_handleMetrics()
+
+func TestTPageHandler_ServeHTTP_route(t *testing.T) {
+	saved := srvMetrics
+	defer func() { srvMetrics = saved }()
+	srvMetrics = newMetrics()
+	ph := &TPageHandler{}
+
+	// A refused API token is counted for the requested route:
+	w := httptest.NewRecorder()
+	ph.ServeHTTP(w, httptest.NewRequest(`GET`, `/t/bogus/opds`, nil))
+	if http.StatusUnauthorized != w.Code {
+		t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	key := tRequestKey{`opds`, http.StatusUnauthorized}
+	if got := srvMetrics.requests[key]; 1 != got {
+		t.Errorf("ServeHTTP() requests[%v] = %d, want 1", key, got)
+	}
+} // TestTPageHandler_ServeHTTP_route()
+
+/* _EoF_ */
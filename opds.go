@@ -0,0 +1,489 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides an OPDS 1.2 catalog (Atom feeds) to be used
+ * by e-reader applications.
+ */
+
+const (
+	// MIME type of OPDS acquisition feeds.
+	opdsAcquisitionType = `application/atom+xml;profile=opds-catalog;kind=acquisition`
+
+	// MIME type of OPDS navigation feeds.
+	opdsNavigationType = `application/atom+xml;profile=opds-catalog;kind=navigation`
+
+	// Link relations defined by the OPDS specification.
+	opdsRelAcquisition = `http://opds-spec.org/acquisition`
+	opdsRelImage       = `http://opds-spec.org/image`
+	opdsRelSortNew     = `http://opds-spec.org/sort/new`
+	opdsRelThumbnail   = `http://opds-spec.org/image/thumbnail`
+)
+
+type (
+	// `tOPDSAuthor` is the author of an Atom feed or entry.
+	tOPDSAuthor struct {
+		Name string `xml:"name"`
+		URI  string `xml:"uri,omitempty"`
+	}
+
+	// `tOPDSCategory` is a category (i.e. tag) of an Atom entry.
+	tOPDSCategory struct {
+		Term  string `xml:"term,attr"`
+		Label string `xml:"label,attr,omitempty"`
+	}
+
+	// `tOPDSContent` is the textual content of an Atom entry.
+	tOPDSContent struct {
+		Type string `xml:"type,attr"`
+		Text string `xml:",chardata"`
+	}
+
+	// `tOPDSLink` is a link of an Atom feed or entry
+	// (and of an OPDS 2.0 JSON feed as well).
+	tOPDSLink struct {
+		Href       string          `xml:"href,attr" json:"href"`
+		Rel        string          `xml:"rel,attr,omitempty" json:"rel,omitempty"`
+		Type       string          `xml:"type,attr,omitempty" json:"type,omitempty"`
+		Title      string          `xml:"title,attr,omitempty" json:"title,omitempty"`
+		Templated  bool            `xml:"-" json:"templated,omitempty"`
+		Properties *tOPDSLinkProps `xml:"-" json:"properties,omitempty"`
+	}
+
+	// `tOPDSLinkProps` holds additional properties of an OPDS 2.0 link.
+	tOPDSLinkProps struct {
+		NumberOfItems int `json:"numberOfItems,omitempty"`
+	}
+
+	// `tOPDSEntry` is a single entry of an Atom feed.
+	tOPDSEntry struct {
+		Title      string          `xml:"title"`
+		ID         string          `xml:"id"`
+		Updated    string          `xml:"updated"`
+		Authors    []tOPDSAuthor   `xml:"author"`
+		Languages  []string        `xml:"dc:language"`
+		Publisher  string          `xml:"dc:publisher,omitempty"`
+		Issued     string          `xml:"dc:issued,omitempty"`
+		Categories []tOPDSCategory `xml:"category"`
+		Content    *tOPDSContent   `xml:"content,omitempty"`
+		Links      []tOPDSLink     `xml:"link"`
+	}
+
+	// `tOPDSFeed` is an OPDS catalog (i.e. Atom) feed.
+	tOPDSFeed struct {
+		XMLName      xml.Name     `xml:"feed"`
+		Xmlns        string       `xml:"xmlns,attr"`
+		XmlnsDC      string       `xml:"xmlns:dc,attr"`
+		XmlnsOPDS    string       `xml:"xmlns:opds,attr"`
+		XmlnsOS      string       `xml:"xmlns:opensearch,attr"`
+		ID           string       `xml:"id"`
+		Title        string       `xml:"title"`
+		Updated      string       `xml:"updated"`
+		Author       *tOPDSAuthor `xml:"author,omitempty"`
+		TotalResults uint         `xml:"opensearch:totalResults,omitempty"`
+		ItemsPerPage uint         `xml:"opensearch:itemsPerPage,omitempty"`
+		StartIndex   uint         `xml:"opensearch:startIndex,omitempty"`
+		Links        []tOPDSLink  `xml:"link"`
+		Entries      []tOPDSEntry `xml:"entry"`
+	}
+)
+
+var (
+	// `opdsEntityTitles` maps the browsable entities to their titles.
+	opdsEntityTitles = map[string]string{
+		`authors`:   `Authors`,
+		`languages`: `Languages`,
+		`publisher`: `Publishers`,
+		`series`:    `Series`,
+		`tags`:      `Tags`,
+	}
+
+	// `opdsMimeTypes` maps `Calibre's` format names to MIME types.
+	opdsMimeTypes = map[string]string{
+		`AZW`:   `application/vnd.amazon.ebook`,
+		`AZW3`:  `application/vnd.amazon.ebook`,
+		`CBR`:   `application/vnd.comicbook-rar`,
+		`CBZ`:   `application/vnd.comicbook+zip`,
+		`DJVU`:  `image/vnd.djvu`,
+		`DOCX`:  `application/vnd.openxmlformats-officedocument.wordprocessingml.document`,
+		`EPUB`:  `application/epub+zip`,
+		`FB2`:   `application/x-fictionbook+xml`,
+		`HTML`:  `text/html`,
+		`KEPUB`: `application/kepub+zip`,
+		`LIT`:   `application/x-ms-reader`,
+		`MOBI`:  `application/x-mobipocket-ebook`,
+		`ODT`:   `application/vnd.oasis.opendocument.text`,
+		`PDF`:   `application/pdf`,
+		`RTF`:   `application/rtf`,
+		`TXT`:   `text/plain`,
+	}
+)
+
+// `opdsMimeType()` returns the MIME type of the document `aFormat`.
+//
+//	`aFormat` The `Calibre` format name (e.g. `EPUB`).
+func opdsMimeType(aFormat string) string {
+	if result, ok := opdsMimeTypes[strings.ToUpper(aFormat)]; ok {
+		return result
+	}
+
+	return `application/octet-stream`
+} // opdsMimeType()
+
+// `newOPDSFeed()` returns a new feed with the given `aID` and `aTitle`.
+//
+//	`aID` The unique (relative) ID of the feed.
+//	`aTitle` The feed's title.
+func newOPDSFeed(aID, aTitle string) *tOPDSFeed {
+	return &tOPDSFeed{
+		Xmlns:     `http://www.w3.org/2005/Atom`,
+		XmlnsDC:   `http://purl.org/dc/terms/`,
+		XmlnsOPDS: `http://opds-spec.org/2010/catalog`,
+		XmlnsOS:   `http://a9.com/-/spec/opensearch/1.1/`,
+		ID:        `urn:kaliber:opds:` + aID,
+		Title:     AppArgs.Realm + `: ` + aTitle,
+		Updated:   time.Now().UTC().Format(time.RFC3339),
+		Author:    &tOPDSAuthor{Name: AppArgs.Realm},
+		Links: []tOPDSLink{
+			{Href: `/opds`, Rel: `start`, Type: opdsNavigationType},
+			{Href: `/opds/search?q={searchTerms}`, Rel: `search`, Type: opdsAcquisitionType},
+		},
+	}
+} // newOPDSFeed()
+
+// `opdsDocEntry()` returns the feed entry of `aDoc`.
+//
+//	`aDoc` The document to describe.
+func opdsDocEntry(aDoc *db.TDocument) tOPDSEntry {
+	result := tOPDSEntry{
+		Title:   aDoc.Title,
+		ID:      `urn:uuid:` + aDoc.UUID(),
+		Updated: aDoc.ModTime().UTC().Format(time.RFC3339),
+		Issued:  aDoc.PubDate(),
+	}
+	if list := aDoc.Authors(); nil != list {
+		for _, author := range *list {
+			result.Authors = append(result.Authors,
+				tOPDSAuthor{Name: author.Name, URI: `/opds` + author.URL})
+		}
+	}
+	if list := aDoc.Languages(); nil != list {
+		for _, lang := range *list {
+			result.Languages = append(result.Languages, lang.Name)
+		}
+	}
+	if pub := aDoc.Publisher(); nil != pub {
+		result.Publisher = pub.Name
+	}
+	if list := aDoc.Tags(); nil != list {
+		for _, tag := range *list {
+			result.Categories = append(result.Categories,
+				tOPDSCategory{Term: tag.Name, Label: tag.Name})
+		}
+	}
+	if comment := string(aDoc.Comment()); 0 < len(comment) {
+		result.Content = &tOPDSContent{Type: `html`, Text: comment}
+	}
+
+	result.Links = []tOPDSLink{
+		{Href: aDoc.Cover(), Rel: opdsRelImage, Type: `image/jpeg`},
+		{Href: aDoc.Thumb(), Rel: opdsRelThumbnail, Type: `image/jpeg`},
+		{Href: aDoc.DocLink(), Rel: `alternate`, Type: `text/html`, Title: aDoc.Title},
+	}
+	if series := aDoc.Series(); nil != series {
+		result.Links = append(result.Links, tOPDSLink{
+			Href:  `/opds` + series.URL,
+			Rel:   `related`,
+			Type:  opdsAcquisitionType,
+			Title: series.Name + ` [` + aDoc.SeriesIndex() + `]`,
+		})
+	}
+	if list := aDoc.Files(); nil != list {
+		for _, file := range *list {
+			result.Links = append(result.Links, tOPDSLink{
+				Href:  file.URL,
+				Rel:   opdsRelAcquisition,
+				Type:  opdsMimeType(file.Name),
+				Title: file.Name,
+			})
+		}
+	}
+
+	return result
+} // opdsDocEntry()
+
+// `opdsNavEntry()` returns a navigation entry pointing to another feed.
+//
+//	`aID` The unique (relative) ID of the entry.
+//	`aTitle` The entry's title.
+//	`aContent` A short description of the linked feed.
+//	`aHref` The URL of the linked feed.
+//	`aType` The MIME type of the linked feed.
+//	`aRel` The relation of the linked feed.
+func opdsNavEntry(aID, aTitle, aContent, aHref, aType, aRel string) tOPDSEntry {
+	return tOPDSEntry{
+		Title:   aTitle,
+		ID:      `urn:kaliber:opds:` + aID,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Content: &tOPDSContent{Type: `text`, Text: aContent},
+		Links:   []tOPDSLink{{Href: aHref, Rel: aRel, Type: aType}},
+	}
+} // opdsNavEntry()
+
+// `opdsPageLinks()` returns the self and pagination links of a feed.
+//
+//	`aURL` The requested URL of the feed.
+//	`aType` The MIME type of the feed.
+//	`aStart` The number of the feed's first entry.
+//	`aLength` The max. number of entries per page.
+//	`aCount` The total number of entries available.
+func opdsPageLinks(aURL *url.URL, aType string, aStart, aLength, aCount uint) []tOPDSLink {
+	href := func(aOffset uint) string {
+		query := aURL.Query()
+		if 0 == aOffset {
+			query.Del(`start`)
+		} else {
+			query.Set(`start`, strconv.FormatUint(uint64(aOffset), 10))
+		}
+		u := url.URL{Path: aURL.Path, RawQuery: query.Encode()}
+
+		return u.String()
+	} // href()
+
+	result := []tOPDSLink{{Href: href(aStart), Rel: `self`, Type: aType}}
+	if 0 == aLength {
+		return result
+	}
+	if 0 < aStart {
+		var prev uint
+		if aStart > aLength {
+			prev = aStart - aLength
+		}
+		result = append(result,
+			tOPDSLink{Href: href(0), Rel: `first`, Type: aType},
+			tOPDSLink{Href: href(prev), Rel: `previous`, Type: aType})
+	}
+	if aStart+aLength < aCount {
+		last := ((aCount - 1) / aLength) * aLength
+		result = append(result,
+			tOPDSLink{Href: href(aStart + aLength), Rel: `next`, Type: aType},
+			tOPDSLink{Href: href(last), Rel: `last`, Type: aType})
+	}
+
+	return result
+} // opdsPageLinks()
+
+// `opdsSendFeed()` writes the XML of `aFeed` to `aWriter`.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aFeed` The feed to send.
+//	`aType` The MIME type of the feed.
+func opdsSendFeed(aWriter http.ResponseWriter, aRequest *http.Request, aFeed *tOPDSFeed, aType string) {
+	page, err := xml.MarshalIndent(aFeed, ``, ` `)
+	if nil != err {
+		handleInternalError(aWriter, `opdsSendFeed()`,
+			fmt.Sprintf("xml.MarshalIndent(): %v", err))
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, aType+`;charset=utf-8`)
+	aWriter.Header().Set(`Cache-Control`, `no-cache`)
+	// Keep the API token of clients using the URL path prefix:
+	_, prefix := requestToken(aRequest)
+	_, _ = aWriter.Write([]byte(xml.Header))
+	_, _ = aWriter.Write(prefixLinks(page, prefix))
+} // opdsSendFeed()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleOPDS()` serves the OPDS catalog below `/opds`.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL path following `/opds/`.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleOPDS(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aDB *db.TDataBase) {
+	parts := strings.Split(strings.Trim(aTail, `/`), `/`)
+	qo := db.NewQueryOptions(AppArgs.BooksPerPage)
+	qo.Layout = db.QoLayoutList
+	if start, err := strconv.Atoi(aRequest.URL.Query().Get(`start`)); (nil == err) && (0 < start) {
+		qo.LimitStart = uint(start)
+	}
+
+	switch parts[0] {
+	case ``:
+		ph.handleOPDSroot(aWriter, aRequest)
+
+	case `authors`, `languages`, `publisher`, `series`, `tags`:
+		if 1 == len(parts) {
+			ph.handleOPDSentities(aWriter, aRequest, parts[0], qo, aDB)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if (nil != err) || (0 >= id) {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		qo.Entity, qo.ID = parts[0], id
+		if `series` == parts[0] {
+			qo.SetSortBy(`series`).Descending = false
+		} else {
+			qo.SetSortBy(`title`).Descending = false
+		}
+		title := opdsEntityTitles[parts[0]]
+		if 2 < len(parts) {
+			title += `: ` + parts[2]
+		}
+		ph.handleOPDSdocs(aWriter, aRequest, parts[0]+`:`+parts[1], title, qo, aDB)
+
+	case `new`:
+		ph.handleOPDSdocs(aWriter, aRequest, `new`, `Recently added`, qo, aDB)
+
+	case `search`:
+		qo.Matching = strings.TrimSpace(aRequest.URL.Query().Get(`q`))
+		if 0 == len(qo.Matching) {
+			http.Error(aWriter, `missing search terms`, http.StatusBadRequest)
+			return
+		}
+		ph.handleOPDSdocs(aWriter, aRequest, `search`, `Search: `+qo.Matching, qo, aDB)
+
+	case `titles`:
+		qo.SetSortBy(`title`).Descending = false
+		ph.handleOPDSdocs(aWriter, aRequest, `titles`, `Titles`, qo, aDB)
+
+	default:
+		http.NotFound(aWriter, aRequest)
+	}
+} // handleOPDS()
+
+// `handleOPDSdocs()` sends an acquisition feed of documents.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aID` The unique (relative) ID of the feed.
+//	`aTitle` The feed's title.
+//	`aOptions` The current query options to use.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleOPDSdocs(aWriter http.ResponseWriter, aRequest *http.Request, aID, aTitle string, aOptions *db.TQueryOptions, aDB *db.TDataBase) {
+	var (
+		count   int
+		doclist *db.TDocList
+		err     error
+	)
+	if 0 < len(aOptions.Matching) {
+		count, doclist, err = aDB.QuerySearch(aRequest.Context(), aOptions)
+	} else {
+		count, doclist, err = aDB.QueryBy(aRequest.Context(), aOptions)
+	}
+	if nil != err {
+		msg := fmt.Sprintf("QueryBy/QuerySearch: %v", err)
+		logRequest(aRequest, "TPageHandler.handleOPDSdocs()", msg)
+	}
+	if 0 > count {
+		count = 0
+	}
+
+	feed := newOPDSFeed(aID, aTitle)
+	feed.TotalResults = uint(count)
+	feed.ItemsPerPage = aOptions.LimitLength
+	feed.StartIndex = aOptions.LimitStart + 1
+	feed.Links = append(feed.Links, tOPDSLink{Href: `/opds`, Rel: `up`, Type: opdsNavigationType})
+	feed.Links = append(feed.Links, opdsPageLinks(aRequest.URL, opdsAcquisitionType,
+		aOptions.LimitStart, aOptions.LimitLength, uint(count))...)
+	if nil != doclist {
+		feed.Entries = make([]tOPDSEntry, 0, len(*doclist))
+		for idx := range *doclist {
+			feed.Entries = append(feed.Entries, opdsDocEntry(&(*doclist)[idx]))
+		}
+	}
+
+	opdsSendFeed(aWriter, aRequest, feed, opdsAcquisitionType)
+} // handleOPDSdocs()
+
+// `handleOPDSentities()` sends a navigation feed listing all
+// `aEntity` rows.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aEntity` The entity to list (e.g. `authors`).
+//	`aOptions` The current query options to use.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleOPDSentities(aWriter http.ResponseWriter, aRequest *http.Request, aEntity string, aOptions *db.TQueryOptions, aDB *db.TDataBase) {
+	count, list, err := aDB.QueryEntities(aRequest.Context(), aEntity, ``, false,
+		aOptions.LimitStart, aOptions.LimitLength)
+	if nil != err {
+		msg := fmt.Sprintf("QueryEntities(%s): %v", aEntity, err)
+		logRequest(aRequest, "TPageHandler.handleOPDSentities()", msg)
+	}
+	if 0 > count {
+		count = 0
+	}
+
+	feed := newOPDSFeed(aEntity, opdsEntityTitles[aEntity])
+	feed.TotalResults = uint(count)
+	feed.ItemsPerPage = aOptions.LimitLength
+	feed.StartIndex = aOptions.LimitStart + 1
+	feed.Links = append(feed.Links, tOPDSLink{Href: `/opds`, Rel: `up`, Type: opdsNavigationType})
+	feed.Links = append(feed.Links, opdsPageLinks(aRequest.URL, opdsNavigationType,
+		aOptions.LimitStart, aOptions.LimitLength, uint(count))...)
+	if nil != list {
+		feed.Entries = make([]tOPDSEntry, 0, len(*list))
+		for _, ent := range *list {
+			feed.Entries = append(feed.Entries, opdsNavEntry(
+				fmt.Sprintf("%s:%d", aEntity, ent.ID),
+				ent.Name,
+				fmt.Sprintf("%d document(s)", ent.Count),
+				`/opds`+ent.URL,
+				opdsAcquisitionType,
+				`subsection`))
+		}
+	}
+
+	opdsSendFeed(aWriter, aRequest, feed, opdsNavigationType)
+} // handleOPDSentities()
+
+// `handleOPDSroot()` sends the catalog's root navigation feed.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleOPDSroot(aWriter http.ResponseWriter, aRequest *http.Request) {
+	feed := newOPDSFeed(`root`, `Catalog`)
+	feed.Links = append(feed.Links,
+		tOPDSLink{Href: `/opds`, Rel: `self`, Type: opdsNavigationType})
+	feed.Entries = []tOPDSEntry{
+		opdsNavEntry(`new`, `Recently added`, `The most recently added documents`,
+			`/opds/new`, opdsAcquisitionType, opdsRelSortNew),
+		opdsNavEntry(`titles`, `Titles`, `All documents sorted by title`,
+			`/opds/titles`, opdsAcquisitionType, `subsection`),
+	}
+	for _, entity := range []string{`authors`, `series`, `tags`, `publisher`, `languages`} {
+		title := opdsEntityTitles[entity]
+		feed.Entries = append(feed.Entries, opdsNavEntry(entity, title,
+			`Browse the documents by `+strings.ToLower(title),
+			`/opds/`+entity, opdsNavigationType, `subsection`))
+	}
+
+	opdsSendFeed(aWriter, aRequest, feed, opdsNavigationType)
+} // handleOPDSroot()
+
+/* _EoF_ */
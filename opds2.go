@@ -0,0 +1,480 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides an OPDS 2.0 catalog (JSON feeds) to be used
+ * by e-reader applications.
+ */
+
+const (
+	// MIME type of OPDS 2.0 feeds.
+	opds2FeedType = `application/opds+json`
+
+	// MIME type of OPDS 2.0 publication manifests.
+	opds2PublicationType = `application/opds-publication+json`
+)
+
+type (
+	// `tOPDS2Contributor` is a named object (author, publisher,
+	// series, subject) of a publication.
+	tOPDS2Contributor struct {
+		Name     string      `json:"name"`
+		Position float64     `json:"position,omitempty"`
+		Links    []tOPDSLink `json:"links,omitempty"`
+	}
+
+	// `tOPDS2BelongsTo` lists the collections a publication belongs to.
+	tOPDS2BelongsTo struct {
+		Series []tOPDS2Contributor `json:"series,omitempty"`
+	}
+
+	// `tOPDS2PubMetadata` holds the metadata of a publication.
+	tOPDS2PubMetadata struct {
+		Type          string              `json:"@type"`
+		Identifier    string              `json:"identifier"`
+		AltIdentifier []string            `json:"altIdentifier,omitempty"`
+		Title         string              `json:"title"`
+		Author        []tOPDS2Contributor `json:"author,omitempty"`
+		Publisher     []tOPDS2Contributor `json:"publisher,omitempty"`
+		Language      []string            `json:"language,omitempty"`
+		Modified      string              `json:"modified,omitempty"`
+		Published     string              `json:"published,omitempty"`
+		Description   string              `json:"description,omitempty"`
+		Subject       []tOPDS2Contributor `json:"subject,omitempty"`
+		BelongsTo     *tOPDS2BelongsTo    `json:"belongsTo,omitempty"`
+		NumberOfPages int                 `json:"numberOfPages,omitempty"`
+	}
+
+	// `tOPDS2Publication` is a single publication (i.e. document).
+	tOPDS2Publication struct {
+		Metadata tOPDS2PubMetadata `json:"metadata"`
+		Links    []tOPDSLink       `json:"links"`
+		Images   []tOPDSLink       `json:"images,omitempty"`
+	}
+
+	// `tOPDS2FeedMetadata` holds the metadata of a feed.
+	tOPDS2FeedMetadata struct {
+		Title         string `json:"title"`
+		NumberOfItems uint   `json:"numberOfItems,omitempty"`
+		ItemsPerPage  uint   `json:"itemsPerPage,omitempty"`
+		CurrentPage   uint   `json:"currentPage,omitempty"`
+		Modified      string `json:"modified,omitempty"`
+	}
+
+	// `tOPDS2Facet` is a group of links to alternative views of a feed.
+	tOPDS2Facet struct {
+		Metadata tOPDS2FeedMetadata `json:"metadata"`
+		Links    []tOPDSLink        `json:"links"`
+	}
+
+	// `tOPDS2Feed` is an OPDS 2.0 catalog feed.
+	tOPDS2Feed struct {
+		Metadata     tOPDS2FeedMetadata  `json:"metadata"`
+		Links        []tOPDSLink         `json:"links"`
+		Facets       []tOPDS2Facet       `json:"facets,omitempty"`
+		Navigation   []tOPDSLink         `json:"navigation,omitempty"`
+		Publications []tOPDS2Publication `json:"publications,omitempty"`
+	}
+)
+
+var (
+	// `opds2SortFacets` lists the sort orders offered as facets.
+	opds2SortFacets = []struct{ name, title string }{
+		{`acquisition`, `Acquisition`},
+		{`title`, `Title`},
+		{`authors`, `Author`},
+		{`time`, `Published`},
+		{`rating`, `Rating`},
+	}
+)
+
+// `newOPDS2Feed()` returns a new feed with the given `aTitle`.
+//
+//	`aTitle` The feed's title.
+func newOPDS2Feed(aTitle string) *tOPDS2Feed {
+	return &tOPDS2Feed{
+		Metadata: tOPDS2FeedMetadata{
+			Title:    AppArgs.Realm + `: ` + aTitle,
+			Modified: time.Now().UTC().Format(time.RFC3339),
+		},
+		Links: []tOPDSLink{
+			{Href: `/opds2`, Rel: `start`, Type: opds2FeedType},
+			{Href: `/opds2/search{?query}`, Rel: `search`, Type: opds2FeedType, Templated: true},
+		},
+	}
+} // newOPDS2Feed()
+
+// `opds2Facets()` returns the sort and order facets of a feed.
+//
+//	`aURL` The requested URL of the feed.
+//	`aOptions` The current query options used.
+func opds2Facets(aURL *url.URL, aOptions *db.TQueryOptions) []tOPDS2Facet {
+	href := func(aKey, aValue string) string {
+		query := aURL.Query()
+		query.Del(`start`)
+		query.Set(aKey, aValue)
+		u := url.URL{Path: aURL.Path, RawQuery: query.Encode()}
+
+		return u.String()
+	} // href()
+
+	current := db.NewQueryOptions(0)
+	sortBy := tOPDS2Facet{Metadata: tOPDS2FeedMetadata{Title: `Sort by`}}
+	for _, facet := range opds2SortFacets {
+		link := tOPDSLink{
+			Href:  href(`sortby`, facet.name),
+			Type:  opds2FeedType,
+			Title: facet.title,
+		}
+		if current.SetSortBy(facet.name).SortBy == aOptions.SortBy {
+			link.Rel = `self`
+		}
+		sortBy.Links = append(sortBy.Links, link)
+	}
+
+	order := tOPDS2Facet{
+		Metadata: tOPDS2FeedMetadata{Title: `Order`},
+		Links: []tOPDSLink{
+			{Href: href(`order`, `ascending`), Type: opds2FeedType, Title: `Ascending`},
+			{Href: href(`order`, `descending`), Type: opds2FeedType, Title: `Descending`},
+		},
+	}
+	if aOptions.Descending {
+		order.Links[1].Rel = `self`
+	} else {
+		order.Links[0].Rel = `self`
+	}
+
+	return []tOPDS2Facet{sortBy, order}
+} // opds2Facets()
+
+// `opds2Publication()` returns the publication object of `aDoc`.
+//
+//	`aDoc` The document to describe.
+func opds2Publication(aDoc *db.TDocument) tOPDS2Publication {
+	result := tOPDS2Publication{
+		Metadata: tOPDS2PubMetadata{
+			Type:          `http://schema.org/Book`,
+			Identifier:    `urn:uuid:` + aDoc.UUID(),
+			Title:         aDoc.Title,
+			Modified:      aDoc.ModTime().UTC().Format(time.RFC3339),
+			Published:     aDoc.PubDate(),
+			Description:   string(aDoc.Comment()),
+			NumberOfPages: aDoc.Pages,
+		},
+	}
+	if 0 < len(aDoc.ISBN) {
+		result.Metadata.AltIdentifier = []string{`urn:isbn:` + aDoc.ISBN}
+	}
+	if list := aDoc.Authors(); nil != list {
+		for _, author := range *list {
+			result.Metadata.Author = append(result.Metadata.Author,
+				opds2Contributor(author))
+		}
+	}
+	if pub := aDoc.Publisher(); nil != pub {
+		result.Metadata.Publisher = []tOPDS2Contributor{opds2Contributor(*pub)}
+	}
+	if list := aDoc.Languages(); nil != list {
+		for _, lang := range *list {
+			result.Metadata.Language = append(result.Metadata.Language, lang.Name)
+		}
+	}
+	if list := aDoc.Tags(); nil != list {
+		for _, tag := range *list {
+			result.Metadata.Subject = append(result.Metadata.Subject,
+				opds2Contributor(tag))
+		}
+	}
+	if series := aDoc.Series(); nil != series {
+		ser := opds2Contributor(*series)
+		ser.Position, _ = strconv.ParseFloat(aDoc.SeriesIndex(), 64)
+		result.Metadata.BelongsTo = &tOPDS2BelongsTo{
+			Series: []tOPDS2Contributor{ser},
+		}
+	}
+
+	result.Links = []tOPDSLink{
+		{Href: fmt.Sprintf("/opds2/publications/%d", aDoc.ID), Rel: `self`, Type: opds2PublicationType},
+		{Href: aDoc.DocLink(), Rel: `alternate`, Type: `text/html`},
+	}
+	if list := aDoc.Files(); nil != list {
+		for _, file := range *list {
+			result.Links = append(result.Links, tOPDSLink{
+				Href:  file.URL,
+				Rel:   opdsRelAcquisition,
+				Type:  opdsMimeType(file.Name),
+				Title: file.Name,
+			})
+		}
+	}
+	if list := aDoc.Identifiers(); nil != list {
+		for _, ident := range *list {
+			result.Links = append(result.Links, tOPDSLink{
+				Href:  ident.URL,
+				Rel:   `related`,
+				Title: ident.Name,
+			})
+		}
+	}
+	result.Images = []tOPDSLink{
+		{Href: aDoc.Cover(), Type: `image/jpeg`},
+		{Href: aDoc.Thumb(), Type: `image/jpeg`},
+	}
+
+	return result
+} // opds2Publication()
+
+// `opds2Contributor()` returns a contributor object of `aEntity`
+// linking to the respective feed.
+//
+//	`aEntity` The entity (author, publisher etc.) to use.
+func opds2Contributor(aEntity db.TEntity) tOPDS2Contributor {
+	return tOPDS2Contributor{
+		Name:  aEntity.Name,
+		Links: []tOPDSLink{{Href: `/opds2` + aEntity.URL, Type: opds2FeedType}},
+	}
+} // opds2Contributor()
+
+// `opds2SendJSON()` writes the JSON of `aData` to `aWriter`.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aData` The feed or publication to send.
+//	`aType` The MIME type of `aData`.
+func opds2SendJSON(aWriter http.ResponseWriter, aRequest *http.Request, aData interface{}, aType string) {
+	page, err := json.Marshal(aData)
+	if nil != err {
+		handleInternalError(aWriter, `opds2SendJSON()`,
+			fmt.Sprintf("json.Marshal(): %v", err))
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, aType+`;charset=utf-8`)
+	aWriter.Header().Set(`Cache-Control`, `no-cache`)
+	// Keep the API token of clients using the URL path prefix:
+	_, prefix := requestToken(aRequest)
+	_, _ = aWriter.Write(prefixLinks(page, prefix))
+} // opds2SendJSON()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleOPDS2()` serves the OPDS 2.0 catalog below `/opds2`.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL path following `/opds2/`.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleOPDS2(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aDB *db.TDataBase) {
+	parts := strings.Split(strings.Trim(aTail, `/`), `/`)
+	query := aRequest.URL.Query()
+	qo := db.NewQueryOptions(AppArgs.BooksPerPage)
+	qo.Layout = db.QoLayoutList
+	if start, err := strconv.Atoi(query.Get(`start`)); (nil == err) && (0 < start) {
+		qo.LimitStart = uint(start)
+	}
+	// Apply a user selected facet (if any):
+	setFacets := func() {
+		if sb := query.Get(`sortby`); 0 < len(sb) {
+			qo.SetSortBy(sb)
+		}
+		switch query.Get(`order`) {
+		case `ascending`:
+			qo.Descending = false
+		case `descending`:
+			qo.Descending = true
+		}
+	} // setFacets()
+
+	switch parts[0] {
+	case ``:
+		ph.handleOPDS2root(aWriter, aRequest)
+
+	case `authors`, `languages`, `publisher`, `series`, `tags`:
+		if 1 == len(parts) {
+			ph.handleOPDS2entities(aWriter, aRequest, parts[0], qo, aDB)
+			return
+		}
+		id, err := strconv.Atoi(parts[1])
+		if (nil != err) || (0 >= id) {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		qo.Entity, qo.ID = parts[0], id
+		if `series` == parts[0] {
+			qo.SetSortBy(`series`).Descending = false
+		} else {
+			qo.SetSortBy(`title`).Descending = false
+		}
+		setFacets()
+		title := opdsEntityTitles[parts[0]]
+		if 2 < len(parts) {
+			title += `: ` + parts[2]
+		}
+		ph.handleOPDS2docs(aWriter, aRequest, title, qo, aDB)
+
+	case `new`:
+		setFacets()
+		ph.handleOPDS2docs(aWriter, aRequest, `Recently added`, qo, aDB)
+
+	case `publications`:
+		var id db.TID
+		if 1 < len(parts) {
+			id, _ = strconv.Atoi(parts[1])
+		}
+		doc := aDB.QueryDocument(aRequest.Context(), id)
+		if nil == doc {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		opds2SendJSON(aWriter, aRequest, opds2Publication(doc), opds2PublicationType)
+
+	case `search`:
+		qo.Matching = strings.TrimSpace(query.Get(`query`))
+		if 0 == len(qo.Matching) {
+			http.Error(aWriter, `missing search terms`, http.StatusBadRequest)
+			return
+		}
+		setFacets()
+		ph.handleOPDS2docs(aWriter, aRequest, `Search: `+qo.Matching, qo, aDB)
+
+	case `titles`:
+		qo.SetSortBy(`title`).Descending = false
+		setFacets()
+		ph.handleOPDS2docs(aWriter, aRequest, `Titles`, qo, aDB)
+
+	default:
+		http.NotFound(aWriter, aRequest)
+	}
+} // handleOPDS2()
+
+// `handleOPDS2docs()` sends a feed of publications.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTitle` The feed's title.
+//	`aOptions` The current query options to use.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleOPDS2docs(aWriter http.ResponseWriter, aRequest *http.Request, aTitle string, aOptions *db.TQueryOptions, aDB *db.TDataBase) {
+	var (
+		count   int
+		doclist *db.TDocList
+		err     error
+	)
+	if 0 < len(aOptions.Matching) {
+		count, doclist, err = aDB.QuerySearch(aRequest.Context(), aOptions)
+	} else {
+		count, doclist, err = aDB.QueryBy(aRequest.Context(), aOptions)
+	}
+	if nil != err {
+		msg := fmt.Sprintf("QueryBy/QuerySearch: %v", err)
+		logRequest(aRequest, "TPageHandler.handleOPDS2docs()", msg)
+	}
+	if 0 > count {
+		count = 0
+	}
+
+	feed := newOPDS2Feed(aTitle)
+	feed.Metadata.NumberOfItems = uint(count)
+	feed.Metadata.ItemsPerPage = aOptions.LimitLength
+	feed.Metadata.CurrentPage = aOptions.LimitStart/aOptions.LimitLength + 1
+	feed.Links = append(feed.Links, tOPDSLink{Href: `/opds2`, Rel: `up`, Type: opds2FeedType})
+	feed.Links = append(feed.Links, opdsPageLinks(aRequest.URL, opds2FeedType,
+		aOptions.LimitStart, aOptions.LimitLength, uint(count))...)
+	feed.Facets = opds2Facets(aRequest.URL, aOptions)
+	if nil != doclist {
+		feed.Publications = make([]tOPDS2Publication, 0, len(*doclist))
+		for idx := range *doclist {
+			feed.Publications = append(feed.Publications, opds2Publication(&(*doclist)[idx]))
+		}
+	}
+
+	opds2SendJSON(aWriter, aRequest, feed, opds2FeedType)
+} // handleOPDS2docs()
+
+// `handleOPDS2entities()` sends a navigation feed listing all
+// `aEntity` rows.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aEntity` The entity to list (e.g. `authors`).
+//	`aOptions` The current query options to use.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleOPDS2entities(aWriter http.ResponseWriter, aRequest *http.Request, aEntity string, aOptions *db.TQueryOptions, aDB *db.TDataBase) {
+	count, list, err := aDB.QueryEntities(aRequest.Context(), aEntity, ``, false,
+		aOptions.LimitStart, aOptions.LimitLength)
+	if nil != err {
+		msg := fmt.Sprintf("QueryEntities(%s): %v", aEntity, err)
+		logRequest(aRequest, "TPageHandler.handleOPDS2entities()", msg)
+	}
+	if 0 > count {
+		count = 0
+	}
+
+	feed := newOPDS2Feed(opdsEntityTitles[aEntity])
+	feed.Metadata.NumberOfItems = uint(count)
+	feed.Metadata.ItemsPerPage = aOptions.LimitLength
+	feed.Metadata.CurrentPage = aOptions.LimitStart/aOptions.LimitLength + 1
+	feed.Links = append(feed.Links, tOPDSLink{Href: `/opds2`, Rel: `up`, Type: opds2FeedType})
+	feed.Links = append(feed.Links, opdsPageLinks(aRequest.URL, opds2FeedType,
+		aOptions.LimitStart, aOptions.LimitLength, uint(count))...)
+	if nil != list {
+		feed.Navigation = make([]tOPDSLink, 0, len(*list))
+		for _, ent := range *list {
+			feed.Navigation = append(feed.Navigation, tOPDSLink{
+				Href:       `/opds2` + ent.URL,
+				Rel:        `subsection`,
+				Type:       opds2FeedType,
+				Title:      ent.Name,
+				Properties: &tOPDSLinkProps{NumberOfItems: ent.Count},
+			})
+		}
+	}
+
+	opds2SendJSON(aWriter, aRequest, feed, opds2FeedType)
+} // handleOPDS2entities()
+
+// `handleOPDS2root()` sends the catalog's root navigation feed.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleOPDS2root(aWriter http.ResponseWriter, aRequest *http.Request) {
+	feed := newOPDS2Feed(`Catalog`)
+	feed.Links = append(feed.Links,
+		tOPDSLink{Href: `/opds2`, Rel: `self`, Type: opds2FeedType})
+	feed.Navigation = []tOPDSLink{
+		{Href: `/opds2/new`, Rel: opdsRelSortNew, Type: opds2FeedType, Title: `Recently added`},
+		{Href: `/opds2/titles`, Rel: `subsection`, Type: opds2FeedType, Title: `Titles`},
+	}
+	for _, entity := range []string{`authors`, `series`, `tags`, `publisher`, `languages`} {
+		feed.Navigation = append(feed.Navigation, tOPDSLink{
+			Href:  `/opds2/` + entity,
+			Rel:   `subsection`,
+			Type:  opds2FeedType,
+			Title: opdsEntityTitles[entity],
+		})
+	}
+
+	opds2SendJSON(aWriter, aRequest, feed, opds2FeedType)
+} // handleOPDS2root()
+
+/* _EoF_ */
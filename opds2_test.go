@@ -0,0 +1,66 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func Test_opds2Facets(t *testing.T) {
+	u1, _ := url.Parse(`/opds2/new?start=24`)
+	u2, _ := url.Parse(`/opds2/search?query=pratchett&sortby=title`)
+	o1 := db.NewQueryOptions(24)
+	o2 := db.NewQueryOptions(24).SetSortBy(`title`)
+	o2.Descending = false
+	type args struct {
+		aURL     *url.URL
+		aOptions *db.TQueryOptions
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantSort  string // href of the selected sort facet
+		wantOrder string // href of the selected order facet
+	}{
+		// TODO: Add test cases.
+		{" 1", args{u1, o1}, `/opds2/new?sortby=acquisition`, `/opds2/new?order=descending`},
+		{" 2", args{u2, o2}, `/opds2/search?query=pratchett&sortby=title`, `/opds2/search?order=ascending&query=pratchett&sortby=title`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := opds2Facets(tt.args.aURL, tt.args.aOptions)
+			if 2 != len(got) {
+				t.Errorf("opds2Facets() = %v, want 2 facets", got)
+				return
+			}
+			var gotSort, gotOrder string
+			for _, link := range got[0].Links {
+				if `self` == link.Rel {
+					gotSort = link.Href
+				}
+			}
+			for _, link := range got[1].Links {
+				if `self` == link.Rel {
+					gotOrder = link.Href
+				}
+			}
+			if gotSort != tt.wantSort {
+				t.Errorf("opds2Facets() sort = %v, want %v", gotSort, tt.wantSort)
+			}
+			if gotOrder != tt.wantOrder {
+				t.Errorf("opds2Facets() order = %v, want %v", gotOrder, tt.wantOrder)
+			}
+		})
+	}
+} // Test_opds2Facets()
+
+/* _EoF_ */
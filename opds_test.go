@@ -0,0 +1,92 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func Test_opdsMimeType(t *testing.T) {
+	tests := []struct {
+		name    string
+		aFormat string
+		want    string
+	}{
+		// TODO: Add test cases.
+		{" 1", `EPUB`, `application/epub+zip`},
+		{" 2", `epub`, `application/epub+zip`},
+		{" 3", `PDF`, `application/pdf`},
+		{" 4", `CBZ`, `application/vnd.comicbook+zip`},
+		{" 5", `XYZ`, `application/octet-stream`},
+		{" 6", ``, `application/octet-stream`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opdsMimeType(tt.aFormat); got != tt.want {
+				t.Errorf("opdsMimeType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_opdsMimeType()
+
+func Test_opdsPageLinks(t *testing.T) {
+	u1, _ := url.Parse(`/opds/new`)
+	u2, _ := url.Parse(`/opds/search?q=pratchett&start=10`)
+	t1 := `acq`
+	w1 := []tOPDSLink{
+		{Href: `/opds/new`, Rel: `self`, Type: t1},
+	}
+	w2 := []tOPDSLink{
+		{Href: `/opds/new`, Rel: `self`, Type: t1},
+		{Href: `/opds/new?start=10`, Rel: `next`, Type: t1},
+		{Href: `/opds/new?start=20`, Rel: `last`, Type: t1},
+	}
+	w3 := []tOPDSLink{
+		{Href: `/opds/search?q=pratchett&start=10`, Rel: `self`, Type: t1},
+		{Href: `/opds/search?q=pratchett`, Rel: `first`, Type: t1},
+		{Href: `/opds/search?q=pratchett`, Rel: `previous`, Type: t1},
+		{Href: `/opds/search?q=pratchett&start=20`, Rel: `next`, Type: t1},
+		{Href: `/opds/search?q=pratchett&start=20`, Rel: `last`, Type: t1},
+	}
+	w4 := []tOPDSLink{
+		{Href: `/opds/search?q=pratchett&start=20`, Rel: `self`, Type: t1},
+		{Href: `/opds/search?q=pratchett`, Rel: `first`, Type: t1},
+		{Href: `/opds/search?q=pratchett&start=10`, Rel: `previous`, Type: t1},
+	}
+	type args struct {
+		aURL    *url.URL
+		aType   string
+		aStart  uint
+		aLength uint
+		aCount  uint
+	}
+	tests := []struct {
+		name string
+		args args
+		want []tOPDSLink
+	}{
+		// TODO: Add test cases.
+		{" 1", args{u1, t1, 0, 10, 5}, w1},
+		{" 2", args{u1, t1, 0, 10, 25}, w2},
+		{" 3", args{u2, t1, 10, 10, 25}, w3},
+		{" 4", args{u2, t1, 20, 10, 25}, w4},
+		{" 5", args{u1, t1, 0, 0, 25}, w1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opdsPageLinks(tt.args.aURL, tt.args.aType, tt.args.aStart, tt.args.aLength, tt.args.aCount); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("opdsPageLinks() = %v,\nwant %v", got, tt.want)
+			}
+		})
+	}
+} // Test_opdsPageLinks()
+
+/* _EoF_ */
@@ -0,0 +1,182 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides an OpenSearch description document and the
+ * respective suggestions for browser based searches.
+ */
+
+const (
+	// Max. number of suggestions to return.
+	osMaxSuggestions = 12
+)
+
+type (
+	// `tOSImage` is the icon of an OpenSearch description.
+	tOSImage struct {
+		Height int    `xml:"height,attr"`
+		Width  int    `xml:"width,attr"`
+		Type   string `xml:"type,attr"`
+		URL    string `xml:",chardata"`
+	}
+
+	// `tOSURL` is a search template of an OpenSearch description.
+	tOSURL struct {
+		Type     string `xml:"type,attr"`
+		Rel      string `xml:"rel,attr,omitempty"`
+		Template string `xml:"template,attr"`
+	}
+
+	// `tOSDescription` is an OpenSearch description document.
+	tOSDescription struct {
+		XMLName        xml.Name `xml:"OpenSearchDescription"`
+		Xmlns          string   `xml:"xmlns,attr"`
+		ShortName      string   `xml:"ShortName"`
+		Description    string   `xml:"Description"`
+		InputEncoding  string   `xml:"InputEncoding"`
+		OutputEncoding string   `xml:"OutputEncoding"`
+		Image          tOSImage `xml:"Image"`
+		URLs           []tOSURL `xml:"Url"`
+	}
+)
+
+var (
+	// `osKindTitles` maps the first URL part of a suggestion
+	// to its description.
+	osKindTitles = map[string]string{
+		`authors`:   `Author`,
+		`doc`:       `Title`,
+		`publisher`: `Publisher`,
+		`series`:    `Series`,
+		`tags`:      `Tag`,
+	}
+)
+
+// `requestBaseURL()` returns the scheme and host part of the URL
+// used by `aRequest` (e.g. `https://example.com`).
+//
+//	`aRequest` The HTTP request received by the server.
+func requestBaseURL(aRequest *http.Request) string {
+	scheme := `http`
+	if nil != aRequest.TLS {
+		scheme = `https`
+	} else if fp := aRequest.Header.Get(`X-Forwarded-Proto`); 0 < len(fp) {
+		scheme = strings.ToLower(strings.TrimSpace(strings.Split(fp, `,`)[0]))
+	}
+
+	return scheme + `://` + aRequest.Host
+} // requestBaseURL()
+
+// `osSuggestions()` returns the OpenSearch suggestions for `aQuery`.
+//
+// The result is a list of four elements: the query, the suggested
+// completions, their descriptions and their respective URLs.
+//
+//	`aBaseURL` The scheme and host to prepend to the URLs.
+//	`aQuery` The search term the suggestions belong to.
+//	`aList` The entities matching `aQuery`.
+func osSuggestions(aBaseURL, aQuery string, aList *db.TEntityList) []interface{} {
+	var (
+		completions  = []string{}
+		descriptions = []string{}
+		urls         = []string{}
+	)
+	if nil != aList {
+		for _, ent := range *aList {
+			kind := strings.SplitN(strings.TrimPrefix(ent.URL, `/`), `/`, 2)[0]
+			desc := osKindTitles[kind]
+			if 0 < ent.Count {
+				desc += fmt.Sprintf(" (%d)", ent.Count)
+			}
+			completions = append(completions, ent.Name)
+			descriptions = append(descriptions, desc)
+			urls = append(urls, aBaseURL+ent.URL)
+		}
+	}
+
+	return []interface{}{aQuery, completions, descriptions, urls}
+} // osSuggestions()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleOpenSearch()` sends the OpenSearch description document.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleOpenSearch(aWriter http.ResponseWriter, aRequest *http.Request) {
+	base := requestBaseURL(aRequest)
+	desc := tOSDescription{
+		Xmlns:          `http://a9.com/-/spec/opensearch/1.1/`,
+		ShortName:      AppArgs.LibName,
+		Description:    AppArgs.Realm + `: ` + AppArgs.LibName,
+		InputEncoding:  `UTF-8`,
+		OutputEncoding: `UTF-8`,
+		Image: tOSImage{
+			Height: 16,
+			Width:  16,
+			Type:   `image/x-icon`,
+			URL:    base + `/img/favicon.ico`,
+		},
+		URLs: []tOSURL{
+			{Type: `text/html`, Rel: `results`, Template: base + `/search?q={searchTerms}`},
+			{Type: `application/x-suggestions+json`, Rel: `suggestions`, Template: base + `/suggest?q={searchTerms}`},
+			{Type: opdsAcquisitionType, Rel: `results`, Template: base + `/opds/search?q={searchTerms}`},
+			{Type: `application/opensearchdescription+xml`, Rel: `self`, Template: base + `/opensearch.xml`},
+		},
+	}
+	page, err := xml.MarshalIndent(desc, ``, ` `)
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleOpenSearch()`,
+			fmt.Sprintf("xml.MarshalIndent(): %v", err))
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, `application/opensearchdescription+xml; charset=utf-8`)
+	aWriter.Header().Set(`Cache-Control`, `public, max-age=86400`) // 1 day
+	_, _ = aWriter.Write([]byte(xml.Header))
+	_, _ = aWriter.Write(page)
+} // handleOpenSearch()
+
+// `handleSuggest()` sends the OpenSearch suggestions for the
+// `q` query parameter.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleSuggest(aWriter http.ResponseWriter, aRequest *http.Request, aDB *db.TDataBase) {
+	query := strings.TrimSpace(aRequest.FormValue(`q`))
+	list, err := aDB.QuerySuggestions(aRequest.Context(), query, osMaxSuggestions)
+	if nil != err {
+		msg := fmt.Sprintf("QuerySuggestions(%q): %v", query, err)
+		logRequest(aRequest, "TPageHandler.handleSuggest()", msg)
+	}
+	page, err := json.Marshal(osSuggestions(requestBaseURL(aRequest), query, list))
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleSuggest()`,
+			fmt.Sprintf("json.Marshal(): %v", err))
+		return
+	}
+
+	aWriter.Header().Set(`Content-Type`, `application/x-suggestions+json; charset=utf-8`)
+	aWriter.Header().Set(`Cache-Control`, `no-cache`)
+	_, _ = aWriter.Write(page)
+} // handleSuggest()
+
+/* _EoF_ */
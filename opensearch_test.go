@@ -0,0 +1,80 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func Test_osSuggestions(t *testing.T) {
+	l1 := &db.TEntityList{
+		{ID: 1, Name: `Terry Pratchett`, URL: `/authors/1/Terry%20Pratchett`, Count: 3},
+		{ID: 2, Name: `The Light Fantastic`, URL: `/doc/2/doc.html`},
+	}
+	w1 := []interface{}{`t`,
+		[]string{`Terry Pratchett`, `The Light Fantastic`},
+		[]string{`Author (3)`, `Title`},
+		[]string{`http://host/authors/1/Terry%20Pratchett`, `http://host/doc/2/doc.html`},
+	}
+	w2 := []interface{}{`x`, []string{}, []string{}, []string{}}
+	type args struct {
+		aBaseURL string
+		aQuery   string
+		aList    *db.TEntityList
+	}
+	tests := []struct {
+		name string
+		args args
+		want []interface{}
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`http://host`, `t`, l1}, w1},
+		{" 2", args{`http://host`, `x`, nil}, w2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := osSuggestions(tt.args.aBaseURL, tt.args.aQuery, tt.args.aList); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("osSuggestions() = %v,\nwant %v", got, tt.want)
+			}
+		})
+	}
+} // Test_osSuggestions()
+
+func Test_requestBaseURL(t *testing.T) {
+	r1 := httptest.NewRequest(`GET`, `http://example.com/opensearch.xml`, nil)
+	r2 := httptest.NewRequest(`GET`, `http://example.com:8383/opensearch.xml`, nil)
+	r2.TLS = &tls.ConnectionState{}
+	r3 := httptest.NewRequest(`GET`, `http://example.com/opensearch.xml`, nil)
+	r3.Header.Set(`X-Forwarded-Proto`, `HTTPS, http`)
+	tests := []struct {
+		name     string
+		aRequest *http.Request
+		want     string
+	}{
+		// TODO: Add test cases.
+		{" 1", r1, `http://example.com`},
+		{" 2", r2, `https://example.com:8383`},
+		{" 3", r3, `https://example.com`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestBaseURL(tt.aRequest); got != tt.want {
+				t.Errorf("requestBaseURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_requestBaseURL()
+
+/* _EoF_ */
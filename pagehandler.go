@@ -11,6 +11,7 @@ package kaliber
 import (
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -20,8 +21,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/mwat56/apachelogger"
 	"github.com/mwat56/cssfs"
+	"github.com/mwat56/errorhandler"
 	"github.com/mwat56/jffs"
 	"github.com/mwat56/kaliber/db"
 	"github.com/mwat56/passlist"
@@ -31,12 +32,15 @@ import (
 type (
 	// TPageHandler provides the handling of HTTP request/response.
 	TPageHandler struct {
-		cacheFS  http.Handler        // cache file server (i.e. thumbnails)
-		cssFS    http.Handler        // CSS file server
-		docFS    http.Handler        // document file server
-		staticFS http.Handler        // static file server
-		usrList  *passlist.TPassList // user/password list
-		viewList *TViewList          // list of template/views
+		cacheFS     http.Handler        // cache file server (i.e. thumbnails)
+		cssFS       http.Handler        // CSS file server
+		docFS       http.Handler        // document file server
+		guard       *tLoginGuard        // failed logins tracker
+		metricsNets []*net.IPNet        // networks allowed to see the metrics
+		roles       tRoleList           // the users' roles
+		staticFS    http.Handler        // static file server
+		usrList     *passlist.TPassList // user/password list
+		viewList    *TViewList          // list of template/views
 	}
 )
 
@@ -47,7 +51,7 @@ type (
 //	`aMessage`
 func handleInternalError(aWriter http.ResponseWriter,
 	aSender, aMessage string) {
-	apachelogger.Err(aSender, aMessage)
+	logEntry(levelError, aWriter.Header().Get(requestIDHeader), aSender, aMessage)
 	http.Error(aWriter, `unknown page arguments`,
 		http.StatusInternalServerError)
 } // handleInternalError()
@@ -66,12 +70,25 @@ func NewPageHandler() (*TPageHandler, error) {
 
 	if s := AppArgs.PassFile; 0 == len(s) {
 		s = "missing user/password file\nAUTHENTICATION DISABLED!`"
-		apachelogger.Err("NewPageHandler()", s)
+		logError("NewPageHandler()", s)
 	} else if result.usrList, err = passlist.LoadPasswords(s); nil != err {
 		s = fmt.Sprintf("%v\nAUTHENTICATION DISABLED!", err)
-		apachelogger.Err("NewPageHandler()", s)
+		logError("NewPageHandler()", s)
 		result.usrList = nil
 	}
+	if result.roles, err = loadRoles(AppArgs.RoleFile); nil != err {
+		return nil, err
+	}
+	if result.guard, err = newLoginGuard(AppArgs.AuthMaxFails,
+		AppArgs.AuthLockout, AppArgs.AuthTrusted); nil != err {
+		return nil, err
+	}
+	if trustedProxies, err = parseNetworks(AppArgs.TrustProxies); nil != err {
+		return nil, fmt.Errorf("trustedProxies: %w", err)
+	}
+	if result.metricsNets, err = parseNetworks(AppArgs.MetricsAllow); nil != err {
+		return nil, fmt.Errorf("metricsAllow: %w", err)
+	}
 
 	if result.viewList, err = newViewList(filepath.Join(AppArgs.DataDir, `views`)); nil != err {
 		return nil, err
@@ -79,12 +96,14 @@ func NewPageHandler() (*TPageHandler, error) {
 
 	// Initialise the database:
 	db.Init()
+	db.SetLogger(logDB)
+	db.SetQueryObserver(srvMetrics.observeQuery)
 
 	// Update the thumbnails cache:
 	go ThumbnailUpdate()
 
 	// Avoid sessions for certain requests:
-	sessions.ExcludePaths("/certs", "/css/", "/favicon", "/file/", "/fonts", "/img/", "/robots")
+	sessions.ExcludePaths("/api/", "/certs", "/css/", "/favicon", "/feed/", "/file/", "/fonts", "/healthz", "/img/", "/metrics", "/opds", "/opensearch", "/readyz", "/robots", "/suggest", "/t/")
 
 	return result, nil
 } // NewPageHandler()
@@ -186,7 +205,7 @@ func (ph *TPageHandler) basicTemplateData(aRequest *http.Request, aOptions *db.T
 		}
 	}
 
-	return NewTemplateData().
+	result := NewTemplateData().
 		Set("CSS", template.HTML(`<link rel="stylesheet" type="text/css" title="mwat's styles" href="/css/stylesheet.css"><link rel="stylesheet" type="text/css" href="/css/`+theme+`.css"><link rel="stylesheet" type="text/css" href="/css/fonts.css">`)).
 		Set("GUILANG", aOptions.SelectLanguageOptions()).
 		Set("HasLast", false).
@@ -203,6 +222,22 @@ func (ph *TPageHandler) basicTemplateData(aRequest *http.Request, aOptions *db.T
 		Set("THEME", aOptions.SelectThemeOptions()).
 		Set("Title", AppArgs.Realm+fmt.Sprintf(": %d-%02d-%02d", y, m, d)).
 		Set("VirtLib", aOptions.SelectVirtLibOptions()) // #nosec G203
+	if nil != aRequest {
+		result.Set("MayDownload", ph.may(aRequest, permDownload)).
+			Set("MayRead", ph.may(aRequest, permRead))
+		if (0 < len(ph.authUser(aRequest))) && (0 < len(db.UserDatabaseFile())) {
+			result.Set("HasAccount", true)
+		}
+		if 0 != ph.userPermissions(ph.authUser(aRequest))&permAdmin {
+			result.Set("HasAdmin", true)
+		}
+		if _, ok := ph.readingUser(aRequest); ok {
+			result.Set("HasShelves", true).
+				Set("SRS", aOptions.SelectReadStateOptions())
+		}
+	}
+
+	return result
 } // basicTemplateData()
 
 // GetErrorPage returns an error page for `aStatus`,
@@ -211,9 +246,26 @@ func (ph *TPageHandler) basicTemplateData(aRequest *http.Request, aOptions *db.T
 //	`aData` The original error text.
 //	`aStatus` The number of the actual HTTP error status.
 func (ph *TPageHandler) GetErrorPage(aData []byte, aStatus int) []byte {
+	return ph.errorPage(aData, aStatus, ``)
+} // GetErrorPage()
+
+// `errorPage()` returns an error page for `aStatus` showing
+// `aRequestID`.
+//
+// Replies with a status other than an error (e.g. `206 Partial
+// Content`) are not replaced.
+//
+//	`aData` The original error text.
+//	`aStatus` The number of the actual HTTP error status.
+//	`aRequestID` The ID of the current web request.
+func (ph *TPageHandler) errorPage(aData []byte, aStatus int, aRequestID string) []byte {
 	var empty []byte
+	if http.StatusBadRequest > aStatus {
+		return empty
+	}
 	qo := db.NewQueryOptions(AppArgs.BooksPerPage)
 	pageData := ph.basicTemplateData(nil, qo).
+		Set("RequestID", aRequestID).
 		Set("ShowForm", false)
 
 	switch aStatus {
@@ -230,7 +282,7 @@ func (ph *TPageHandler) GetErrorPage(aData []byte, aStatus int) []byte {
 	}
 
 	return empty
-} // GetErrorPage()
+} // errorPage()
 
 // `handleGET()` processes the HTTP GET requests.
 //
@@ -255,6 +307,7 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 	if qos, ok := so.GetString("QOS"); ok {
 		qo.Scan(qos)
 	}
+	ph.setReadingUser(aRequest, qo)
 
 	doOpenDatabase := func() *db.TDataBase {
 		if dbHandle, err = db.OpenDatabase(aRequest.Context()); nil != err {
@@ -273,12 +326,36 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 	} // doHandleQuery()
 
 	switch path {
+	case `account`:
+		ph.handleAccount(aWriter, aRequest, qo, so)
+
+	case `admin`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleAdmin(aWriter, aRequest, qo, so, dbHandle)
+
+	case `api`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleAPI(aWriter, aRequest, tail, dbHandle)
+
 	case "authors", "format", "languages", "publisher", "series", "tags":
 		parts := strings.Split(tail, `/`)
+		id, _ = strconv.Atoi(parts[0])
+		if (0 == id) && (`format` != path) {
+			// no ID given: show the index of all entities
+			if nil == doOpenDatabase() {
+				return
+			}
+			ph.handleBrowse(aWriter, aRequest, path, qo, so, dbHandle)
+			return
+		}
 		qo.Entity = path
-		qo.ID, _ = strconv.Atoi(parts[0])
+		qo.ID = id
 		qo.LimitStart = 0 // it's the first page of a new selection
-		if 0 < qo.ID {
+		if (0 < qo.ID) && (1 < len(parts)) {
 			qo.Matching = path + `:"=` + parts[1] + `"`
 		}
 		doHandleQuery()
@@ -305,9 +382,19 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 			http.NotFound(aWriter, aRequest)
 			return
 		}
+		aWriter.Header().Set(`Cache-Control`, `private, max-age=86400`) // 1 day
+		if fileNotModified(aWriter, aRequest, filepath.Join(db.CalibreLibraryPath(), file)) {
+			return
+		}
 		aRequest.URL.Path = file
 		ph.docFS.ServeHTTP(aWriter, aRequest)
 
+	case `comic`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleComic(aWriter, aRequest, tail, qo, so, dbHandle)
+
 	case "css":
 		ph.cssFS.ServeHTTP(aWriter, aRequest)
 
@@ -323,17 +410,59 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 			return
 		}
 		pageData := ph.basicTemplateData(aRequest, qo).
+			Set("CanSend", (0 < len(AppArgs.SMTPHost)) && ph.may(aRequest, permSend)).
 			Set("Document", doc)
-		aWriter.Header().Set(`Cache-Control`, `private, max-age=864000`) // 10 days
-		aWriter.Header().Set(`Last-Modified`, doc.LastModified())
+		reading := ph.setReadingData(aRequest, pageData, doc.ID)
+		shelves := ph.setDocShelfData(aRequest, pageData, doc.ID)
+		downloads := ph.setDownloadData(aRequest, pageData, doc.ID)
+		// The page shows the user's reading state and shelves which
+		// change by POST requests redirecting here, so the browser
+		// has to revalidate its copy each time:
+		aWriter.Header().Set(`Cache-Control`, `private, no-cache`)
+		// The page depends on the document, the database copy,
+		// the user's options (language, theme etc.), reading state,
+		// shelves, and number of downloads; the document's
+		// modification time alone doesn't tell, hence no
+		// `Last-Modified` header:
+		etag := newETag(doc.ID, doc.ModTime().UnixNano(), db.DatabaseGeneration(),
+			qo.String(), time.Now().Format(`2006-01-02`), reading, shelves, downloads)
+		if notModified(aWriter, aRequest, etag, time.Time{}) {
+			so.Set("QOS", qo.String())
+			return
+		}
 		ph.handleReply(`document`, aWriter, qo, so, pageData)
 
 	case `faq`:
 		ph.handleReply(`faq`, aWriter, qo, so, ph.basicTemplateData(aRequest, qo))
 
+	case `favourites`:
+		user, ok := ph.readingUser(aRequest)
+		if !ok {
+			http.NotFound(aWriter, aRequest)
+			return
+		}
+		udb, err := db.OpenUserDatabase(aRequest.Context())
+		if nil == err {
+			id, err = udb.FavouritesShelf(aRequest.Context(), user)
+		}
+		if nil != err {
+			handleInternalError(aWriter,
+				`TPageHandler.handleGET('`+path+`')`,
+				fmt.Sprintf("FavouritesShelf(): %v", err))
+			return
+		}
+		qo.Entity, qo.ID, qo.LimitStart, qo.Matching = `shelves`, id, 0, ``
+		doHandleQuery()
+
 	case "favicon.ico":
 		http.Redirect(aWriter, aRequest, "/img/"+path, http.StatusMovedPermanently)
 
+	case `feed`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleFeed(aWriter, aRequest, tail, dbHandle)
+
 	case `file`:
 		if nil == doOpenDatabase() {
 			return
@@ -352,9 +481,10 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 			return
 		}
 		aWriter.Header().Set(`Cache-Control`, `private, max-age=864000`) // 10 days
-		aWriter.Header().Set(`Last-Modified`, doc.LastModified())
-		aRequest.URL.Path = file
-		ph.docFS.ServeHTTP(aWriter, aRequest)
+		if fileNotModified(aWriter, aRequest, filepath.Join(db.CalibreLibraryPath(), file)) {
+			return
+		}
+		ph.serveDownload(aWriter, aRequest, doc.ID, parts[1], file)
 
 	case `first`, ``:
 		qo.LimitStart = 0
@@ -389,6 +519,21 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 	case `next`:
 		doHandleQuery()
 
+	case `opensearch.xml`:
+		ph.handleOpenSearch(aWriter, aRequest)
+
+	case `opds`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleOPDS(aWriter, aRequest, tail, dbHandle)
+
+	case `opds2`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleOPDS2(aWriter, aRequest, tail, dbHandle)
+
 	case `post`:
 		doHandleQuery()
 
@@ -406,12 +551,46 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 		// a POST result page; try to handle it gracefully.
 		doHandleQuery()
 
+	case `read`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleRead(aWriter, aRequest, qo, so, dbHandle)
+
 	case "robots.txt":
 		ph.staticFS.ServeHTTP(aWriter, aRequest)
 
+	case `search`:
+		qo.Entity, qo.ID, qo.LimitStart, qo.VirtLib = ``, 0, 0, ``
+		qo.Matching = strings.TrimSpace(aRequest.FormValue(`q`))
+		doHandleQuery()
+
+	case `send`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleSend(aWriter, aRequest, tail, qo, so, dbHandle)
+
 	case "sessions": // files are handled internally
 		http.Redirect(aWriter, aRequest, "/", http.StatusMovedPermanently)
 
+	case `shelves`:
+		id, _ = strconv.Atoi(strings.Split(tail, `/`)[0])
+		if 0 == id {
+			ph.handleShelves(aWriter, aRequest, qo, so)
+			return
+		}
+		// Shelves don't belong to the `Calibre` database,
+		// so there's no `Matching` as with the other entities:
+		qo.Entity, qo.ID, qo.LimitStart, qo.Matching = `shelves`, id, 0, ``
+		doHandleQuery()
+
+	case `suggest`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleSuggest(aWriter, aRequest, dbHandle)
+
 	case `thumb`:
 		if nil == doOpenDatabase() {
 			return
@@ -422,8 +601,10 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 			http.NotFound(aWriter, aRequest)
 			return
 		}
-		tName, err := Thumbnail(doc)
+		tName, err := Thumbnail(aRequest.Context(), doc)
 		if nil != err {
+			msg := fmt.Sprintf("Thumbnail(%d): %v", doc.ID, err)
+			logContext(aRequest.Context(), levelWarn, "TPageHandler.handleGET('thumb')", msg)
 			http.NotFound(aWriter, aRequest)
 			return
 		}
@@ -432,19 +613,26 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 			http.NotFound(aWriter, aRequest)
 			return
 		}
+		aWriter.Header().Set(`Cache-Control`, `private, max-age=86400`) // 1 day
+		if fileNotModified(aWriter, aRequest, tName) {
+			return
+		}
 		aRequest.URL.Path = file
 		ph.cacheFS.ServeHTTP(aWriter, aRequest)
 
 	case "views": // files are handled internally
 		http.Redirect(aWriter, aRequest, "/", http.StatusMovedPermanently)
 
-	default:
-		// // if nothing matched (above) reply to the request
-		// // with an HTTP 404 not found error.
-		//http.NotFound(aWriter, aRequest)
+	case `zip`:
+		if nil == doOpenDatabase() {
+			return
+		}
+		ph.handleZip(aWriter, aRequest, tail, qo, so, dbHandle)
 
-		// Redirect all unknown/invalid URLs to the NSA:
-		http.Redirect(aWriter, aRequest, "https://www.nsa.gov/", http.StatusMovedPermanently)
+	default:
+		// if nothing matched (above) reply according to the
+		// `unknownMode` option.
+		ph.handleUnknown(aWriter, aRequest)
 	} // switch
 } // handleGET()
 
@@ -453,15 +641,27 @@ func (ph *TPageHandler) handleGET(aWriter http.ResponseWriter, aRequest *http.Re
 //	`aWriter` Used by the HTTP handler to construct an HTTP response.
 //	`aRequest` The HTTP request received by the server.
 func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.Request) {
-	path, _ := URLparts(aRequest.URL.Path)
+	path, tail := URLparts(aRequest.URL.Path)
 	switch path {
-	case "qo": // the only valid POST destination
+	case `account`:
+		qo := db.NewQueryOptions(AppArgs.BooksPerPage)
+		so := sessions.GetSession(aRequest)
+		if qos, ok := so.GetString("QOS"); ok {
+			qo.Scan(qos)
+		}
+		ph.handleAccount(aWriter, aRequest, qo, so)
+
+	case `bookmark`, `reading`:
+		ph.handleReading(aWriter, aRequest, path, tail)
+
+	case "qo":
 		qo := db.NewQueryOptions(AppArgs.BooksPerPage)
 		so := sessions.GetSession(aRequest)
 		if qos, ok := so.GetString("QOS"); ok {
 			qo.Scan(qos)
 		}
 		qo.Update(aRequest)
+		ph.setReadingUser(aRequest, qo)
 		// Since the query options hold the LimitStart of the
 		// _next_ query we have to go back here one page:
 		qo.DecLimit()
@@ -477,13 +677,39 @@ func (ph *TPageHandler) handlePOST(aWriter http.ResponseWriter, aRequest *http.R
 
 		ph.handleQuery(aWriter, aRequest, qo, so, dbHandle)
 
-	default:
-		// // if nothing matched (above) reply to the request
-		// // with an HTTP 404 "not found" error.
-		//http.NotFound(aWriter, aRequest)
+	case `send`:
+		qo := db.NewQueryOptions(AppArgs.BooksPerPage)
+		so := sessions.GetSession(aRequest)
+		if qos, ok := so.GetString("QOS"); ok {
+			qo.Scan(qos)
+		}
+
+		dbHandle, err := db.OpenDatabase(aRequest.Context())
+		if nil != err {
+			handleInternalError(aWriter,
+				`TPageHandler.handlePOST('`+path+`')`,
+				fmt.Sprintf("db.OpenDatabase(): %v", err))
+			return
+		}
+		defer dbHandle.Close()
+
+		ph.handleSend(aWriter, aRequest, tail, qo, so, dbHandle)
+
+	case `shelf`:
+		ph.handleShelf(aWriter, aRequest, tail)
+
+	case `shelves`:
+		qo := db.NewQueryOptions(AppArgs.BooksPerPage)
+		so := sessions.GetSession(aRequest)
+		if qos, ok := so.GetString("QOS"); ok {
+			qo.Scan(qos)
+		}
+		ph.handleShelves(aWriter, aRequest, qo, so)
 
-		// Redirect all invalid URLs to the NSA:
-		http.Redirect(aWriter, aRequest, "https://www.nsa.gov/", http.StatusMovedPermanently)
+	default:
+		// if nothing matched (above) reply according to the
+		// `unknownMode` option.
+		ph.handleUnknown(aWriter, aRequest)
 	}
 } // handlePOST()
 
@@ -507,7 +733,7 @@ func (ph *TPageHandler) handleQuery(aWriter http.ResponseWriter, aRequest *http.
 	}
 	if nil != err {
 		msg := fmt.Sprintf("QueryBy/QuerySearch: %v", err)
-		apachelogger.Err("TPageHandler.handleQuery()", msg)
+		logRequest(aRequest, "TPageHandler.handleQuery()", msg)
 	}
 	if 0 < count {
 		aOptions.QueryCount = uint(count)
@@ -524,11 +750,17 @@ func (ph *TPageHandler) handleQuery(aWriter http.ResponseWriter, aRequest *http.
 	hasLast := BLast < BCount
 	hasNext := BCount > BLast
 	hasPrev := aOptions.LimitStart >= aOptions.LimitLength
+	// A selection (but not the whole library) can be downloaded:
+	canZip := (0 < BCount) && (uint(AppArgs.ZipMaxBooks) >= BCount) &&
+		ph.may(aRequest, permBulk) &&
+		((0 < len(aOptions.Matching)) ||
+			((0 < aOptions.ID) && (0 < len(aOptions.Entity)) && (`all` != aOptions.Entity)))
 	aOptions.IncLimit()
 	pageData := ph.basicTemplateData(aRequest, aOptions).
 		Set("BFirst", BFirst).
 		Set("BLast", BLast).
 		Set("BCount", BCount).
+		Set("CanZip", canZip).
 		Set("Documents", doclist).
 		Set("HasFirst", hasFirst).
 		Set("HasLast", hasLast).
@@ -538,6 +770,7 @@ func (ph *TPageHandler) handleQuery(aWriter http.ResponseWriter, aRequest *http.
 		Set("SID", aSession.ID()).
 		Set("SIDNAME", sessions.SIDname()).
 		Set("ShowForm", true)
+	ph.setShelfData(aRequest, pageData, aOptions)
 	ph.handleReply("index", aWriter, aOptions, aSession, pageData)
 } // handleQuery()
 
@@ -551,6 +784,7 @@ func (ph *TPageHandler) handleQuery(aWriter http.ResponseWriter, aRequest *http.
 func (ph *TPageHandler) handleReply(aPage string, aWriter http.ResponseWriter, aOptions *db.TQueryOptions, aSession *sessions.TSession, aPageData *TemplateData) {
 	// store query options in session data
 	aSession.Set("QOS", aOptions.String())
+	adminSessions.touch(aSession.ID(), adminSessionTTL())
 
 	if err := ph.viewList.Render(aPage, aWriter, aPageData); nil != err {
 		handleInternalError(aWriter, `TPageHandler.handleReply()`,
@@ -572,7 +806,15 @@ func (ph *TPageHandler) NeedAuthentication(aRequest *http.Request) bool {
 		return true
 	}
 	path, _ := URLparts(aRequest.URL.Path)
-	return (`file` == path)
+	switch path {
+	case `account`, `bookmark`, `favourites`, `reading`, `shelf`, `shelves`:
+		// The API tokens, reading state, and shelves are per-user
+		// properties.
+		return true
+	}
+	// Anonymous visitors have to log in if their role doesn't allow
+	// the requested page:
+	return 0 == ph.userPermissions(``)&routePermission(path)
 } // NeedAuthentication()
 
 // ServeHTTP handles the incoming HTTP requests.
@@ -580,6 +822,24 @@ func (ph *TPageHandler) NeedAuthentication(aRequest *http.Request) bool {
 //	`aWriter` Used by the HTTP handler to construct an HTTP response.
 //	`aRequest` The HTTP request received by the server.
 func (ph *TPageHandler) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Request) {
+	path, _ := URLparts(aRequest.URL.Path)
+	// The metrics' route label mustn't depend on an API token prefix:
+	_, route := splitTokenPath(aRequest.URL.Path)
+	route, _ = URLparts(route)
+	id := db.RequestID(aRequest.Context()) // see `WrapErrorPages()`
+	if 0 == len(id) {
+		id = requestID(aRequest)
+		aRequest = aRequest.WithContext(db.WithRequestID(aRequest.Context(), id))
+	}
+	aWriter.Header().Set(requestIDHeader, id)
+	sw := &tStatusWriter{ResponseWriter: aWriter}
+	aWriter = sw
+	defer func(aStart time.Time, aMethod, aURL string) {
+		elapsed := time.Since(aStart)
+		srvMetrics.observeRequest(route, sw.code(), elapsed)
+		logEntry(levelDebug, id, "TPageHandler.ServeHTTP()",
+			fmt.Sprintf("%s %s: %d in %v", aMethod, aURL, sw.code(), elapsed))
+	}(time.Now(), aRequest.Method, aRequest.URL.Path)
 	defer func() {
 		if err := recover(); err != nil {
 			var msg string
@@ -593,12 +853,51 @@ func (ph *TPageHandler) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Re
 	}()
 
 	aWriter.Header().Set(`Access-Control-Allow-Methods`, `GET, HEAD, POST`)
-	if ph.NeedAuthentication(aRequest) {
-		if err := ph.usrList.IsAuthenticated(aRequest); nil != err {
-			passlist.Deny(AppArgs.Realm, aWriter)
-			return
-		}
+	switch path {
+	case `healthz`:
+		// The health checks are available without login.
+		ph.handleHealth(aWriter, aRequest)
+		return
+
+	case `metrics`:
+		// The metrics are protected by network and token
+		// instead of the users' logins and roles.
+		ph.handleMetrics(aWriter, aRequest)
+		return
+
+	case `readyz`:
+		ph.handleReady(aWriter, aRequest)
+		return
+	}
+	aRequest, ok := ph.checkToken(aWriter, aRequest)
+	if !ok {
+		return
+	}
+	var user string // anonymous
+	token, _ := requestToken(aRequest)
+	if nil != token {
+		user = token.User
+	} else if user, ok = ph.checkLogin(aWriter, aRequest); !ok {
+		return
+	}
+	if ph.NeedAuthentication(aRequest) && (0 == len(user)) {
+		passlist.Deny(AppArgs.Realm, aWriter)
+		return
+	}
+	path, _ = URLparts(aRequest.URL.Path)
+	perms := ph.userPermissions(user)
+	if nil != token {
+		perms &= tokenPermissions(token, aRequest.Method)
 	}
+	if 0 == perms&routePermission(path) {
+		msg := fmt.Sprintf("user %q may not access %q", user, aRequest.URL.Path)
+		logContext(aRequest.Context(), levelWarn, "TPageHandler.ServeHTTP()", msg)
+
+		http.Error(aWriter, `access forbidden`, http.StatusForbidden)
+		return
+	}
+	// All database queries are restricted according to the user:
+	aRequest = aRequest.WithContext(db.WithUser(aRequest.Context(), user))
 
 	switch aRequest.Method {
 	case `GET`:
@@ -608,14 +907,81 @@ func (ph *TPageHandler) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Re
 		ph.handleGET(aWriter, aRequest)
 
 	case `POST`:
+		if !sameOrigin(aRequest) {
+			msg := fmt.Sprintf("cross-site POST %q from %s (origin %q, referer %q)",
+				aRequest.URL.Path, clientIP(aRequest),
+				aRequest.Header.Get(`Origin`), aRequest.Header.Get(`Referer`))
+			logContext(aRequest.Context(), levelWarn, "TPageHandler.ServeHTTP()", msg)
+
+			http.Error(aWriter, `access forbidden`, http.StatusForbidden)
+			return
+		}
 		ph.handlePOST(aWriter, aRequest)
 
 	default:
 		msg := fmt.Sprintf("unsupported request method: %v", aRequest.Method)
-		apachelogger.Err("TPageHandler.ServeHTTP()", msg)
+		logContext(aRequest.Context(), levelWarn, "TPageHandler.ServeHTTP()", msg)
 
 		http.Error(aWriter, msg, http.StatusMethodNotAllowed)
 	}
 } // ServeHTTP()
 
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+type (
+	// `tRequestPager` provides the error pages of a single web
+	// request, implementing the `TErrorPager` interface.
+	tRequestPager struct {
+		ph        *TPageHandler
+		requestID string
+	}
+)
+
+// GetErrorPage returns an error page for `aStatus` showing the
+// request's ID.
+//
+//	`aData` The original error text.
+//	`aStatus` The number of the actual HTTP error status.
+func (rp *tRequestPager) GetErrorPage(aData []byte, aStatus int) []byte {
+	return rp.ph.errorPage(aData, aStatus, rp.requestID)
+} // GetErrorPage()
+
+// `rawErrorRoute()` returns whether the replies to `aPath` are
+// sent as they are, i.e. without error pages.
+//
+// The API and health checks send JSON, the metrics plain text;
+// their clients aren't browsers.
+//
+//	`aPath` The requested URL path.
+func rawErrorRoute(aPath string) bool {
+	_, aPath = splitTokenPath(aPath)
+	switch path, _ := URLparts(aPath); path {
+	case `api`, `healthz`, `metrics`, `readyz`:
+		return true
+	}
+
+	return false
+} // rawErrorRoute()
+
+// WrapErrorPages returns `aHandler` wrapped by an error handler
+// replacing the error messages by the error pages of `aHandler`.
+//
+// Each request gets its ID here so the error pages can show it.
+// The API, health, and metrics replies are left untouched.
+//
+//	`aHandler` The page handler serving the requests.
+func WrapErrorPages(aHandler *TPageHandler) http.Handler {
+	return http.HandlerFunc(
+		func(aWriter http.ResponseWriter, aRequest *http.Request) {
+			id := requestID(aRequest)
+			aRequest = aRequest.WithContext(db.WithRequestID(aRequest.Context(), id))
+			if rawErrorRoute(aRequest.URL.Path) {
+				aHandler.ServeHTTP(aWriter, aRequest)
+				return
+			}
+			errorhandler.Wrap(aHandler, &tRequestPager{aHandler, id}).
+				ServeHTTP(aWriter, aRequest)
+		})
+} // WrapErrorPages()
+
 /* _EoF_ */
@@ -6,7 +6,10 @@
 
 package kaliber
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
@@ -56,3 +59,39 @@ func TestURLparts(t *testing.T) {
 		})
 	}
 } // TestURLparts()
+
+func TestTPageHandler_errorPage(t *testing.T) {
+	vl, err := newViewList(`./views`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ph := &TPageHandler{viewList: vl}
+
+	tests := []struct {
+		name   string
+		data   string
+		status int
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `partial content`, 206, ``},
+		{" 2", `404`, 500, `<code>abc123</code>`},
+		{" 3", `page not found`, 404, `<code>abc123</code>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(ph.errorPage([]byte(tt.data), tt.status, `abc123`))
+			if 0 == len(tt.want) {
+				if 0 < len(got) {
+					t.Errorf("errorPage() = %q, want no page", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("errorPage() = %q, misses %q", got, tt.want)
+			}
+		})
+	}
+} // TestTPageHandler_errorPage()
+
+/* _EoF_ */
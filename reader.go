@@ -0,0 +1,573 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the in-browser reader for EPUB documents.
+ *
+ * The reader page is served as `/read/{id}/` with the chapter to
+ * show given by the `c` parameter; the EPUB's internal resources
+ * (chapters, stylesheets, images etc.) are served as
+ * `/read/{id}/{path}` with `{path}` being the resource's name
+ * inside the EPUB archive.
+ */
+
+type (
+	// `tEpub` represents an opened EPUB archive.
+	tEpub struct {
+		archive *zip.ReadCloser
+		files   map[string]*zip.File // the archive's files by name
+		types   map[string]string    // media types by filename
+		spine   []string             // filenames in reading order
+		title   string               // the book's title
+		toc     []tEpubTOCEntry      // the table of contents
+	}
+
+	// `tEpubTOCEntry` is a single entry of an EPUB's table of contents.
+	tEpubTOCEntry struct {
+		Href  string // internal filename (incl. optional fragment)
+		Level int    // nesting level (starting with `0`)
+		Title string // the entry's text
+	}
+
+	// `tReaderLink` is a single link of the reader page's
+	// table of contents.
+	tReaderLink struct {
+		Current bool
+		Level   int
+		Title   string
+		URL     string
+	}
+)
+
+type (
+	// `META-INF/container.xml`
+	tEpubContainer struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+
+	// The OPF package document
+	tEpubPackage struct {
+		Titles []string `xml:"metadata>title"`
+		Items  []struct {
+			ID         string `xml:"id,attr"`
+			Href       string `xml:"href,attr"`
+			MediaType  string `xml:"media-type,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"manifest>item"`
+		Spine struct {
+			Toc      string `xml:"toc,attr"`
+			ItemRefs []struct {
+				IDref  string `xml:"idref,attr"`
+				Linear string `xml:"linear,attr"`
+			} `xml:"itemref"`
+		} `xml:"spine"`
+	}
+
+	// A navigation point of an EPUB2 NCX file
+	tEpubNavPoint struct {
+		Label   string `xml:"navLabel>text"`
+		Content struct {
+			Src string `xml:"src,attr"`
+		} `xml:"content"`
+		Points []tEpubNavPoint `xml:"navPoint"`
+	}
+
+	// EPUB2 NCX file
+	tEpubNCX struct {
+		Points []tEpubNavPoint `xml:"navMap>navPoint"`
+	}
+)
+
+var (
+	// `errEpubInvalid` is returned for archives not containing
+	// a readable EPUB structure.
+	errEpubInvalid = errors.New(`invalid EPUB structure`)
+
+	// RegEx to validate a fragment identifier.
+	rdFragmentRE = regexp.MustCompile(`^[\w.:-]+$`)
+)
+
+// `epubPath()` returns the archive's filename of `aHref` relative
+// to the file `aBase`.
+//
+//	`aBase` The archive's filename referencing `aHref`.
+//	`aHref` The (possibly escaped) reference to resolve.
+func epubPath(aBase, aHref string) string {
+	if h, err := url.PathUnescape(aHref); nil == err {
+		aHref = h
+	}
+	if 0 == len(aHref) {
+		return ``
+	}
+
+	return strings.TrimPrefix(path.Join(path.Dir(aBase), aHref), `/`)
+} // epubPath()
+
+// `openEpub()` opens the EPUB file `aFilename` and parses its
+// package document and table of contents.
+//
+// The caller is responsible for closing the returned instance.
+//
+//	`aFilename` The absolute path-/filename of the EPUB file.
+func openEpub(aFilename string) (*tEpub, error) {
+	archive, err := zip.OpenReader(aFilename)
+	if nil != err {
+		return nil, err
+	}
+	result := &tEpub{
+		archive: archive,
+		files:   make(map[string]*zip.File, len(archive.File)),
+		types:   make(map[string]string, len(archive.File)),
+	}
+	for _, file := range archive.File {
+		result.files[file.Name] = file
+	}
+	if err = result.parse(); nil != err {
+		_ = archive.Close()
+		return nil, err
+	}
+
+	return result, nil
+} // openEpub()
+
+// Close closes the EPUB archive.
+func (ep *tEpub) Close() error {
+	return ep.archive.Close()
+} // Close()
+
+// `chapterIndex()` returns the spine index of `aHref` or `-1`
+// if `aHref` is not part of the spine.
+//
+//	`aHref` The archive's filename (with optional fragment).
+func (ep *tEpub) chapterIndex(aHref string) int {
+	if pos := strings.IndexByte(aHref, '#'); 0 <= pos {
+		aHref = aHref[:pos]
+	}
+	for idx, name := range ep.spine {
+		if name == aHref {
+			return idx
+		}
+	}
+
+	return -1
+} // chapterIndex()
+
+// `contentType()` returns the media type of the archive's
+// file `aName`.
+//
+//	`aName` The archive's filename.
+func (ep *tEpub) contentType(aName string) string {
+	if result, ok := ep.types[aName]; ok && (0 < len(result)) {
+		return result
+	}
+	if result := mime.TypeByExtension(path.Ext(aName)); 0 < len(result) {
+		return result
+	}
+
+	return `application/octet-stream`
+} // contentType()
+
+// `decode()` unmarshals the archive's XML file `aName` into `aValue`.
+//
+//	`aName` The archive's filename.
+//	`aValue` The data structure to fill.
+func (ep *tEpub) decode(aName string, aValue interface{}) error {
+	file, ok := ep.files[aName]
+	if !ok {
+		return errEpubInvalid
+	}
+	rc, err := file.Open()
+	if nil != err {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = func(aCharset string, aInput io.Reader) (io.Reader, error) {
+		return aInput, nil // there's no support for other charsets
+	}
+
+	return decoder.Decode(aValue)
+} // decode()
+
+// `parse()` reads the EPUB's container, package document, and
+// table of contents.
+func (ep *tEpub) parse() error {
+	var container tEpubContainer
+	if err := ep.decode(`META-INF/container.xml`, &container); nil != err {
+		return err
+	}
+	opfName := ``
+	for _, rootfile := range container.Rootfiles {
+		if (0 == len(rootfile.MediaType)) ||
+			(`application/oebps-package+xml` == rootfile.MediaType) {
+			opfName = rootfile.FullPath
+			break
+		}
+	}
+	if 0 == len(opfName) {
+		return errEpubInvalid
+	}
+
+	var opf tEpubPackage
+	if err := ep.decode(opfName, &opf); nil != err {
+		return err
+	}
+	if 0 < len(opf.Titles) {
+		ep.title = strings.TrimSpace(opf.Titles[0])
+	}
+	items := make(map[string]string, len(opf.Items))
+	navName, ncxName := ``, ``
+	for _, item := range opf.Items {
+		name := epubPath(opfName, item.Href)
+		items[item.ID] = name
+		ep.types[name] = item.MediaType
+		for _, prop := range strings.Fields(item.Properties) {
+			if `nav` == prop {
+				navName = name
+			}
+		}
+		if item.ID == opf.Spine.Toc {
+			ncxName = name
+		}
+	}
+	for _, ref := range opf.Spine.ItemRefs {
+		if `no` == ref.Linear {
+			continue // auxiliary content not in reading order
+		}
+		if name, ok := items[ref.IDref]; ok {
+			ep.spine = append(ep.spine, name)
+		}
+	}
+	if 0 == len(ep.spine) {
+		return errEpubInvalid
+	}
+
+	if 0 < len(navName) {
+		ep.toc = ep.parseNav(navName)
+	}
+	if (0 == len(ep.toc)) && (0 < len(ncxName)) {
+		ep.toc = ep.parseNCX(ncxName)
+	}
+	if 0 == len(ep.toc) {
+		// Without a table of contents we list the spine's files:
+		for idx, name := range ep.spine {
+			ep.toc = append(ep.toc, tEpubTOCEntry{
+				Href:  name,
+				Title: strconv.Itoa(idx+1) + `. ` + path.Base(name),
+			})
+		}
+	}
+
+	return nil
+} // parse()
+
+// `parseNav()` returns the table of contents read from the
+// EPUB3 navigation document `aName`.
+//
+//	`aName` The archive's filename of the navigation document.
+func (ep *tEpub) parseNav(aName string) (rList []tEpubTOCEntry) {
+	file, ok := ep.files[aName]
+	if !ok {
+		return
+	}
+	rc, err := file.Open()
+	if nil != err {
+		return
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var (
+		entry          *tEpubTOCEntry
+		inTOC, isTOC   bool
+		level, navNest int
+	)
+	for {
+		token, err := decoder.Token()
+		if nil != err {
+			break
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case `nav`:
+				navNest++
+				if inTOC {
+					continue
+				}
+				isTOC = false
+				for _, attr := range tok.Attr {
+					if (`type` == attr.Name.Local) && (`toc` == attr.Value) {
+						isTOC = true
+					}
+				}
+				inTOC, level = isTOC, -1
+			case `ol`:
+				if inTOC {
+					level++
+				}
+			case `a`:
+				if !inTOC {
+					continue
+				}
+				entry = &tEpubTOCEntry{Level: level}
+				if 0 > entry.Level {
+					entry.Level = 0
+				}
+				for _, attr := range tok.Attr {
+					if `href` == attr.Name.Local {
+						entry.Href = epubPath(aName, attr.Value)
+					}
+				}
+			}
+
+		case xml.EndElement:
+			switch tok.Name.Local {
+			case `nav`:
+				navNest--
+				if 0 == navNest {
+					inTOC = false
+				}
+			case `ol`:
+				if inTOC {
+					level--
+				}
+			case `a`:
+				if nil != entry {
+					entry.Title = strings.Join(strings.Fields(entry.Title), ` `)
+					if 0 < len(entry.Href) {
+						rList = append(rList, *entry)
+					}
+					entry = nil
+				}
+			}
+
+		case xml.CharData:
+			if nil != entry {
+				entry.Title += string(tok)
+			}
+		}
+	}
+
+	return
+} // parseNav()
+
+// `parseNCX()` returns the table of contents read from the
+// EPUB2 NCX file `aName`.
+//
+//	`aName` The archive's filename of the NCX file.
+func (ep *tEpub) parseNCX(aName string) (rList []tEpubTOCEntry) {
+	var ncx tEpubNCX
+	if err := ep.decode(aName, &ncx); nil != err {
+		return
+	}
+	var walk func(aPoints []tEpubNavPoint, aLevel int)
+	walk = func(aPoints []tEpubNavPoint, aLevel int) {
+		for _, point := range aPoints {
+			if href := epubPath(aName, point.Content.Src); 0 < len(href) {
+				rList = append(rList, tEpubTOCEntry{
+					Href:  href,
+					Level: aLevel,
+					Title: strings.Join(strings.Fields(point.Label), ` `),
+				})
+			}
+			walk(point.Points, aLevel+1)
+		}
+	} // walk()
+	walk(ncx.Points, 0)
+
+	return
+} // parseNCX()
+
+// `serveFile()` sends the archive's file `aName` to the remote user.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aName` The archive's filename.
+func (ep *tEpub) serveFile(aWriter http.ResponseWriter, aRequest *http.Request, aName string) {
+	file, ok := ep.files[aName]
+	if (!ok) || file.FileInfo().IsDir() {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	rc, err := file.Open()
+	if nil != err {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	defer rc.Close()
+
+	header := aWriter.Header()
+	header.Set(`Content-Type`, ep.contentType(aName))
+	header.Set(`Content-Length`, strconv.FormatUint(file.UncompressedSize64, 10))
+	// The book's content must not run any scripts in our context:
+	header.Set(`Content-Security-Policy`, `script-src 'none'; object-src 'none'`)
+	header.Set(`X-Content-Type-Options`, `nosniff`)
+	if `HEAD` == aRequest.Method {
+		return
+	}
+	_, _ = io.Copy(aWriter, rc)
+} // serveFile()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `readerURL()` returns the URL of the reader page for chapter
+// `aChapter` of the document identified by `aID`.
+//
+//	`aID` The document's ID.
+//	`aChapter` The spine index of the chapter to show.
+//	`aFragment` An optional fragment identifier within the chapter.
+func readerURL(aID db.TID, aChapter int, aFragment string) string {
+	result := fmt.Sprintf(`/read/%d/`, aID)
+	if 0 < aChapter {
+		result += `?c=` + strconv.Itoa(aChapter)
+	}
+	if 0 < len(aFragment) {
+		if 0 < aChapter {
+			result += `&f=`
+		} else {
+			result += `?f=`
+		}
+		result += url.QueryEscape(aFragment)
+	}
+
+	return result
+} // readerURL()
+
+// `handleRead()` serves the EPUB reader page as well as the
+// EPUB's internal resources.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleRead(aWriter http.ResponseWriter, aRequest *http.Request, aOptions *db.TQueryOptions, aSession *sessions.TSession, aDB *db.TDataBase) {
+	// We use the raw path here since the internal filenames may
+	// contain characters not handled by `URLparts()`:
+	parts := strings.SplitN(strings.TrimPrefix(aRequest.URL.Path, `/read/`), `/`, 2)
+	id, _ := strconv.Atoi(parts[0])
+	if 2 > len(parts) {
+		// missing trailing slash would break relative links
+		http.Redirect(aWriter, aRequest, readerURL(db.TID(id), 0, ``), http.StatusMovedPermanently)
+		return
+	}
+	doc := aDB.QueryDocMini(aRequest.Context(), db.TID(id))
+	if nil == doc {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	file := doc.Filename(`EPUB`)
+	if 0 == len(file) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	fName := filepath.Join(db.CalibreLibraryPath(), file)
+	if 0 < len(parts[1]) {
+		// The EPUB's content doesn't change without the file changing:
+		aWriter.Header().Set(`Cache-Control`, `private, max-age=864000`) // 10 days
+		if fileNotModified(aWriter, aRequest, fName) {
+			return
+		}
+	}
+
+	epub, err := openEpub(fName)
+	if nil != err {
+		msg := fmt.Sprintf("openEpub(%s): %v", file, err)
+		logRequest(aRequest, "TPageHandler.handleRead()", msg)
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	defer epub.Close()
+
+	if 0 < len(parts[1]) {
+		epub.serveFile(aWriter, aRequest, parts[1])
+		return
+	}
+
+	chapter, _ := strconv.Atoi(aRequest.FormValue(`c`))
+	if (0 > chapter) || (len(epub.spine) <= chapter) {
+		chapter = 0
+	}
+	src := fmt.Sprintf(`/read/%d/`, doc.ID) + (&url.URL{Path: epub.spine[chapter]}).EscapedPath()
+	if f := aRequest.FormValue(`f`); rdFragmentRE.MatchString(f) {
+		src += `#` + f
+	}
+	toc := make([]tReaderLink, 0, len(epub.toc))
+	for _, entry := range epub.toc {
+		idx := epub.chapterIndex(entry.Href)
+		if 0 > idx {
+			continue // not part of the reading order
+		}
+		fragment := ``
+		if pos := strings.IndexByte(entry.Href, '#'); 0 <= pos {
+			fragment = entry.Href[pos+1:]
+		}
+		toc = append(toc, tReaderLink{
+			Current: idx == chapter,
+			Level:   entry.Level,
+			Title:   entry.Title,
+			URL:     readerURL(doc.ID, idx, fragment),
+		})
+	}
+	title := epub.title
+	if 0 == len(title) {
+		title = doc.Title
+	}
+
+	pageData := ph.basicTemplateData(aRequest, aOptions).
+		Set("Chapter", chapter+1).
+		Set("ChapterCount", len(epub.spine)).
+		Set("ChapterSrc", src).
+		Set("Document", doc).
+		Set("ReaderTitle", title).
+		Set("TOC", toc)
+	if 0 < chapter {
+		pageData.Set("PrevURL", readerURL(doc.ID, chapter-1, ``))
+	}
+	if chapter+1 < len(epub.spine) {
+		pageData.Set("NextURL", readerURL(doc.ID, chapter+1, ``))
+	}
+	ph.setBookmarkData(aRequest, pageData, doc.ID, readerURL(doc.ID, chapter, ``))
+
+	ph.handleReply(`reader`, aWriter, aOptions, aSession, pageData)
+} // handleRead()
+
+/* _EoF_ */
@@ -0,0 +1,136 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// `writeTestEpub()` creates an EPUB3 file with a navigation document.
+func writeTestEpub(t *testing.T) string {
+	fName := filepath.Join(t.TempDir(), `test.epub`)
+	file, err := os.Create(fName)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	files := []struct{ name, content string }{
+		{`mimetype`, `application/epub+zip`},
+		{`META-INF/container.xml`, `<?xml version="1.0"?><container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles><rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`},
+		{`EPUB/package.opf`, `<?xml version="1.0"?><package xmlns="http://www.idpf.org/2007/opf" version="3.0"><metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Test Book</dc:title></metadata><manifest><item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/><item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/><item id="c2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/><item id="img" href="img/pic.png" media-type="image/png"/></manifest><spine><itemref idref="nav" linear="no"/><itemref idref="c1"/><itemref idref="c2"/></spine></package>`},
+		{`EPUB/nav.xhtml`, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body><nav epub:type="toc"><ol><li><a href="text/chapter%201.xhtml">One&nbsp;</a><ol><li><a href="text/chapter%201.xhtml#part">Part</a></li></ol></li><li><a href="text/ch2.xhtml">Two</a></li></ol></nav><nav epub:type="landmarks"><ol><li><a href="text/ch2.xhtml">Landmark</a></li></ol></nav></body></html>`},
+		{`EPUB/text/chapter 1.xhtml`, `<html><body><p id="part">One</p></body></html>`},
+		{`EPUB/text/ch2.xhtml`, `<html><body><p>Two</p></body></html>`},
+	}
+	zw := zip.NewWriter(file)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(f.content)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	return fName
+} // writeTestEpub()
+
+func Test_epubPath(t *testing.T) {
+	type args struct {
+		aBase string
+		aHref string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{`OEBPS/content.opf`, `text/ch1.xhtml`}, `OEBPS/text/ch1.xhtml`},
+		{" 2", args{`content.opf`, `ch%201.xhtml`}, `ch 1.xhtml`},
+		{" 3", args{`OEBPS/text/nav.xhtml`, `../img/a.png`}, `OEBPS/img/a.png`},
+		{" 4", args{`OEBPS/toc.ncx`, `text/ch1.xhtml#s2`}, `OEBPS/text/ch1.xhtml#s2`},
+		{" 5", args{`OEBPS/toc.ncx`, ``}, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := epubPath(tt.args.aBase, tt.args.aHref); got != tt.want {
+				t.Errorf("epubPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_epubPath()
+
+func Test_openEpub(t *testing.T) {
+	epub, err := openEpub(writeTestEpub(t))
+	if nil != err {
+		t.Fatalf("openEpub() error = %v", err)
+	}
+	defer epub.Close()
+
+	if `Test Book` != epub.title {
+		t.Errorf("openEpub() title = %v, want %v", epub.title, `Test Book`)
+	}
+	if (2 != len(epub.spine)) || (`EPUB/text/chapter 1.xhtml` != epub.spine[0]) {
+		t.Errorf("openEpub() spine = %v", epub.spine)
+	}
+	if 3 != len(epub.toc) {
+		t.Fatalf("openEpub() toc = %v, want 3 entries", epub.toc)
+	}
+	if e := epub.toc[0]; (`One` != e.Title) || (0 != e.Level) {
+		t.Errorf("openEpub() toc[0] = %v", e)
+	}
+	if e := epub.toc[1]; (`EPUB/text/chapter 1.xhtml#part` != e.Href) || (1 != e.Level) {
+		t.Errorf("openEpub() toc[1] = %v", e)
+	}
+	if idx := epub.chapterIndex(epub.toc[2].Href); 1 != idx {
+		t.Errorf("chapterIndex() = %v, want %v", idx, 1)
+	}
+	if ct := epub.contentType(`EPUB/img/pic.png`); `image/png` != ct {
+		t.Errorf("contentType() = %v, want %v", ct, `image/png`)
+	}
+	if ct := epub.contentType(`EPUB/style.css`); `text/css; charset=utf-8` != ct {
+		t.Errorf("contentType() = %v, want %v", ct, `text/css; charset=utf-8`)
+	}
+} // Test_openEpub()
+
+func Test_readerURL(t *testing.T) {
+	type args struct {
+		aChapter  int
+		aFragment string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{0, ``}, `/read/7/`},
+		{" 2", args{3, ``}, `/read/7/?c=3`},
+		{" 3", args{3, `part`}, `/read/7/?c=3&f=part`},
+		{" 4", args{0, `part`}, `/read/7/?f=part`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readerURL(7, tt.args.aChapter, tt.args.aFragment); got != tt.want {
+				t.Errorf("readerURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_readerURL()
+
+/* _EoF_ */
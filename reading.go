@@ -0,0 +1,224 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+/*
+ * This file provides the handling of the users' reading state
+ * and bookmarks stored in Kaliber's own database.
+ *
+ * The reading state is changed by POSTing the `state` field to
+ * `/reading/{id}`; bookmarks are added by POSTing the `position`
+ * and `note` fields (or removed by POSTing the `delete` field)
+ * to `/bookmark/{id}`.
+ */
+
+// `authUser()` returns the name of the authenticated user or an
+// empty string if the request isn't (validly) authenticated.
+//
+// The user is checked once by `ServeHTTP()` and then stored
+// in the request's context.
+//
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) authUser(aRequest *http.Request) string {
+	user, _ := db.ContextUser(aRequest.Context())
+
+	return user
+} // authUser()
+
+// `readingUser()` returns the name of the user whose reading state
+// (and shelves) are to be used and whether there's a reading state
+// at all.
+//
+// Without a password list all visitors share the same (anonymous)
+// reading state; otherwise only authenticated users have one.
+//
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) readingUser(aRequest *http.Request) (string, bool) {
+	if 0 == len(db.UserDatabaseFile()) {
+		return ``, false
+	}
+	if nil == ph.usrList {
+		return ``, true
+	}
+	user := ph.authUser(aRequest)
+
+	return user, 0 < len(user)
+} // readingUser()
+
+// `setReadingUser()` prepares the reading state filter of `aOptions`
+// for the current user.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aOptions` The current query options to use.
+func (ph *TPageHandler) setReadingUser(aRequest *http.Request, aOptions *db.TQueryOptions) {
+	if user, ok := ph.readingUser(aRequest); ok {
+		aOptions.User = user
+	} else {
+		aOptions.ReadState = db.QoReadAll
+	}
+} // setReadingUser()
+
+// `bookmarkable()` reports whether `aPosition` is a valid reading
+// position of the document `aID`.
+//
+//	`aID` The document's ID.
+//	`aPosition` The position (i.e. the reader's URL) to check.
+func bookmarkable(aID db.TID, aPosition string) bool {
+	for _, prefix := range []string{`/read/`, `/comic/`} {
+		if strings.HasPrefix(aPosition, fmt.Sprintf(`%s%d/`, prefix, aID)) {
+			return !strings.ContainsAny(aPosition, "\"<>\\ \t\r\n")
+		}
+	}
+
+	return false
+} // bookmarkable()
+
+// `recordPosition()` stores `aPosition` as the current user's last
+// reading position of the document `aID`.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aID` The document's ID.
+//	`aPosition` The current reading position (i.e. the reader's URL).
+func (ph *TPageHandler) recordPosition(aRequest *http.Request, aID db.TID, aPosition string) {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		return
+	}
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil == err {
+		err = udb.SetPosition(aRequest.Context(), user, aID, aPosition)
+	}
+	if nil != err {
+		msg := fmt.Sprintf("SetPosition(%d, %s): %v", aID, aPosition, err)
+		logRequest(aRequest, "TPageHandler.recordPosition()", msg)
+	}
+} // recordPosition()
+
+// `setBookmarkData()` adds the data needed for the bookmark form
+// of the reader and viewer pages.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aPageData` The page's template data.
+//	`aID` The document's ID.
+//	`aPosition` The current reading position (i.e. the reader's URL).
+func (ph *TPageHandler) setBookmarkData(aRequest *http.Request, aPageData *TemplateData, aID db.TID, aPosition string) {
+	if _, ok := ph.readingUser(aRequest); ok {
+		aPageData.Set("BookmarkPos", aPosition)
+		ph.recordPosition(aRequest, aID, aPosition)
+	}
+} // setBookmarkData()
+
+// `setReadingData()` adds the current user's reading state and
+// bookmarks of the document `aID` to `aPageData`.
+//
+// The function returns a value identifying the current reading state
+// (to be used for the page's ETag).
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aPageData` The page's template data.
+//	`aID` The document's ID.
+func (ph *TPageHandler) setReadingData(aRequest *http.Request, aPageData *TemplateData, aID db.TID) string {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		return ``
+	}
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		msg := fmt.Sprintf("OpenUserDatabase(): %v", err)
+		logRequest(aRequest, "TPageHandler.setReadingData()", msg)
+		return ``
+	}
+	state, err := udb.ReadingState(aRequest.Context(), user, aID)
+	if nil != err {
+		msg := fmt.Sprintf("ReadingState(%d): %v", aID, err)
+		logRequest(aRequest, "TPageHandler.setReadingData()", msg)
+		return ``
+	}
+	bookmarks, err := udb.Bookmarks(aRequest.Context(), user, aID)
+	if nil != err {
+		msg := fmt.Sprintf("Bookmarks(%d): %v", aID, err)
+		logRequest(aRequest, "TPageHandler.setReadingData()", msg)
+	}
+	var lastMark int64
+	if 0 < len(bookmarks) {
+		lastMark = bookmarks[len(bookmarks)-1].ID
+	}
+	aPageData.Set("Bookmarks", bookmarks).
+		Set("CanRead", true).
+		Set("Reading", state)
+
+	return fmt.Sprintf("%s|%d|%d|%d", user, state.Updated.UnixNano(), len(bookmarks), lastMark)
+} // setReadingData()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleReading()` changes the current user's reading state or
+// bookmarks and redirects the remote user accordingly.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aPath` The URL's first path segment (`bookmark` or `reading`).
+//	`aTail` The URL's remaining path (i.e. `{id}`).
+func (ph *TPageHandler) handleReading(aWriter http.ResponseWriter, aRequest *http.Request, aPath, aTail string) {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	num, _ := strconv.Atoi(strings.SplitN(aTail, `/`, 2)[0])
+	if 0 >= num {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	id := db.TID(num)
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleReading()`,
+			fmt.Sprintf("db.OpenUserDatabase(): %v", err))
+		return
+	}
+	target := fmt.Sprintf("/doc/%d/doc.html", id)
+
+	switch aPath {
+	case `bookmark`:
+		if bmID, _ := strconv.ParseInt(aRequest.FormValue(`delete`), 10, 64); 0 < bmID {
+			err = udb.DeleteBookmark(aRequest.Context(), user, bmID)
+			break
+		}
+		position := aRequest.FormValue(`position`)
+		if !bookmarkable(id, position) {
+			http.Error(aWriter, `invalid bookmark position`, http.StatusBadRequest)
+			return
+		}
+		err = udb.AddBookmark(aRequest.Context(), user, id, position, aRequest.FormValue(`note`))
+		target = position
+
+	case `reading`:
+		err = udb.SetReadingState(aRequest.Context(), user, id,
+			db.ReadStateByName(aRequest.FormValue(`state`)))
+	}
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleReading()`,
+			fmt.Sprintf("%s(%d): %v", aPath, id, err))
+		return
+	}
+
+	http.Redirect(aWriter, aRequest, target, http.StatusSeeOther)
+} // handleReading()
+
+/* _EoF_ */
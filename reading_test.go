@@ -0,0 +1,45 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"testing"
+
+	"github.com/mwat56/kaliber/db"
+)
+
+func Test_bookmarkable(t *testing.T) {
+	type args struct {
+		aID       db.TID
+		aPosition string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		// TODO: Add test cases.
+		{" 1", args{1, `/read/1/?c=3`}, true},
+		{" 2", args{12, `/comic/12/?p=5`}, true},
+		{" 3", args{1, `/read/12/?c=3`}, false},
+		{" 4", args{1, `/doc/1/`}, false},
+		{" 5", args{1, `https://example.com/read/1/`}, false},
+		{" 6", args{1, `/read/1/"><script>`}, false},
+		{" 7", args{1, ``}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bookmarkable(tt.args.aID, tt.args.aPosition); got != tt.want {
+				t.Errorf("bookmarkable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_bookmarkable()
+
+/* _EoF_ */
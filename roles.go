@@ -0,0 +1,171 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+/*
+ * This file provides the users' roles and their permissions.
+ *
+ * The roles are assigned by a JSON file (see `roleFile` in the INI
+ * file) mapping the user names to role names, e.g.
+ *
+ *	{"alice": "admin", "kid": "viewer", "-": "guest", "*": "reader"}
+ *
+ * where the special user `-` stands for anonymous visitors and `*`
+ * for all authenticated users without an own entry.
+ */
+
+type (
+	// `tPermission` is a set of actions allowed to a role.
+	tPermission uint8
+
+	// `tRoleList` maps the user names to their role's name.
+	tRoleList map[string]string
+)
+
+const (
+	permBrowse   tPermission = 1 << iota // lists, document pages, covers etc.
+	permRead                             // reading documents in the browser
+	permDownload                         // downloading single documents
+	permBulk                             // ZIP downloads of result sets
+	permSend                             // sending documents by mail
+	permAdmin                            // the administrative pages
+)
+
+const (
+	roleAdmin  = `admin`  // everything
+	roleGuest  = `guest`  // browsing only
+	roleReader = `reader` // everything but the administrative pages
+	roleViewer = `viewer` // browsing and reading without downloads
+
+	roleAnonymous = `-` // the role list's key for anonymous visitors
+	roleDefault   = `*` // the role list's key for all other users
+)
+
+var (
+	// `roleMatrix` holds the permissions of each role.
+	roleMatrix = map[string]tPermission{
+		roleAdmin:  permBrowse | permRead | permDownload | permBulk | permSend | permAdmin,
+		roleGuest:  permBrowse,
+		roleReader: permBrowse | permRead | permDownload | permBulk | permSend,
+		roleViewer: permBrowse | permRead,
+	}
+)
+
+// `loadRoles()` reads the user roles from `aFilename`.
+//
+// An empty filename results in an empty list (i.e. the default roles).
+//
+//	`aFilename` The JSON file to read.
+func loadRoles(aFilename string) (tRoleList, error) {
+	result := make(tRoleList)
+	if 0 == len(aFilename) {
+		return result, nil
+	}
+	data, err := os.ReadFile(aFilename) // #nosec G304
+	if nil != err {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &result); nil != err {
+		return nil, fmt.Errorf("%s: %w", aFilename, err)
+	}
+	for user, role := range result {
+		if _, ok := roleMatrix[role]; !ok {
+			return nil, fmt.Errorf("%s: unknown role %q of user %q", aFilename, role, user)
+		}
+	}
+
+	return result, nil
+} // loadRoles()
+
+// `permissions()` returns the permissions of `aUser`'s role.
+//
+// Users without an own entry get the role of the `*` entry or
+// (if there's none) `aDefault`.
+//
+//	`aUser` The user's name (empty for anonymous visitors).
+//	`aDefault` The role to use if there's no matching entry.
+func (rl tRoleList) permissions(aUser, aDefault string) tPermission {
+	if 0 == len(aUser) {
+		aUser = roleAnonymous
+	}
+	role, ok := rl[aUser]
+	if (!ok) && (roleAnonymous != aUser) {
+		role, ok = rl[roleDefault]
+	}
+	if !ok {
+		role = aDefault
+	}
+
+	return roleMatrix[role]
+} // permissions()
+
+// `routePermission()` returns the permission needed for the URL's
+// first path segment.
+//
+//	`aPath` The URL's first path segment.
+func routePermission(aPath string) tPermission {
+	switch aPath {
+	case `admin`:
+		return permAdmin
+	case `comic`, `read`:
+		return permRead
+	case `file`:
+		return permDownload
+	case `send`:
+		return permSend
+	case `zip`:
+		return permBulk
+	}
+
+	return permBrowse
+} // routePermission()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `userPermissions()` returns the permissions of `aUser`.
+//
+// Without a password list all visitors are readers by default;
+// otherwise anonymous visitors are guests and authenticated users
+// are readers.
+//
+//	`aUser` The user's name (empty for anonymous visitors).
+func (ph *TPageHandler) userPermissions(aUser string) tPermission {
+	def := roleReader
+	if (nil != ph.usrList) && (0 == len(aUser)) {
+		def = roleGuest
+	}
+
+	return ph.roles.permissions(aUser, def)
+} // userPermissions()
+
+// `may()` reports whether the current user may (or after logging in
+// might) perform the action `aPermission`.
+//
+// It's used to hide the links to pages the user isn't allowed to see.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aPermission` The permission to check.
+func (ph *TPageHandler) may(aRequest *http.Request, aPermission tPermission) bool {
+	user := ph.authUser(aRequest)
+	if (0 == len(user)) && (nil != ph.usrList) {
+		// Anonymous visitors will be asked to log in.
+		return true
+	}
+
+	return 0 != ph.userPermissions(user)&aPermission
+} // may()
+
+/* _EoF_ */
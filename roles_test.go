@@ -0,0 +1,149 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwat56/passlist"
+)
+
+func Test_loadRoles(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, `good.json`)
+	if err := os.WriteFile(good, []byte(`{"alice": "admin", "-": "guest"}`), 0600); nil != err {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, `bad.json`)
+	if err := os.WriteFile(bad, []byte(`{"alice": "superuser"}`), 0600); nil != err {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		file  string
+		want  int
+		isErr bool
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, 0, false},
+		{" 2", good, 2, false},
+		{" 3", bad, 0, true},
+		{" 4", good + `.missing`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadRoles(tt.file)
+			if (nil != err) != tt.isErr {
+				t.Errorf("loadRoles() error = %v, wantErr %v", err, tt.isErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("loadRoles() = %v, want %d entries", got, tt.want)
+			}
+		})
+	}
+} // Test_loadRoles()
+
+func Test_tRoleList_permissions(t *testing.T) {
+	roles := tRoleList{`alice`: roleAdmin, `kid`: roleViewer, `*`: roleGuest}
+	tests := []struct {
+		name string
+		rl   tRoleList
+		user string
+		aDef string
+		want tPermission
+	}{
+		// TODO: Add test cases.
+		{" 1", roles, `alice`, roleReader, roleMatrix[roleAdmin]},
+		{" 2", roles, `kid`, roleReader, roleMatrix[roleViewer]},
+		{" 3", roles, `bob`, roleReader, roleMatrix[roleGuest]},
+		{" 4", roles, ``, roleReader, roleMatrix[roleReader]},
+		{" 5", tRoleList{`-`: roleViewer}, ``, roleGuest, roleMatrix[roleViewer]},
+		{" 6", nil, `bob`, roleReader, roleMatrix[roleReader]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rl.permissions(tt.user, tt.aDef); got != tt.want {
+				t.Errorf("tRoleList.permissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_tRoleList_permissions()
+
+func Test_roleMatrix(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		perm tPermission
+		want bool
+	}{
+		// TODO: Add test cases.
+		{" 1", roleAdmin, permAdmin, true},
+		{" 2", roleReader, permAdmin, false},
+		{" 3", roleReader, permBulk, true},
+		{" 4", roleViewer, permRead, true},
+		{" 5", roleViewer, permDownload, false},
+		{" 6", roleViewer, permSend, false},
+		{" 7", roleGuest, permBrowse, true},
+		{" 8", roleGuest, permRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := 0 != roleMatrix[tt.role]&tt.perm; got != tt.want {
+				t.Errorf("roleMatrix[%s]&%v = %v, want %v", tt.role, tt.perm, got, tt.want)
+			}
+		})
+	}
+} // Test_roleMatrix()
+
+func Test_routePermission(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want tPermission
+	}{
+		// TODO: Add test cases.
+		{" 1", `all`, permBrowse},
+		{" 2", `file`, permDownload},
+		{" 3", `zip`, permBulk},
+		{" 4", `send`, permSend},
+		{" 5", `read`, permRead},
+		{" 6", `comic`, permRead},
+		{" 7", `admin`, permAdmin},
+		{" 8", `cover`, permBrowse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routePermission(tt.path); got != tt.want {
+				t.Errorf("routePermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_routePermission()
+
+func TestTPageHandler_userPermissions(t *testing.T) {
+	ph := &TPageHandler{roles: tRoleList{`kid`: roleViewer}}
+	if got := ph.userPermissions(``); got != roleMatrix[roleReader] {
+		t.Errorf("userPermissions() without passlist = %v, want reader", got)
+	}
+	ph.usrList = &passlist.TPassList{}
+	if got := ph.userPermissions(``); got != roleMatrix[roleGuest] {
+		t.Errorf("userPermissions() anonymous = %v, want guest", got)
+	}
+	if got := ph.userPermissions(`kid`); got != roleMatrix[roleViewer] {
+		t.Errorf("userPermissions(kid) = %v, want viewer", got)
+	}
+	if got := ph.userPermissions(`bob`); got != roleMatrix[roleReader] {
+		t.Errorf("userPermissions(bob) = %v, want reader", got)
+	}
+} // TestTPageHandler_userPermissions()
+
+/* _EoF_ */
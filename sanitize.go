@@ -0,0 +1,86 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+/*
+ * This file provides a function to clean up user-provided HTML
+ * (i.e. `Calibre's` comments) before embedding it elsewhere.
+ */
+
+var (
+	// Elements removed completely (i.e. including their contents).
+	szDropRE = regexp.MustCompile(
+		`(?is)<!--.*?-->|<(script|style|iframe|object|embed|noscript|template)\b.*?</(script|style|iframe|object|embed|noscript|template)\s*>`)
+
+	// RegEx to find a single HTML tag.
+	szTagRE = regexp.MustCompile(`(?s)<(/?)([a-zA-Z][a-zA-Z0-9]*)\b([^>]*)>`)
+	//                                  1   2222222222222222222222  333333
+
+	// RegEx to find an `href` attribute.
+	szHrefRE = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+	// Elements allowed to stay (without any attributes but `href`).
+	szAllowedTags = map[string]bool{
+		`a`: true, `b`: true, `blockquote`: true, `br`: true,
+		`code`: true, `dd`: true, `div`: true, `dl`: true, `dt`: true,
+		`em`: true, `h1`: true, `h2`: true, `h3`: true, `h4`: true,
+		`h5`: true, `h6`: true, `hr`: true, `i`: true, `li`: true,
+		`ol`: true, `p`: true, `pre`: true, `s`: true, `small`: true,
+		`span`: true, `strong`: true, `sub`: true, `sup`: true,
+		`u`: true, `ul`: true,
+	}
+)
+
+// `sanitizeHTML()` returns `aHTML` with all potentially dangerous
+// elements and attributes (scripts, styles, event handlers etc.)
+// removed.
+//
+//	`aHTML` The HTML fragment to clean up.
+func sanitizeHTML(aHTML string) string {
+	if 0 == len(aHTML) {
+		return ``
+	}
+	result := szDropRE.ReplaceAllString(aHTML, ``)
+
+	return szTagRE.ReplaceAllStringFunc(result, func(aTag string) string {
+		parts := szTagRE.FindStringSubmatch(aTag)
+		name := strings.ToLower(parts[2])
+		if !szAllowedTags[name] {
+			return ``
+		}
+		if `/` == parts[1] {
+			return `</` + name + `>`
+		}
+		if `a` != name {
+			return `<` + name + `>`
+		}
+
+		// Links are the only elements keeping an attribute:
+		href := ``
+		if m := szHrefRE.FindStringSubmatch(parts[3]); nil != m {
+			href = html.UnescapeString(strings.TrimSpace(m[1] + m[2] + m[3]))
+		}
+		lh := strings.ToLower(href)
+		if strings.HasPrefix(lh, `http://`) || strings.HasPrefix(lh, `https://`) ||
+			strings.HasPrefix(lh, `mailto:`) ||
+			(strings.HasPrefix(lh, `/`) && !strings.HasPrefix(lh, `//`)) {
+			return `<a href="` + html.EscapeString(href) + `">`
+		}
+
+		return `<a>`
+	})
+} // sanitizeHTML()
+
+/* _EoF_ */
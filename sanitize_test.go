@@ -0,0 +1,41 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"testing"
+)
+
+func Test_sanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		aHTML string
+		want  string
+	}{
+		// TODO: Add test cases.
+		{" 1", ``, ``},
+		{" 2", `<p class="x">Text</p>`, `<p>Text</p>`},
+		{" 3", `<div>a<script>alert(1)</script>b</div>`, `<div>ab</div>`},
+		{" 4", `<p onclick="evil()">x</p><img src="x" onerror="evil()">`, `<p>x</p>`},
+		{" 5", `<a href="javascript:evil()">x</a>`, `<a>x</a>`},
+		{" 6", `<a href='https://example.com/?a=1&amp;b=2' target="_blank">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{" 7", `<A HREF=/doc/1/doc.html>x</A>`, `<a href="/doc/1/doc.html">x</a>`},
+		{" 8", `<a href="//evil.com/">x</a><!-- <b>c</b> -->`, `<a>x</a>`},
+		{" 9", `<STYLE>p{}</STYLE><em>e</em>`, `<em>e</em>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.aHTML); got != tt.want {
+				t.Errorf("sanitizeHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+} // Test_sanitizeHTML()
+
+/* _EoF_ */
@@ -0,0 +1,349 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the functions to send documents to the users'
+ * reading devices by e-mail.
+ *
+ * The devices are configured in a JSON file (`deviceFile` in the INI
+ * file) mapping usernames to lists of devices; the devices listed
+ * for the username `*` are available to all users:
+ *
+ *	{
+ *		"*": [
+ *			{ "name": "PocketBook", "email": "me@pbsync.com" }
+ *		],
+ *		"alice": [
+ *			{ "name": "Kindle", "email": "alice@kindle.com", "formats": ["EPUB", "PDF"] }
+ *		]
+ *	}
+ */
+
+type (
+	// `tDevice` is a single reading device accepting documents
+	// by e-mail.
+	tDevice struct {
+		Name    string   `json:"name"`              // the device's display name
+		EMail   string   `json:"email"`             // the device's mail address
+		Formats []string `json:"formats,omitempty"` // the accepted formats by preference
+	}
+
+	// `tDeviceMap` maps usernames to their devices.
+	tDeviceMap map[string][]tDevice
+)
+
+var (
+	// The formats sent to devices not configuring their own preference.
+	smDefaultFormats = []string{`AZW3`, `EPUB`, `PDF`}
+
+	// Media types of common e-book formats (not always known
+	// by the `mime` package).
+	smMediaTypes = map[string]string{
+		`AZW3`: `application/vnd.amazon.ebook`,
+		`CBZ`:  `application/vnd.comicbook+zip`,
+		`EPUB`: `application/epub+zip`,
+		`MOBI`: `application/x-mobipocket-ebook`,
+		`PDF`:  `application/pdf`,
+	}
+
+	// Timeout for establishing the SMTP connection.
+	smDialTimeout = 30 * time.Second
+)
+
+// `preferredFormat()` returns the format to use for a document
+// (e.g. to send to a device).
+//
+// If `aWanted` is one of the `aAvailable` formats it's returned,
+// otherwise the first of `aPreferred` (or the default preferences
+// `AZW3`, `EPUB`, `PDF`) found in `aAvailable` is returned.
+// If there's no matching format an empty string is returned.
+//
+//	`aAvailable` The formats available for the document.
+//	`aPreferred` The formats accepted (e.g. by a device) by preference.
+//	`aWanted` The format explicitly selected by the user (if any).
+func preferredFormat(aAvailable, aPreferred []string, aWanted string) string {
+	has := make(map[string]bool, len(aAvailable))
+	for _, format := range aAvailable {
+		has[strings.ToUpper(format)] = true
+	}
+	if aWanted = strings.ToUpper(aWanted); has[aWanted] {
+		return aWanted
+	}
+	if 0 == len(aPreferred) {
+		aPreferred = smDefaultFormats
+	}
+	for _, format := range aPreferred {
+		if format = strings.ToUpper(format); has[format] {
+			return format
+		}
+	}
+
+	return ``
+} // preferredFormat()
+
+// `readDevices()` returns the devices configured for `aUser`.
+//
+//	`aFilename` The JSON file to read.
+//	`aUser` The name of the current user.
+func readDevices(aFilename, aUser string) ([]tDevice, error) {
+	data, err := os.ReadFile(aFilename) // #nosec G304
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var devices tDeviceMap
+	if err = json.Unmarshal(data, &devices); nil != err {
+		return nil, err
+	}
+	result := make([]tDevice, 0, len(devices[aUser])+len(devices[`*`]))
+	if 0 < len(aUser) {
+		result = append(result, devices[aUser]...)
+	}
+	result = append(result, devices[`*`]...)
+
+	return result, nil
+} // readDevices()
+
+// `mailMessage()` returns a MIME mail with `aData` attached.
+//
+// The subject is repeated as the mail's (quoted-printable) text and
+// the parts are separated by a random boundary so that no title can
+// break the mail's structure.
+//
+//	`aFrom` The sender's address.
+//	`aTo` The recipient's address.
+//	`aSubject` The mail's subject (i.e. the document's title).
+//	`aFilename` The attachment's filename.
+//	`aType` The attachment's media type.
+//	`aData` The attachment's content.
+func mailMessage(aFrom, aTo, aSubject, aFilename, aType string, aData []byte) []byte {
+	domain := `localhost`
+	if pos := strings.LastIndexByte(aFrom, '@'); 0 <= pos {
+		domain = aFrom[pos+1:]
+	}
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "From: %s\r\n", aFrom)
+	fmt.Fprintf(buf, "To: %s\r\n", aTo)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode(`utf-8`, aSubject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "Message-ID: <%x.kaliber@%s>\r\n", time.Now().UnixNano(), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: %s\r\n\r\n",
+		mime.FormatMediaType(`multipart/mixed`, map[string]string{`boundary`: mw.Boundary()}))
+
+	// Writing to a `bytes.Buffer` doesn't fail, hence the errors
+	// are ignored.
+	tw, _ := mw.CreatePart(textproto.MIMEHeader{
+		`Content-Type`:              {`text/plain; charset=utf-8`},
+		`Content-Transfer-Encoding`: {`quoted-printable`},
+	})
+	qw := quotedprintable.NewWriter(tw)
+	_, _ = qw.Write([]byte(aSubject + "\r\n"))
+	_ = qw.Close()
+
+	aw, _ := mw.CreatePart(textproto.MIMEHeader{
+		`Content-Type`:              {mime.FormatMediaType(aType, map[string]string{`name`: aFilename})},
+		`Content-Disposition`:       {mime.FormatMediaType(`attachment`, map[string]string{`filename`: aFilename})},
+		`Content-Transfer-Encoding`: {`base64`},
+	})
+	encoded := base64.StdEncoding.EncodeToString(aData)
+	for 76 < len(encoded) {
+		_, _ = io.WriteString(aw, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	_, _ = io.WriteString(aw, encoded+"\r\n")
+	_ = mw.Close()
+
+	return buf.Bytes()
+} // mailMessage()
+
+// `sendMail()` sends `aMessage` to `aTo` using the configured
+// SMTP server.
+//
+//	`aFrom` The sender's address.
+//	`aTo` The recipient's address.
+//	`aMessage` The complete mail to send.
+func sendMail(aFrom, aTo string, aMessage []byte) error {
+	host := AppArgs.SMTPHost
+	conn, err := net.DialTimeout(`tcp`,
+		net.JoinHostPort(host, strconv.Itoa(AppArgs.SMTPPort)), smDialTimeout)
+	if nil != err {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if nil != err {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if AppArgs.SMTPStartTLS {
+		if ok, _ := client.Extension(`STARTTLS`); !ok {
+			return fmt.Errorf("SMTP server %s doesn't support STARTTLS", host)
+		}
+		if err = client.StartTLS(&tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: host,
+		}); nil != err {
+			return err
+		}
+	}
+	if 0 < len(AppArgs.SMTPUser) {
+		if err = client.Auth(smtp.PlainAuth(``, AppArgs.SMTPUser, AppArgs.SMTPPassword, host)); nil != err {
+			return err
+		}
+	}
+	if err = client.Mail(aFrom); nil != err {
+		return err
+	}
+	if err = client.Rcpt(aTo); nil != err {
+		return err
+	}
+	w, err := client.Data()
+	if nil != err {
+		return err
+	}
+	if _, err = w.Write(aMessage); nil != err {
+		return err
+	}
+	if err = w.Close(); nil != err {
+		return err
+	}
+
+	return client.Quit()
+} // sendMail()
+
+// `sendToDevice()` mails the document's `aFormat` to `aDevice`.
+//
+//	`aDoc` The document to send.
+//	`aFormat` The document's format to send.
+//	`aDevice` The reading device to send the document to.
+func sendToDevice(aDoc *db.TDocument, aFormat string, aDevice tDevice) error {
+	file := aDoc.Filename(aFormat)
+	if 0 == len(file) {
+		return fmt.Errorf("format %s of document %d not found", aFormat, aDoc.ID)
+	}
+	fName := filepath.Join(db.CalibreLibraryPath(), file)
+	fi, err := os.Stat(fName)
+	if nil != err {
+		return err
+	}
+	if maxSize := int64(AppArgs.SMTPMaxSize) << 20; fi.Size() > maxSize {
+		return fmt.Errorf("the %s file is too large to be mailed (%.1f MB, limit %d MB)",
+			aFormat, float64(fi.Size())/(1<<20), AppArgs.SMTPMaxSize)
+	}
+	data, err := os.ReadFile(fName) // #nosec G304
+	if nil != err {
+		return err
+	}
+	mType, ok := smMediaTypes[aFormat]
+	if !ok {
+		if mType = mime.TypeByExtension(filepath.Ext(fName)); 0 == len(mType) {
+			mType = `application/octet-stream`
+		}
+	}
+	msg := mailMessage(AppArgs.SMTPFrom, aDevice.EMail, aDoc.Title,
+		filepath.Base(fName), mType, data)
+
+	return sendMail(AppArgs.SMTPFrom, aDevice.EMail, msg)
+} // sendToDevice()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleSend()` serves the page to send a document to one of the
+// user's reading devices.
+//
+// A GET request shows the available devices and formats while
+// a POST request actually sends the document.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL's remaining path (i.e. `{id}`).
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+//	`aDB` The DB handle to access the `Calibre` database.
+func (ph *TPageHandler) handleSend(aWriter http.ResponseWriter, aRequest *http.Request, aTail string, aOptions *db.TQueryOptions, aSession *sessions.TSession, aDB *db.TDataBase) {
+	if 0 == len(AppArgs.SMTPHost) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	id, _ := strconv.Atoi(strings.SplitN(aTail, `/`, 2)[0])
+	doc := aDB.QueryDocMini(aRequest.Context(), db.TID(id))
+	if nil == doc {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	devices, err := readDevices(AppArgs.DeviceFile, ph.authUser(aRequest))
+	if nil != err {
+		msg := fmt.Sprintf("readDevices(%s): %v", AppArgs.DeviceFile, err)
+		logRequest(aRequest, "TPageHandler.handleSend()", msg)
+	}
+	var formats []string
+	if list := doc.Files(); nil != list {
+		for _, file := range *list {
+			formats = append(formats, file.Name)
+		}
+	}
+	pageData := ph.basicTemplateData(aRequest, aOptions).
+		Set("Devices", devices).
+		Set("Document", doc).
+		Set("Formats", formats)
+
+	if `POST` == aRequest.Method {
+		idx, err := strconv.Atoi(aRequest.FormValue(`device`))
+		switch {
+		case (nil != err) || (0 > idx) || (len(devices) <= idx):
+			pageData.Set("Error", `unknown device`)
+		default:
+			device := devices[idx]
+			format := preferredFormat(formats, device.Formats, aRequest.FormValue(`format`))
+			if 0 == len(format) {
+				pageData.Set("Error", fmt.Sprintf("no format accepted by %s available", device.Name))
+			} else if err = sendToDevice(doc, format, device); nil != err {
+				msg := fmt.Sprintf("sendToDevice(%d, %s, %s): %v", doc.ID, format, device.EMail, err)
+				logRequest(aRequest, "TPageHandler.handleSend()", msg)
+				pageData.Set("Error", err.Error())
+			} else {
+				pageData.Set("Sent", format+` → `+device.Name)
+			}
+		}
+	}
+
+	ph.handleReply(`send`, aWriter, aOptions, aSession, pageData)
+} // handleSend()
+
+/* _EoF_ */
@@ -0,0 +1,231 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_preferredFormat(t *testing.T) {
+	type args struct {
+		aAvailable []string
+		aPreferred []string
+		aWanted    string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// TODO: Add test cases.
+		{" 1", args{[]string{`EPUB`, `PDF`}, nil, ``}, `EPUB`},
+		{" 2", args{[]string{`EPUB`, `PDF`}, nil, `pdf`}, `PDF`},
+		{" 3", args{[]string{`EPUB`, `PDF`}, []string{`PDF`, `EPUB`}, ``}, `PDF`},
+		{" 4", args{[]string{`EPUB`, `PDF`}, nil, `MOBI`}, `EPUB`},
+		{" 5", args{[]string{`CBZ`}, nil, ``}, ``},
+		{" 6", args{[]string{`EPUB`, `MOBI`}, []string{`mobi`}, ``}, `MOBI`},
+		{" 7", args{nil, nil, `EPUB`}, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preferredFormat(tt.args.aAvailable, tt.args.aPreferred, tt.args.aWanted); got != tt.want {
+				t.Errorf("preferredFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_preferredFormat()
+
+func Test_readDevices(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), `devices.json`)
+	if err := os.WriteFile(fName, []byte(`{
+		"*": [ { "name": "Shared", "email": "shared@example.com" } ],
+		"alice": [ { "name": "Kindle", "email": "alice@example.com", "formats": ["EPUB"] } ]
+	}`), 0600); nil != err {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		file  string
+		user  string
+		want  []string
+		isErr bool
+	}{
+		// TODO: Add test cases.
+		{" 1", fName, `alice`, []string{`Kindle`, `Shared`}, false},
+		{" 2", fName, `bob`, []string{`Shared`}, false},
+		{" 3", fName, ``, []string{`Shared`}, false},
+		{" 4", fName + `.missing`, `alice`, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readDevices(tt.file, tt.user)
+			if (nil != err) != tt.isErr {
+				t.Errorf("readDevices() error = %v, wantErr %v", err, tt.isErr)
+				return
+			}
+			var names []string
+			for _, dev := range got {
+				names = append(names, dev.Name)
+			}
+			if strings.Join(names, `,`) != strings.Join(tt.want, `,`) {
+				t.Errorf("readDevices() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+} // Test_readDevices()
+
+func Test_mailMessage(t *testing.T) {
+	data := bytes.Repeat([]byte(`0123456789`), 20)
+
+	tests := []struct {
+		name    string
+		subject string
+	}{
+		// TODO: Add test cases.
+		{" 1", `Ein Büchlein`},
+		{" 2", "Broken\r\n--kaliber-1234\r\nContent-Type: text/html\r\n\r\n<b>x</b>"},
+		{" 3", "--\r\n--\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := mailMessage(`kaliber@example.com`, `reader@example.com`,
+				tt.subject, `book.epub`, `application/epub+zip`, data)
+
+			msg, err := mail.ReadMessage(bytes.NewReader(raw))
+			if nil != err {
+				t.Fatalf("mail.ReadMessage() error = %v", err)
+			}
+			dec := new(mime.WordDecoder)
+			if subject, _ := dec.DecodeHeader(msg.Header.Get(`Subject`)); tt.subject != subject {
+				t.Errorf("mailMessage() subject = %q", subject)
+			}
+			mType, params, err := mime.ParseMediaType(msg.Header.Get(`Content-Type`))
+			if (nil != err) || (`multipart/mixed` != mType) {
+				t.Fatalf("mailMessage() content type = %v (%v)", mType, err)
+			}
+			mr := multipart.NewReader(msg.Body, params[`boundary`])
+			part, err := mr.NextPart() // the text part
+			if nil != err {
+				t.Fatal(err)
+			}
+			if text, _ := io.ReadAll(part); tt.subject+"\r\n" != string(text) {
+				t.Errorf("mailMessage() text = %q", text)
+			}
+			if part, err = mr.NextPart(); nil != err {
+				t.Fatal(err)
+			}
+			if `book.epub` != part.FileName() {
+				t.Errorf("mailMessage() filename = %v", part.FileName())
+			}
+			// `multipart` decodes "quoted-printable" only, so check the
+			// base64 encoded attachment by hand:
+			encoded, _ := io.ReadAll(part)
+			for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+				if 76 < len(line) {
+					t.Errorf("mailMessage() line too long: %d", len(line))
+				}
+			}
+			if got, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ``)); (nil != err) || !bytes.Equal(data, got) {
+				t.Errorf("mailMessage() attachment = %q (%v)", got, err)
+			}
+			if _, err = mr.NextPart(); io.EOF != err {
+				t.Errorf("mailMessage() more parts: %v", err)
+			}
+		})
+	}
+} // Test_mailMessage()
+
+// `fakeSMTP()` runs a minimal SMTP server accepting a single mail
+// and returns its port and a channel delivering the received data.
+func fakeSMTP(t *testing.T) (int, <-chan string) {
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	result := make(chan string, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if nil != err {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(aLine string) { _, _ = conn.Write([]byte(aLine + "\r\n")) }
+		reply(`220 localhost ESMTP`)
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if nil != err {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, `EHLO`), strings.HasPrefix(cmd, `HELO`):
+				reply(`250 localhost`)
+			case `DATA` == cmd:
+				reply(`354 go ahead`)
+				for {
+					line, err = r.ReadString('\n')
+					if (nil != err) || (".\r\n" == line) {
+						break
+					}
+					data.WriteString(line)
+				}
+				result <- data.String()
+				reply(`250 OK`)
+			case `QUIT` == cmd:
+				reply(`221 bye`)
+				return
+			default:
+				reply(`250 OK`)
+			}
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, result
+} // fakeSMTP()
+
+func Test_sendMail(t *testing.T) {
+	saved := AppArgs
+	defer func() { AppArgs = saved }()
+
+	port, received := fakeSMTP(t)
+	AppArgs.SMTPHost, AppArgs.SMTPPort = `127.0.0.1`, port
+	AppArgs.SMTPStartTLS, AppArgs.SMTPUser = false, ``
+
+	msg := mailMessage(`kaliber@example.com`, `reader@example.com`,
+		`Test`, `t.pdf`, `application/pdf`, []byte(`%PDF-1.4`))
+	if err := sendMail(`kaliber@example.com`, `reader@example.com`, msg); nil != err {
+		t.Fatalf("sendMail() error = %v", err)
+	}
+	if got := <-received; !strings.Contains(got, `filename=t.pdf`) {
+		t.Errorf("sendMail() received = %v", got)
+	}
+
+	// A server without STARTTLS must be refused if TLS is required:
+	port, _ = fakeSMTP(t)
+	AppArgs.SMTPPort, AppArgs.SMTPStartTLS = port, true
+	if err := sendMail(`kaliber@example.com`, `reader@example.com`, msg); nil == err {
+		t.Errorf("sendMail() = nil, want STARTTLS error")
+	}
+} // Test_sendMail()
+
+/* _EoF_ */
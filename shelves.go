@@ -0,0 +1,264 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the handling of the users' personal shelves
+ * stored in Kaliber's own database.
+ *
+ * The supported URLs are:
+ *
+ *	/favourites          browse the user's favourites
+ *	/shelves/            the list of the user's shelves
+ *	/shelves/{id}        browse the documents on a shelf
+ *
+ * Shelves are created, renamed, and deleted by POSTing the `action`
+ * (`create`, `rename`, or `delete`), `id`, and `name` fields to
+ * `/shelves/`; documents are put on or taken off a shelf by POSTing
+ * the `favourite` (`add` or `remove`), `add` (along with `shelf`),
+ * or `remove` fields to `/shelf/{id}`.
+ */
+
+// `userShelves()` returns the current user's shelves and the ID
+// of the favourites shelf.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aUser` The name of the current user.
+func userShelves(aRequest *http.Request, aUser string) (*db.TUserDB, []db.TShelf, db.TID, error) {
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		return nil, nil, 0, err
+	}
+	fav, err := udb.FavouritesShelf(aRequest.Context(), aUser)
+	if nil != err {
+		return nil, nil, 0, err
+	}
+	shelves, err := udb.Shelves(aRequest.Context(), aUser)
+
+	return udb, shelves, fav, err
+} // userShelves()
+
+// `setShelfData()` adds the current user's shelves and favourites
+// needed by the document lists to `aPageData`.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aPageData` The page's template data.
+//	`aOptions` The current query options to use.
+func (ph *TPageHandler) setShelfData(aRequest *http.Request, aPageData *TemplateData, aOptions *db.TQueryOptions) {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		return
+	}
+	favourites := make(map[db.TID]bool)
+	aPageData.Set("Favourites", favourites)
+
+	udb, shelves, fav, err := userShelves(aRequest, user)
+	if nil != err {
+		msg := fmt.Sprintf("userShelves(): %v", err)
+		logRequest(aRequest, "TPageHandler.setShelfData()", msg)
+		return
+	}
+	ids, err := udb.ShelfBookIDs(aRequest.Context(), user, fav)
+	if nil != err {
+		msg := fmt.Sprintf("ShelfBookIDs(%d): %v", fav, err)
+		logRequest(aRequest, "TPageHandler.setShelfData()", msg)
+	}
+	for _, id := range ids {
+		favourites[id] = true
+	}
+	others := make([]db.TShelf, 0, len(shelves))
+	for _, shelf := range shelves {
+		if (`shelves` == aOptions.Entity) && (shelf.ID == aOptions.ID) {
+			aPageData.Set("Shelf", shelf)
+		}
+		if !shelf.Favourite {
+			others = append(others, shelf)
+		}
+	}
+	aPageData.Set("Shelves", others)
+} // setShelfData()
+
+// `setDocShelfData()` adds the current user's shelves holding the
+// document `aID` as well as the other shelves to `aPageData`.
+//
+// The function returns a value identifying the current shelves
+// (to be used for the page's ETag).
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aPageData` The page's template data.
+//	`aID` The document's ID.
+func (ph *TPageHandler) setDocShelfData(aRequest *http.Request, aPageData *TemplateData, aID db.TID) string {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		return ``
+	}
+	udb, shelves, _, err := userShelves(aRequest, user)
+	if nil == err {
+		var ids []db.TID
+		if ids, err = udb.BookShelves(aRequest.Context(), user, aID); nil == err {
+			onShelf := make(map[db.TID]bool, len(ids))
+			for _, id := range ids {
+				onShelf[id] = true
+			}
+			var (
+				isFav         bool
+				holding, rest []db.TShelf
+			)
+			for _, shelf := range shelves {
+				switch {
+				case shelf.Favourite:
+					isFav = onShelf[shelf.ID]
+				case onShelf[shelf.ID]:
+					holding = append(holding, shelf)
+				default:
+					rest = append(rest, shelf)
+				}
+			}
+			aPageData.Set("CanShelve", true).
+				Set("IsFavourite", isFav).
+				Set("OnShelves", holding).
+				Set("OtherShelves", rest)
+
+			return fmt.Sprintf("%v|%v", shelves, ids)
+		}
+	}
+	msg := fmt.Sprintf("shelves of %d: %v", aID, err)
+	logRequest(aRequest, "TPageHandler.setDocShelfData()", msg)
+
+	return ``
+} // setDocShelfData()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleShelf()` puts a document on (or takes it off) one of the
+// current user's shelves and redirects the remote user accordingly.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aTail` The URL's remaining path (i.e. `{id}`).
+func (ph *TPageHandler) handleShelf(aWriter http.ResponseWriter, aRequest *http.Request, aTail string) {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	num, _ := strconv.Atoi(strings.SplitN(aTail, `/`, 2)[0])
+	if 0 >= num {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	id := db.TID(num)
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleShelf()`,
+			fmt.Sprintf("db.OpenUserDatabase(): %v", err))
+		return
+	}
+
+	formID := func(aField string) db.TID {
+		result, _ := strconv.Atoi(aRequest.FormValue(aField))
+		return db.TID(result)
+	} // formID()
+
+	ctx := aRequest.Context()
+	if fav := aRequest.FormValue(`favourite`); 0 < len(fav) {
+		var shelf db.TID
+		if shelf, err = udb.FavouritesShelf(ctx, user); nil == err {
+			if `remove` == fav {
+				err = udb.RemoveFromShelf(ctx, user, shelf, id)
+			} else {
+				err = udb.AddToShelf(ctx, user, shelf, id)
+			}
+		}
+	} else if shelf := formID(`remove`); 0 < shelf {
+		err = udb.RemoveFromShelf(ctx, user, shelf, id)
+	} else if 0 < len(aRequest.FormValue(`add`)) {
+		err = udb.AddToShelf(ctx, user, formID(`shelf`), id)
+	}
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleShelf()`,
+			fmt.Sprintf("shelf(%d): %v", id, err))
+		return
+	}
+
+	target := fmt.Sprintf("/doc/%d/doc.html", id)
+	if 0 < len(aRequest.FormValue(`list`)) {
+		// `/back` shows the current page of the document list again:
+		target = fmt.Sprintf("/back#b%d", id)
+	}
+	http.Redirect(aWriter, aRequest, target, http.StatusSeeOther)
+} // handleShelf()
+
+// `handleShelves()` serves the list of the current user's shelves
+// (GET) or creates, renames, or deletes a shelf (POST).
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+func (ph *TPageHandler) handleShelves(aWriter http.ResponseWriter, aRequest *http.Request, aOptions *db.TQueryOptions, aSession *sessions.TSession) {
+	user, ok := ph.readingUser(aRequest)
+	if !ok {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleShelves()`,
+			fmt.Sprintf("db.OpenUserDatabase(): %v", err))
+		return
+	}
+
+	if `POST` == aRequest.Method {
+		ctx := aRequest.Context()
+		id, _ := strconv.Atoi(aRequest.FormValue(`id`))
+		name := aRequest.FormValue(`name`)
+		switch aRequest.FormValue(`action`) {
+		case `create`:
+			_, err = udb.CreateShelf(ctx, user, name)
+		case `delete`:
+			err = udb.DeleteShelf(ctx, user, db.TID(id))
+		case `rename`:
+			err = udb.RenameShelf(ctx, user, db.TID(id), name)
+		}
+		if db.ErrShelfName == err {
+			http.Error(aWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if nil != err {
+			handleInternalError(aWriter, `TPageHandler.handleShelves()`,
+				fmt.Sprintf("shelf(%d, %q): %v", id, name, err))
+			return
+		}
+		http.Redirect(aWriter, aRequest, `/shelves/`, http.StatusSeeOther)
+		return
+	}
+
+	_, shelves, _, err := userShelves(aRequest, user)
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleShelves()`,
+			fmt.Sprintf("userShelves(): %v", err))
+		return
+	}
+	pageData := ph.basicTemplateData(aRequest, aOptions).
+		Set("ShelfList", shelves)
+	ph.handleReply(`shelves`, aWriter, aOptions, aSession, pageData)
+} // handleShelves()
+
+/* _EoF_ */
@@ -17,9 +17,10 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
-	"github.com/mwat56/apachelogger"
 	"github.com/mwat56/kaliber/db"
 	"github.com/nfnt/resize"
 )
@@ -28,6 +29,36 @@ import (
  * This file provides functions for thumbnail generation and maintenance.
  */
 
+type (
+	// `tThumbProgress` is the state of the thumbnail generation
+	// run by `ThumbnailUpdate()`.
+	tThumbProgress struct {
+		Done      int       // number of documents checked
+		Failed    int       // number of failed thumbnails
+		Finished  time.Time // zero while running
+		LastError string    // the latest failure (if any)
+		Started   time.Time
+		Total     int // number of documents to check
+	}
+)
+
+var (
+	// The progress of the latest thumbnail generation.
+	thProgress tThumbProgress
+
+	// Guard against concurrent access of `thProgress`.
+	thProgressMtx sync.Mutex
+)
+
+// `thumbProgress()` returns the progress of the latest thumbnail
+// generation.
+func thumbProgress() tThumbProgress {
+	thProgressMtx.Lock()
+	defer thProgressMtx.Unlock()
+
+	return thProgress
+} // thumbProgress()
+
 // `goThumbCleanup()` removes orphaned thumbnails.
 //
 //	`aDB` The DB handle to access the `Calibre` database.
@@ -36,7 +67,7 @@ func goThumbCleanup(aDB *db.TDataBase) {
 	dirNames, err := filepath.Glob(bd + "/*")
 	if nil != err {
 		msg := fmt.Sprintf("filepath.Glob(%s): %v", bd, err)
-		apachelogger.Err("goThumbCleanup()", msg)
+		logError("goThumbCleanup()", msg)
 		return
 	}
 	for _, numDir := range dirNames {
@@ -55,7 +86,7 @@ func checkThumbBase(aDirectory string, aDB *db.TDataBase) {
 	subDirs, err := filepath.Glob(aDirectory + "/*")
 	if nil != err {
 		msg := fmt.Sprintf("filepath.Glob(%s): %v", aDirectory+"/*", err)
-		apachelogger.Err("checkThumbBase()", msg)
+		logError("checkThumbBase()", msg)
 		return
 	}
 	for _, subDir := range subDirs {
@@ -71,7 +102,7 @@ func checkThumbDir(aDirectory string, aDB *db.TDataBase) {
 	fileDirs, err := filepath.Glob(aDirectory + "/*.jpg")
 	if nil != err {
 		msg := fmt.Sprintf("filepath.Glob(%s): %v", aDirectory+"/*.jpg", err)
-		apachelogger.Err("checkThumbDir()", msg)
+		logError("checkThumbDir()", msg)
 		return
 	}
 	for _, fName := range fileDirs {
@@ -89,7 +120,7 @@ func checkThumbFile(aFilename string, aDB *db.TDataBase) {
 	docID, err := strconv.Atoi(baseName[:len(baseName)-4])
 	if nil != err {
 		msg = fmt.Sprintf("strconv.Atoi(%s): %v", baseName[:len(baseName)-4], err)
-		apachelogger.Err("checkThumbFile()", msg)
+		logError("checkThumbFile()", msg)
 		return
 	}
 
@@ -98,7 +129,7 @@ func checkThumbFile(aFilename string, aDB *db.TDataBase) {
 		// remove thumbnail for non-existing document
 		if err = os.Remove(aFilename); nil != err {
 			msg = fmt.Sprintf("os.Remove(%s): %v", aFilename, err)
-			apachelogger.Err("checkThumbFile()", msg)
+			logError("checkThumbFile()", msg)
 		}
 		return
 	}
@@ -106,21 +137,21 @@ func checkThumbFile(aFilename string, aDB *db.TDataBase) {
 	cFile, err := doc.CoverFile()
 	if nil != err {
 		msg = fmt.Sprintf("doc.CoverFile(%d): %v", docID, err)
-		apachelogger.Err("checkThumbFile()", msg)
+		logError("checkThumbFile()", msg)
 		return
 	}
 
 	tFI, err := os.Stat(aFilename)
 	if nil != err {
 		msg = fmt.Sprintf("os.Stat(%s): %v", aFilename, err)
-		apachelogger.Err("checkThumbFile()", msg)
+		logError("checkThumbFile()", msg)
 		return
 	}
 
 	cFI, err := os.Stat(cFile)
 	if nil != err {
 		msg = fmt.Sprintf("os.Stat(%s): %v", cFile, err)
-		apachelogger.Err("checkThumbFile()", msg)
+		logError("checkThumbFile()", msg)
 		return
 	}
 
@@ -128,11 +159,11 @@ func checkThumbFile(aFilename string, aDB *db.TDataBase) {
 		// remove outdated thumbnail
 		if err = os.Remove(aFilename); nil != err {
 			msg = fmt.Sprintf("os.Remove(%s): %v", aFilename, err)
-			apachelogger.Err("checkThumbFile()", msg)
+			logError("checkThumbFile()", msg)
 		}
 		if err = makeThumbnail(cFile, aFilename); nil != err {
 			msg = fmt.Sprintf("makeThumbnail(%s): %v", aFilename, err)
-			apachelogger.Err("checkThumbFile()", msg)
+			logError("checkThumbFile()", msg)
 		}
 	}
 } // checkThumbFile()
@@ -161,6 +192,11 @@ func makeThumbnail(aSrcName, aDstName string) error {
 		err          error
 		dFile, sFile *os.File
 	)
+	defer func(aStart time.Time) {
+		if nil == err {
+			srvMetrics.observeThumbTime(time.Since(aStart))
+		}
+	}(time.Now())
 
 	if sFile, err = os.OpenFile(aSrcName, os.O_RDONLY, 0); /* #nosec G304 */ nil != err {
 		return err
@@ -198,26 +234,36 @@ var (
 // It will return original image, without processing it, if original sizes
 // are already smaller than provided constraints.
 func makeThumbPrim(img image.Image) image.Image {
-	origBounds := img.Bounds()
+	return resizeImage(img, thThumbwidth)
+} // makeThumbPrim()
+
+// `resizeImage()` downscales `aImage` to `aWidth` preserving the
+// original aspect ratio.
+//
+//	`aImage` The image to resize.
+//	`aWidth` The maximal width of the resulting image.
+func resizeImage(aImage image.Image, aWidth uint) image.Image {
+	origBounds := aImage.Bounds()
 	origWidth, origHeight := uint(origBounds.Dx()), uint(origBounds.Dy())
 	newWidth, newHeight := origWidth, origHeight
 
 	// Preserve aspect ratio
-	if origWidth > thThumbwidth {
-		newHeight = origHeight * thThumbwidth / origWidth
+	if origWidth > aWidth {
+		newHeight = origHeight * aWidth / origWidth
 		if newHeight < 1 {
 			newHeight = 1
 		}
-		newWidth = thThumbwidth
+		newWidth = aWidth
 	}
 
-	return resize.Resize(newWidth, newHeight, img, resize.Bilinear)
-} // makeThumbPrim()
+	return resize.Resize(newWidth, newHeight, aImage, resize.Bilinear)
+} // resizeImage()
 
 // Thumbnail generates a thumbnail of the document's cover.
 //
+//	`aContext` The current web request's context.
 //	`aDoc` The document to check the thumbnail for.
-func Thumbnail(aDoc *db.TDocument) (string, error) {
+func Thumbnail(aContext context.Context, aDoc *db.TDocument) (string, error) {
 	var (
 		err      error
 		sName    string
@@ -239,15 +285,20 @@ func Thumbnail(aDoc *db.TDocument) (string, error) {
 	if dFI, err = os.Stat(dName); nil == err {
 		if dFI.ModTime().After(sFI.ModTime()) {
 			// dest file exists and is younger than the original cover file
+			srvMetrics.observeThumb(true)
 			return dName, nil
 		}
 	}
+	srvMetrics.observeThumb(false)
 	if err = makeThumbDir(aDoc); nil != err {
 		return "", err
 	}
+	start := time.Now()
 	if err = makeThumbnail(sName, dName); nil != err {
 		return "", err
 	}
+	logContext(aContext, levelDebug, "Thumbnail()",
+		fmt.Sprintf("generated %s in %v", dName, time.Since(start)))
 
 	return dName, nil
 } // Thumbnail()
@@ -288,7 +339,7 @@ func ThumbnailUpdate() {
 	dbHandle, err := db.OpenDatabase(ctx)
 	if nil != err {
 		msg := fmt.Sprintf("OpenDatabase(): %v", err)
-		apachelogger.Err("ThumbnailUpdate()", msg)
+		logError("ThumbnailUpdate()", msg)
 		return
 	}
 
@@ -296,12 +347,27 @@ func ThumbnailUpdate() {
 	if nil != err {
 		return
 	}
+	thProgressMtx.Lock()
+	thProgress = tThumbProgress{Started: time.Now(), Total: len(*docList)}
+	thProgressMtx.Unlock()
+
 	for _, doc := range *docList {
-		if _, err = Thumbnail(&doc); nil != err {
-			msg := fmt.Sprintf("Thumbnail(%d): %v", doc.ID, err)
-			apachelogger.Err("ThumbnailUpdate()", msg)
+		var msg string
+		if _, err = Thumbnail(ctx, &doc); nil != err {
+			msg = fmt.Sprintf("Thumbnail(%d): %v", doc.ID, err)
+			logError("ThumbnailUpdate()", msg)
+		}
+		thProgressMtx.Lock()
+		thProgress.Done++
+		if 0 < len(msg) {
+			thProgress.Failed++
+			thProgress.LastError = msg
 		}
+		thProgressMtx.Unlock()
 	}
+	thProgressMtx.Lock()
+	thProgress.Finished = time.Now()
+	thProgressMtx.Unlock()
 
 	// Delete/update all orphaned/outdated thumbnails:
 	go goThumbCleanup(dbHandle)
@@ -79,7 +79,7 @@ func TestThumbnail(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := Thumbnail(tt.args.aDoc)
+			got, err := Thumbnail(context.TODO(), tt.args.aDoc)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Thumbnail() error = %v,\nwantErr %v", err, tt.wantErr)
 				return
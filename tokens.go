@@ -0,0 +1,249 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/sessions"
+)
+
+/*
+ * This file provides the users' API tokens for OPDS clients and
+ * scripts which shouldn't know the users' passwords.
+ *
+ * A token is accepted either as an `Authorization: Bearer {token}`
+ * header or as the URL path prefix `/t/{token}/` (for clients which
+ * can't set headers); in the latter case all links of the OPDS feeds
+ * carry the prefix as well.
+ *
+ * Tokens are read-only: they allow GET requests only, restricted
+ * by the token's scope and the user's role.
+ *
+ * The users manage their tokens on the `/account/` page.
+ */
+
+type (
+	// `tTokenAuth` is the API token used for the current request.
+	tTokenAuth struct {
+		prefix string // the URL path prefix (if any)
+		token  *db.TToken
+	}
+
+	// `tTokenKey` is the context key of a request's `tTokenAuth`.
+	tTokenKey struct{}
+)
+
+// `requestToken()` returns the API token used for `aRequest` (if any)
+// and the URL path prefix it was given by.
+//
+//	`aRequest` The HTTP request received by the server.
+func requestToken(aRequest *http.Request) (*db.TToken, string) {
+	if ta, ok := aRequest.Context().Value(tTokenKey{}).(*tTokenAuth); ok {
+		return ta.token, ta.prefix
+	}
+
+	return nil, ``
+} // requestToken()
+
+// `tokenPermissions()` returns the permissions granted by `aToken`
+// for the HTTP method `aMethod`.
+//
+//	`aToken` The API token used for the request.
+//	`aMethod` The request's HTTP method.
+func tokenPermissions(aToken *db.TToken, aMethod string) tPermission {
+	if (`GET` != aMethod) && (`HEAD` != aMethod) {
+		return 0 // tokens are read-only
+	}
+	if db.TokenScopeDownload == aToken.Scope {
+		return permBrowse | permDownload | permBulk
+	}
+
+	return permBrowse
+} // tokenPermissions()
+
+// `prefixLinks()` prepends `aPrefix` to all the absolute link paths
+// of the marshalled OPDS feed `aPage`.
+//
+//	`aPage` The XML or JSON data of the feed.
+//	`aPrefix` The URL path prefix to add.
+func prefixLinks(aPage []byte, aPrefix string) []byte {
+	if 0 == len(aPrefix) {
+		return aPage
+	}
+	for _, attr := range []string{` href="/`, `<uri>/`, `"href":"/`} {
+		aPage = bytes.ReplaceAll(aPage, []byte(attr),
+			[]byte(attr[:len(attr)-1]+aPrefix+`/`))
+	}
+
+	return aPage
+} // prefixLinks()
+
+// `splitTokenPath()` splits a `/t/{token}/...` URL path into the
+// token and the remaining path.
+//
+//	`aPath` The URL path to split.
+func splitTokenPath(aPath string) (rToken, rPath string) {
+	if !strings.HasPrefix(aPath, `/t/`) {
+		return ``, aPath
+	}
+	parts := strings.SplitN(aPath[3:], `/`, 2)
+	rToken, rPath = parts[0], `/`
+	if 2 == len(parts) {
+		rPath += parts[1]
+	}
+
+	return
+} // splitTokenPath()
+
+// `checkToken()` checks whether `aRequest` uses an API token.
+//
+// It returns the (possibly modified) request and whether it may be
+// processed; otherwise a reply is sent already.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) checkToken(aWriter http.ResponseWriter, aRequest *http.Request) (*http.Request, bool) {
+	var path, prefix, value string
+	if auth := aRequest.Header.Get(`Authorization`); (7 < len(auth)) &&
+		strings.EqualFold(`Bearer `, auth[:7]) {
+		value = strings.TrimSpace(auth[7:])
+	} else if value, path = splitTokenPath(aRequest.URL.Path); 0 < len(value) {
+		prefix = `/t/` + value
+		aRequest = aRequest.Clone(aRequest.Context())
+		aRequest.URL.Path, aRequest.URL.RawPath = path, ``
+	} else {
+		return aRequest, true
+	}
+
+	var token *db.TToken
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil == err {
+		token, err = udb.TokenByValue(aRequest.Context(), value)
+	}
+	if nil != err {
+		if db.ErrTokenUnknown == err {
+			msg := fmt.Sprintf("authentication failure; user=%q rhost=%s",
+				`(token)`, clientIP(aRequest))
+			warnRequest(aRequest, "TPageHandler.checkToken()", msg)
+		} else {
+			msg := fmt.Sprintf("TokenByValue(): %v", err)
+			logRequest(aRequest, "TPageHandler.checkToken()", msg)
+		}
+		denyToken(aWriter)
+		return nil, false
+	}
+	if (nil == ph.usrList) || (!ph.usrList.Exists(token.User)) {
+		// The token's owner was deleted (or there are no users).
+		msg := fmt.Sprintf("authentication failure; user=%q rhost=%s",
+			token.User, clientIP(aRequest))
+		warnRequest(aRequest, "TPageHandler.checkToken()", msg)
+		denyToken(aWriter)
+		return nil, false
+	}
+
+	ctx := context.WithValue(aRequest.Context(), tTokenKey{},
+		&tTokenAuth{prefix: prefix, token: token})
+
+	return aRequest.WithContext(ctx), true
+} // checkToken()
+
+// `denyToken()` tells the remote client that its API token is invalid.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+func denyToken(aWriter http.ResponseWriter) {
+	aWriter.Header().Set(`WWW-Authenticate`,
+		fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", AppArgs.Realm))
+	http.Error(aWriter, `invalid API token`, http.StatusUnauthorized)
+} // denyToken()
+
+/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
+
+// `handleAccount()` shows the current user's API tokens and handles
+// their creation and revocation.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+//	`aOptions` The current query options to use.
+//	`aSession` The current user session.
+func (ph *TPageHandler) handleAccount(aWriter http.ResponseWriter, aRequest *http.Request, aOptions *db.TQueryOptions, aSession *sessions.TSession) {
+	user := ph.authUser(aRequest)
+	if (0 == len(user)) || (0 == len(db.UserDatabaseFile())) {
+		http.NotFound(aWriter, aRequest)
+		return
+	}
+	if token, _ := requestToken(aRequest); nil != token {
+		// Tokens must not be used to manage tokens.
+		http.Error(aWriter, `access forbidden`, http.StatusForbidden)
+		return
+	}
+	udb, err := db.OpenUserDatabase(aRequest.Context())
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleAccount()`,
+			fmt.Sprintf("db.OpenUserDatabase(): %v", err))
+		return
+	}
+	pageData := ph.basicTemplateData(aRequest, aOptions)
+
+	if `POST` == aRequest.Method {
+		ctx := aRequest.Context()
+		switch aRequest.FormValue(`action`) {
+		case `create`:
+			var expires time.Time
+			if days, _ := strconv.Atoi(aRequest.FormValue(`days`)); 0 < days {
+				expires = time.Now().AddDate(0, 0, days)
+			}
+			var token string
+			token, err = udb.CreateToken(ctx, user, aRequest.FormValue(`name`),
+				aRequest.FormValue(`scope`), expires)
+			if db.ErrTokenScope == err {
+				http.Error(aWriter, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// The token is shown just once, so there's no redirect here:
+			pageData.Set("NewToken", token)
+
+		case `revoke`:
+			id, _ := strconv.ParseInt(aRequest.FormValue(`id`), 10, 64)
+			if err = udb.RevokeToken(ctx, user, id); db.ErrTokenUnknown == err {
+				http.NotFound(aWriter, aRequest)
+				return
+			}
+			if nil == err {
+				http.Redirect(aWriter, aRequest, `/account/`, http.StatusSeeOther)
+				return
+			}
+		}
+		if nil != err {
+			handleInternalError(aWriter, `TPageHandler.handleAccount()`,
+				fmt.Sprintf("token(%s): %v", aRequest.FormValue(`action`), err))
+			return
+		}
+	}
+
+	tokens, err := udb.Tokens(aRequest.Context(), user)
+	if nil != err {
+		handleInternalError(aWriter, `TPageHandler.handleAccount()`,
+			fmt.Sprintf("Tokens(): %v", err))
+		return
+	}
+	aWriter.Header().Set(`Cache-Control`, `private, no-store`)
+	pageData.Set("TokenList", tokens).
+		Set("User", user)
+	ph.handleReply(`account`, aWriter, aOptions, aSession, pageData)
+} // handleAccount()
+
+/* _EoF_ */
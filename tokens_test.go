@@ -0,0 +1,163 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mwat56/kaliber/db"
+	"github.com/mwat56/passlist"
+)
+
+func Test_splitTokenPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		wantToken string
+		wantPath  string
+	}{
+		// TODO: Add test cases.
+		{" 1", `/opds`, ``, `/opds`},
+		{" 2", `/t/abc/opds/titles`, `abc`, `/opds/titles`},
+		{" 3", `/t/abc`, `abc`, `/`},
+		{" 4", `/t/`, ``, `/`},
+		{" 5", `/tags/1`, ``, `/tags/1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotToken, gotPath := splitTokenPath(tt.path)
+			if (gotToken != tt.wantToken) || (gotPath != tt.wantPath) {
+				t.Errorf("splitTokenPath() = %q, %q, want %q, %q",
+					gotToken, gotPath, tt.wantToken, tt.wantPath)
+			}
+		})
+	}
+} // Test_splitTokenPath()
+
+func Test_prefixLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   string
+		prefix string
+		want   string
+	}{
+		// TODO: Add test cases.
+		{" 1", `<link href="/opds" rel="start">`, ``, `<link href="/opds" rel="start">`},
+		{" 2", `<link href="/opds" rel="start">`, `/t/abc`, `<link href="/t/abc/opds" rel="start">`},
+		{" 3", `<author><uri>/opds/authors/1</uri></author>`, `/t/abc`, `<author><uri>/t/abc/opds/authors/1</uri></author>`},
+		{" 4", `{"href":"/file/1/EPUB/x.epub"}`, `/t/abc`, `{"href":"/t/abc/file/1/EPUB/x.epub"}`},
+		{" 5", `<link href="https://example.com/">`, `/t/abc`, `<link href="https://example.com/">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(prefixLinks([]byte(tt.page), tt.prefix)); got != tt.want {
+				t.Errorf("prefixLinks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_prefixLinks()
+
+func Test_tokenPermissions(t *testing.T) {
+	catalog := &db.TToken{Scope: db.TokenScopeCatalog}
+	download := &db.TToken{Scope: db.TokenScopeDownload}
+	tests := []struct {
+		name   string
+		token  *db.TToken
+		method string
+		perm   tPermission
+		want   bool
+	}{
+		// TODO: Add test cases.
+		{" 1", catalog, `GET`, permBrowse, true},
+		{" 2", catalog, `GET`, permDownload, false},
+		{" 3", download, `GET`, permDownload, true},
+		{" 4", download, `HEAD`, permBulk, true},
+		{" 5", download, `GET`, permSend, false},
+		{" 6", download, `GET`, permAdmin, false},
+		{" 7", download, `POST`, permBrowse, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := 0 != tokenPermissions(tt.token, tt.method)&tt.perm; got != tt.want {
+				t.Errorf("tokenPermissions() & %v = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+} // Test_tokenPermissions()
+
+func TestTPageHandler_checkToken(t *testing.T) {
+	db.SetUserDatabaseFile(filepath.Join(t.TempDir(), `kaliber.db`))
+	defer db.SetUserDatabaseFile(``)
+	udb, err := db.OpenUserDatabase(context.TODO())
+	if nil != err {
+		t.Fatal(err)
+	}
+	token, _ := udb.CreateToken(context.TODO(), `alice`, `test`, db.TokenScopeCatalog, time.Time{})
+	deleted, _ := udb.CreateToken(context.TODO(), `bob`, `test`, db.TokenScopeCatalog, time.Time{})
+	ph := &TPageHandler{
+		usrList: passlist.NewList(filepath.Join(t.TempDir(), `pwaccess.db`)),
+	}
+	_ = ph.usrList.Add(`alice`, `secret`)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantOK     bool
+		wantPath   string
+		wantPrefix string
+	}{
+		// TODO: Add test cases.
+		{" 1", `/opds`, ``, true, `/opds`, ``},
+		{" 2", `/opds`, `Bearer ` + token, true, `/opds`, ``},
+		{" 3", `/t/` + token + `/opds/new`, ``, true, `/opds/new`, `/t/` + token},
+		{" 4", `/opds`, `bearer bogus`, false, ``, ``},
+		{" 5", `/t/bogus/opds`, ``, false, ``, ``},
+		{" 6", `/opds`, `Bearer ` + deleted, false, ``, ``},
+		{" 7", `/t/` + deleted + `/opds`, ``, false, ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(`GET`, tt.path, nil)
+			if 0 < len(tt.header) {
+				r.Header.Set(`Authorization`, tt.header)
+			}
+			got, ok := ph.checkToken(w, r)
+			if ok != tt.wantOK {
+				t.Fatalf("checkToken() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if http.StatusUnauthorized != w.Code {
+					t.Errorf("checkToken() status = %d, want %d", w.Code, http.StatusUnauthorized)
+				}
+				return
+			}
+			if got.URL.Path != tt.wantPath {
+				t.Errorf("checkToken() path = %v, want %v", got.URL.Path, tt.wantPath)
+			}
+			tok, prefix := requestToken(got)
+			if prefix != tt.wantPrefix {
+				t.Errorf("requestToken() prefix = %v, want %v", prefix, tt.wantPrefix)
+			}
+			if (0 < len(tt.header)) || (0 < len(tt.wantPrefix)) {
+				if (nil == tok) || (`alice` != tok.User) {
+					t.Errorf("requestToken() = %v, want alice's token", tok)
+				}
+			}
+		})
+	}
+} // TestTPageHandler_checkToken()
+
+/* _EoF_ */
@@ -0,0 +1,100 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * This file provides the handling of requests for unknown URLs.
+ *
+ * Depending on the `unknownMode` option those requests are answered
+ * either by a `404 Not Found` error page, a (temporary) redirect to
+ * the `unknownTarget` URL, or – to slow down scanners probing for
+ * vulnerable pages – by a `404` error delayed by `unknownDelay`
+ * seconds.
+ * Each of those requests is logged (with `warn` level) to make
+ * scanning patterns visible.
+ */
+
+const (
+	// Reply to unknown URLs with a `404 Not Found` error page.
+	unknownNotFound = `notfound`
+
+	// Redirect unknown URLs to the `unknownTarget` URL.
+	unknownRedirect = `redirect`
+
+	// Delay the `404` error for unknown URLs.
+	unknownTarpit = `tarpit`
+
+	// Maximal number of requests delayed at the same time;
+	// any further requests are answered at once.
+	unknownMaxTarpits = 128
+)
+
+var (
+	// Number of requests currently delayed by the tarpit.
+	unknownTarpits int32
+)
+
+// `handleUnknown()` answers a request for an unknown URL according
+// to the `unknownMode` option.
+//
+//	`aWriter` Used by the HTTP handler to construct an HTTP response.
+//	`aRequest` The HTTP request received by the server.
+func (ph *TPageHandler) handleUnknown(aWriter http.ResponseWriter, aRequest *http.Request) {
+	mode := AppArgs.UnknownMode
+	if (unknownRedirect == mode) && (0 == len(AppArgs.UnknownTarget)) {
+		mode = unknownNotFound
+	}
+	logContext(aRequest.Context(), levelWarn, "TPageHandler.handleUnknown()",
+		fmt.Sprintf("%s: %s %q from %s", mode, aRequest.Method,
+			aRequest.URL.Path, clientIP(aRequest)))
+
+	switch mode {
+	case unknownRedirect:
+		// A temporary redirect isn't cached by browsers and
+		// search engines.
+		http.Redirect(aWriter, aRequest, AppArgs.UnknownTarget, http.StatusFound)
+		return
+
+	case unknownTarpit:
+		unknownDelay(aRequest, time.Duration(AppArgs.UnknownDelay)*time.Second)
+	}
+
+	http.NotFound(aWriter, aRequest)
+} // handleUnknown()
+
+// `unknownDelay()` waits for `aDelay` unless the client disconnects
+// or too many requests are already waiting.
+//
+//	`aRequest` The HTTP request received by the server.
+//	`aDelay` The time to wait before replying.
+func unknownDelay(aRequest *http.Request, aDelay time.Duration) {
+	if 0 >= aDelay {
+		return
+	}
+	defer atomic.AddInt32(&unknownTarpits, -1)
+	if unknownMaxTarpits < atomic.AddInt32(&unknownTarpits, 1) {
+		return
+	}
+
+	timer := time.NewTimer(aDelay)
+	defer timer.Stop()
+	select {
+	case <-aRequest.Context().Done():
+	case <-timer.C:
+	}
+} // unknownDelay()
+
+/* _EoF_ */
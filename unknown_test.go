@@ -0,0 +1,93 @@
+/*
+   Copyright © 2019, 2020 M.Watermann, 10247 Berlin, Germany
+                  All rights reserved
+               EMail : <support@mwat.de>
+*/
+
+package kaliber
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTPageHandler_handleUnknown(t *testing.T) {
+	saved := AppArgs
+	defer func() { AppArgs = saved }()
+	AppArgs.UnknownDelay = 60
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		mode     string
+		target   string
+		want     int
+		location string
+	}{
+		// TODO: Add test cases.
+		{" 1", unknownNotFound, ``, http.StatusNotFound, ``},
+		{" 2", unknownRedirect, `https://example.com/`, http.StatusFound, `https://example.com/`},
+		{" 3", unknownRedirect, ``, http.StatusNotFound, ``},
+		{" 4", unknownTarpit, ``, http.StatusNotFound, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AppArgs.UnknownMode = tt.mode
+			AppArgs.UnknownTarget = tt.target
+			ph := &TPageHandler{}
+			w := httptest.NewRecorder()
+			// The canceled context ends the tarpit's delay at once.
+			r := httptest.NewRequest(`GET`, `/wp-login.php`, nil).WithContext(canceled)
+			start := time.Now()
+			ph.handleUnknown(w, r)
+			if w.Code != tt.want {
+				t.Errorf("handleUnknown() status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get(`Location`); got != tt.location {
+				t.Errorf("handleUnknown() location = %q, want %q", got, tt.location)
+			}
+			if time.Since(start) > time.Second {
+				t.Errorf("handleUnknown() didn't stop waiting")
+			}
+		})
+	}
+} // TestTPageHandler_handleUnknown()
+
+func Test_unknownDelay(t *testing.T) {
+	r := httptest.NewRequest(`GET`, `/wp-login.php`, nil)
+
+	tests := []struct {
+		name  string
+		delay time.Duration
+		busy  int32
+		min   time.Duration
+	}{
+		// TODO: Add test cases.
+		{" 1", 0, 0, 0},
+		{" 2", 50 * time.Millisecond, 0, 50 * time.Millisecond},
+		{" 3", time.Minute, unknownMaxTarpits, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unknownTarpits = tt.busy
+			start := time.Now()
+			unknownDelay(r, tt.delay)
+			elapsed := time.Since(start)
+			if (elapsed < tt.min) || (elapsed > tt.min+time.Second) {
+				t.Errorf("unknownDelay() waited %v, want %v", elapsed, tt.min)
+			}
+			if unknownTarpits != tt.busy {
+				t.Errorf("unknownDelay() tarpits = %d, want %d", unknownTarpits, tt.busy)
+			}
+		})
+	}
+	unknownTarpits = 0
+} // Test_unknownDelay()
+
+/* _EoF_ */